@@ -1,17 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
-	"ulbios/rfm9x-driver"
 
 	"github.com/grid-x/modbus"
 
-	"periph.io/x/conn/v3/spi"
-	"periph.io/x/conn/v3/spi/spireg"
-	"periph.io/x/host/v3"
-	"periph.io/x/host/v3/sysfs"
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/radio"
+	"github.com/ulbios/lora/sx1276-driver/rpi/reliable"
 )
 
 func GetModBusCli(serial_dev string) (modbus.Client, *modbus.RTUClientHandler) {
@@ -43,38 +43,99 @@ func Read420(c modbus.Client) (uint32, error) {
 	return uint32(r_data[0])<<8 | uint32(r_data[1]), nil
 }
 
-func GetLoRaCli(freq int64) (*rfm9x.Dev, spi.PortCloser, error) {
-	if _, err := host.Init(); err != nil {
-		log.Printf("error initialising Periph: %v\n", err)
-		return nil, nil, err
-	}
-
-	p, err := spireg.Open(lora_spi_port)
+func GetLoRaCli(freq string) (radio.Radio, error) {
+	ch, plan, err := rfm9x.ParseFrequency(freq)
 	if err != nil {
-		log.Printf("error opening the SPI port: %v\n", err)
-		return nil, nil, err
+		log.Printf("error parsing the LoRa frequency: %v\n", err)
+		return nil, err
 	}
 
 	d_opts := rfm9x.DefaultOpts
 
-	if soc == "opi" {
-		d_opts.ResetPin = sysfs.Pins[sysfsPin]
+	conf := rfm9x.DefaultConfig
+	conf.FrequencyHz = ch.FrequencyHz
+	conf.SpreadingFactor = lora_sf
+	if lora_bw != 0 {
+		conf.BandwidthHz = lora_bw
+	} else if ch.BandwidthHz != 0 {
+		conf.BandwidthHz = ch.BandwidthHz
+	}
+	conf.CodingRate = lora_cr
+	conf.TxPowerDbm = lora_tx_power
+	if conf.SyncWord, err = rfm9x.ParseSyncWord(lora_sync_word); err != nil {
+		log.Printf("error parsing the LoRa sync word: %v\n", err)
+		return nil, err
+	}
+	d_opts.Config = &conf
+	d_opts.Logger = rfm9x.NewStdLogger(nil)
+	d_opts.NodeAddress = lora_address
+	d_opts.Destination = lora_destination
+	if lora_lbt_attempts > 0 {
+		d_opts.Lbt = rfm9x.DefaultLbtPolicy
+		d_opts.Lbt.MaxAttempts = lora_lbt_attempts
+		d_opts.Lbt.MaxBackoff = time.Duration(lora_lbt_backoff) * time.Millisecond
+	}
+	if lora_duty_cycle > 0 {
+		d_opts.DutyCycle = rfm9x.DutyCyclePolicy{Limit: lora_duty_cycle / 100, Window: time.Hour}
 	}
 
-	d_opts.FrequencyMHz = freq
+	if plan.Name != "" {
+		if err := plan.Check(conf); err != nil {
+			log.Printf("error checking the LoRa configuration: %v\n", err)
+			return nil, err
+		}
+		if lora_duty_cycle == 0 {
+			d_opts.DutyCycle = rfm9x.PlanDutyCycle(plan)
+		}
+	}
 
-	radio, err := rfm9x.New(
-		p,
-		&d_opts,
-	)
+	r, err := radio.Open(radioSpec(), d_opts)
 	if err != nil {
-		log.Fatalf("error instantiating the LoRa radio: %v\n", err)
-		return nil, nil, err
+		log.Printf("error instantiating the LoRa radio: %v\n", err)
+		return nil, err
+	}
+	return r, nil
+}
+
+// WatchLoRa has the health of r checked every --lora-health-interval
+// seconds in the background, logging every problem found along with
+// the outcome of the ensuing recovery.
+func WatchLoRa(r radio.Radio) {
+	if lora_health_interval <= 0 {
+		return
+	}
+	p := rfm9x.HealthPolicy{Interval: time.Duration(lora_health_interval) * time.Second}
+	go func() {
+		for ev := range r.Watch(context.Background(), p) {
+			if ev.Err != nil {
+				log.Printf("the LoRa radio looks unhealthy (%v) and couldn't be recovered: %v\n", ev.Problem, ev.Err)
+				continue
+			}
+			log.Printf("the LoRa radio looked unhealthy and was recovered: %v\n", ev.Problem)
+		}
+	}()
+}
+
+// radioSpec returns the spec of the radio to use, which defaults
+// to the RFM9x on --lora-spi-port unless --radio is provided.
+func radioSpec() string {
+	if lora_radio != "" {
+		return lora_radio
+	}
+	if soc == "opi" {
+		return fmt.Sprintf("rfm9x:%s?reset=sysfs:%d", lora_spi_port, sysfsPin)
 	}
-	return radio, p, nil
+	return "rfm9x:" + lora_spi_port
+}
+
+func GetReliableCli(r radio.Radio) *reliable.Datagram {
+	rd := reliable.New(r)
+	rd.Retries = lora_retries
+	rd.Timeout = time.Duration(lora_ack_timeout) * time.Millisecond
+	return rd
 }
 
-func SendOverLoRa(r *rfm9x.Dev, id string, data int) error {
+func SendOverLoRa(r *reliable.Datagram, id string, data int) error {
 	dp := DataPoint{Id: id, Data: data}
 
 	log.Printf("sending %#v", dp)
@@ -85,5 +146,13 @@ func SendOverLoRa(r *rfm9x.Dev, id string, data int) error {
 		return err
 	}
 
-	return r.Send(enc_payload)
+	if err := r.SendToWait(context.Background(), lora_destination, enc_payload); err != nil {
+		return err
+	}
+
+	if lora_destination != rfm9x.BroadcastAddress {
+		log.Printf("delivery of %#v acknowledged by %d", dp, lora_destination)
+	}
+
+	return nil
 }
@@ -33,7 +33,22 @@ var (
 
 	lora_enable       bool
 	lora_spi_port     string
-	carrier_frequency int64
+	lora_radio        string
+	carrier_frequency string
+	lora_sf           uint8
+	lora_bw           uint
+	lora_cr           uint8
+	lora_tx_power     uint
+	lora_sync_word    string
+	lora_address      uint8
+	lora_destination  uint8
+	lora_retries      int
+	lora_ack_timeout  int
+	lora_lbt_attempts int
+	lora_lbt_backoff  int
+	lora_duty_cycle   float64
+
+	lora_health_interval int
 
 	param_to_addr map[string]uint16 = map[string]uint16{
 		"v_1": 0, "v_2": 1, "c_1": 2, "c_2": 3,
@@ -57,11 +72,15 @@ var (
 			mb_cli, mb_handler := GetModBusCli(serial_dev)
 			defer mb_handler.Close()
 
-			lora_cli, lora_pc, err := GetLoRaCli(carrier_frequency)
+			lora_cli, err := GetLoRaCli(carrier_frequency)
 			if err != nil {
 				log.Fatalf("error opening the LoRa radio: %v\n", err)
 			}
-			defer lora_pc.Close()
+			defer lora_cli.Close()
+
+			WatchLoRa(lora_cli)
+
+			lora_rel := GetReliableCli(lora_cli)
 
 			hn, _ := os.Hostname()
 
@@ -74,7 +93,7 @@ var (
 					return
 				}
 
-				if err := SendOverLoRa(lora_cli, hn, int(data)); err != nil {
+				if err := SendOverLoRa(lora_rel, hn, int(data)); err != nil {
 					log.Printf("error sending data over LoRa: %v\n", err)
 				}
 			})
@@ -108,5 +127,19 @@ func init() {
 	// Data output over LoRa
 	rootCmd.Flags().BoolVar(&lora_enable, "lora-enable", false, "Whether to enable data reception over LoRa")
 	rootCmd.Flags().StringVar(&lora_spi_port, "lora-spi-port", "/dev/spidev0.1", "SPI address the radio is on")
-	rootCmd.Flags().Int64Var(&carrier_frequency, "lora-freq", 868, "Carrier frequency in MHz")
+	rootCmd.Flags().StringVar(&lora_radio, "radio", "", "Radio to use instead of the RFM9x on --lora-spi-port (e.g. rfm9x:/dev/spidev0.1?reset=GPIO25, sx126x:/dev/spidev0.0?reset=GPIO18&busy=GPIO20 or sim://239.76.82.65:1276?x=0&y=0)")
+	rootCmd.Flags().StringVar(&carrier_frequency, "lora-freq", "868", "Carrier frequency in MHz (e.g. 868.1) or a channel plan and channel number (e.g. EU868:0)")
+	rootCmd.Flags().Uint8Var(&lora_sf, "lora-sf", 7, "Spreading factor [7, 12]")
+	rootCmd.Flags().UintVar(&lora_bw, "lora-bw", 0, "Signal bandwidth in Hz [0 for the channel's own or 125000]")
+	rootCmd.Flags().Uint8Var(&lora_cr, "lora-cr", 5, "Coding rate denominator (i.e. 4/x) [5, 8]")
+	rootCmd.Flags().UintVar(&lora_tx_power, "lora-tx-power", 13, "Transmission power in dBm [5, 23]")
+	rootCmd.Flags().StringVar(&lora_sync_word, "lora-sync-word", "private", "Sync word telling LoRa networks apart: private, public (i.e. LoRaWAN) or a value such as 0x42")
+	rootCmd.Flags().Uint8Var(&lora_address, "lora-address", 255, "Node address of this radio [255 to receive everything]")
+	rootCmd.Flags().Uint8Var(&lora_destination, "lora-destination", 255, "Node address to send data to [255 to broadcast without ACKs]")
+	rootCmd.Flags().IntVar(&lora_retries, "lora-retries", 3, "Retransmissions before giving up on an unacknowledged packet")
+	rootCmd.Flags().IntVar(&lora_ack_timeout, "lora-ack-timeout", 200, "Time to wait for an ACK in ms")
+	rootCmd.Flags().IntVar(&lora_lbt_attempts, "lora-lbt-attempts", 0, "Channel activity checks before giving up on a transmission [0 to disable listen-before-talk]")
+	rootCmd.Flags().IntVar(&lora_lbt_backoff, "lora-lbt-max-backoff", 1000, "Maximum time to back off for when the channel is busy in ms")
+	rootCmd.Flags().Float64Var(&lora_duty_cycle, "lora-duty-cycle", 0, "Maximum percentage of every hour to spend transmitting (e.g. 1 in EU868) [0 for the channel plan's own or no limit]")
+	rootCmd.Flags().IntVar(&lora_health_interval, "lora-health-interval", 60, "Time between checks of the radio's health in s, resetting it if unhealthy [0 to disable them]")
 }
@@ -1,21 +1,24 @@
-module module github.com/ulbios/lora/mb-server
+module github.com/ulbios/lora/mb-server
 
 go 1.17
 
-replace ulbios/rfm9x-driver => /Users/collado/Repos/ulbios/ulbios_lora/driver/rfm9x_driver
+replace github.com/ulbios/lora/sx1276-driver/rpi => ../sx1276-driver/rpi
+
+replace github.com/ulbios/lora/sx1276-driver/sx1276 => ../sx1276-driver/sx1276
 
 require (
 	github.com/goburrow/modbus v0.1.0
 	github.com/goburrow/serial v0.1.0
 	github.com/spf13/cobra v1.4.0
 	github.com/wilkingj/GoModbusServer v0.0.0-20181106112653-9397ee43cc9a
+	github.com/ulbios/lora/sx1276-driver/rpi v0.0.0-00010101000000-000000000000
 	periph.io/x/conn/v3 v3.6.10
 	periph.io/x/host/v3 v3.7.2
-	ulbios/rfm9x-driver v0.0.0-00010101000000-000000000000
 )
 
 require (
 	github.com/TheCount/modbus v0.0.0-20180823092113-392130db12d5 // indirect
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/ulbios/lora/sx1276-driver/sx1276 v0.0.0 // indirect
 )
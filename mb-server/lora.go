@@ -1,15 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
-	"ulbios/rfm9x-driver"
 
 	mbclient "github.com/goburrow/modbus"
-	"periph.io/x/conn/v3/spi/spireg"
-	"periph.io/x/host/v3"
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/radio"
+	"github.com/ulbios/lora/sx1276-driver/rpi/reliable"
 )
 
 var lora_debug = []rfm9x.Log_level{
@@ -20,7 +22,7 @@ var lora_debug = []rfm9x.Log_level{
 	rfm9x.LogLevelRegIO,
 }
 
-func InsertDataLoRa(freq int64) error {
+func InsertDataLoRa(freq string) error {
 	handler := mbclient.NewTCPClientHandler(fmt.Sprintf("%s:%d", mb_bind_addr, mb_bind_port))
 	if err := handler.Connect(); err != nil {
 		return err
@@ -33,47 +35,117 @@ func InsertDataLoRa(freq int64) error {
 
 	log.Printf("LoRa: instantiated ModBus client\n")
 
-	if _, err := host.Init(); err != nil {
-		log.Fatal(err)
+	ch, plan, err := rfm9x.ParseFrequency(freq)
+	if err != nil {
+		log.Fatalf("Error parsing the LoRa frequency %s: %v", freq, err)
 	}
 
-	log.Printf("LoRa: initialised Periph\n")
+	d_opts := rfm9x.DefaultOpts
 
-	p, err := spireg.Open(lora_spi_port)
+	conf := rfm9x.DefaultConfig
+	conf.FrequencyHz = ch.FrequencyHz
+	conf.SpreadingFactor = lora_sf
+	if lora_bw != 0 {
+		conf.BandwidthHz = lora_bw
+	} else if ch.BandwidthHz != 0 {
+		conf.BandwidthHz = ch.BandwidthHz
+	}
+	conf.CodingRate = lora_cr
+	conf.TxPowerDbm = lora_tx_power
+	if conf.SyncWord, err = rfm9x.ParseSyncWord(lora_sync_word); err != nil {
+		log.Fatalf("Error parsing the LoRa sync word %s: %v", lora_sync_word, err)
+	}
+	if plan.Name != "" {
+		if err := plan.Check(conf); err != nil {
+			log.Fatalf("Error checking the LoRa configuration: %v", err)
+		}
+		d_opts.DutyCycle = rfm9x.PlanDutyCycle(plan)
+	}
+	d_opts.Config = &conf
+	d_opts.Logger = rfm9x.NewStdLogger(nil)
+	d_opts.LogLevel = lora_debug[lora_debug_level]
+	d_opts.NodeAddress = lora_address
+
+	spec := lora_radio
+	if spec == "" {
+		spec = "rfm9x:" + lora_spi_port
+	}
+	lora_cli, err := radio.Open(spec, d_opts)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Error opening the LoRa radio %s: %v", spec, err)
 	}
-	defer p.Close()
+	defer lora_cli.Close()
 
-	fmt.Printf("LoRa: correctly opened SPI port %s\n", p)
+	log.Printf("LoRa: opened radio %s\n", spec)
 
-	d_opts := rfm9x.DefaultOpts
-	d_opts.FrequencyMHz = freq
-	d_opts.LogLevel = lora_debug[lora_debug_level]
+	rd := reliable.New(lora_cli)
 
-	radio, err := rfm9x.New(
-		p,
-		&d_opts,
-	)
-	if err != nil {
-		log.Fatalf("Error opening the SPI device: %v", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pkts, errs := lora_cli.Listen(ctx)
+
+	if lora_health_interval > 0 {
+		p := rfm9x.HealthPolicy{
+			Interval:  time.Duration(lora_health_interval) * time.Second,
+			RxSilence: time.Duration(lora_rx_silence) * time.Second,
+		}
+		go func() {
+			for ev := range lora_cli.Watch(ctx, p) {
+				if ev.Err != nil {
+					log.Printf("LoRa: the radio looks unhealthy (%v) and couldn't be recovered: %v\n", ev.Problem, ev.Err)
+					continue
+				}
+				log.Printf("LoRa: the radio looked unhealthy and was recovered: %v\n", ev.Problem)
+			}
+		}()
 	}
 
 	var dp DataPoint
 
 	for {
-		enc_pkt, err := radio.Receive(
-			time.Duration(lora_recv_wait)*time.Millisecond, time.Duration(lora_recv_timeout)*time.Millisecond)
-		if err != nil {
-			log.Printf("LoRa: error receiving data: %v\n", err)
+		var pkt rfm9x.Packet
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				return fmt.Errorf("LoRa: the radio stopped listening")
+			}
+			switch {
+			case errors.Is(err, rfm9x.ErrCRC), errors.Is(err, rfm9x.ErrInvalidHeader),
+				errors.Is(err, rfm9x.ErrEmptyPacket), errors.Is(err, rfm9x.ErrShortPacket):
+				st := lora_cli.Stats()
+				log.Printf("LoRa: discarding a corrupted packet: %v [CRC errors = %d; missing CRCs = %d; bad headers = %d]\n",
+					err, st.CrcErrors, st.MissingCrc, st.HeaderErrors)
+			default:
+				log.Printf("LoRa: error receiving data: %v\n", err)
+			}
+			continue
+		case <-recvTimeout():
+			log.Printf("LoRa: no packet received within %d ms\n", lora_recv_timeout)
+			continue
+		case rx, ok := <-pkts:
+			if !ok {
+				return fmt.Errorf("LoRa: the radio stopped listening")
+			}
+			pkt = rx
+		}
+
+		if ok, err := rd.Accept(ctx, pkt); err != nil {
+			log.Printf("LoRa: error acknowledging packet %v: %v\n", pkt.Header, err)
+		} else if !ok {
 			continue
 		}
-		if len(enc_pkt) < 5 {
-			log.Printf("LoRa: the received packet is too short: %v (len %d)\n", enc_pkt, len(enc_pkt))
+
+		log.Printf("LoRa: link quality -> RSSI = %d dBm; SNR = %.2f dB; frequency error = %d Hz\n",
+			pkt.RssiDBm, pkt.SnrDB, pkt.FreqErrorHz)
+
+		enc_pkt := pkt.Payload
+		if len(enc_pkt) == 0 {
+			log.Printf("LoRa: the received packet %v carries no data\n", pkt.Header)
 			continue
 		}
-		if err := json.Unmarshal(enc_pkt[4:], &dp); err != nil {
-			log.Printf("LoRa: error unmarshalling data: %v [%s]\n", err, enc_pkt[4:])
+		if err := json.Unmarshal(enc_pkt, &dp); err != nil {
+			log.Printf("LoRa: error unmarshalling data: %v [%s]\n", err, enc_pkt)
 			continue
 		}
 
@@ -99,3 +171,12 @@ func InsertDataLoRa(freq int64) error {
 		log.Printf("LoRa: sent data to ModBus server @ %d\n", addr)
 	}
 }
+
+// recvTimeout returns a channel firing after lora_recv_timeout
+// milliseconds or a nil channel, which never fires, if it's 0.
+func recvTimeout() <-chan time.Time {
+	if lora_recv_timeout == 0 {
+		return nil
+	}
+	return time.After(time.Duration(lora_recv_timeout) * time.Millisecond)
+}
@@ -36,10 +36,20 @@ var (
 
 	lora_enable       bool
 	lora_spi_port     string
-	carrier_frequency int64
+	lora_radio        string
+	carrier_frequency string
+	lora_sf           uint8
+	lora_bw           uint
+	lora_cr           uint8
+	lora_tx_power     uint
+	lora_sync_word    string
 	lora_debug_level  int64
 	lora_recv_wait    int64
 	lora_recv_timeout int64
+	lora_address      uint8
+
+	lora_health_interval int
+	lora_rx_silence      int
 
 	id_to_mb_addr map[string]uint16 = map[string]uint16{}
 
@@ -124,8 +134,18 @@ func init() {
 	// Data input over LoRa
 	rootCmd.Flags().BoolVar(&lora_enable, "lora-enable", false, "Whether to enable data reception over LoRa")
 	rootCmd.Flags().StringVar(&lora_spi_port, "lora-spi-port", "/dev/spidev0.1", "SPI address the radio is on")
-	rootCmd.Flags().Int64Var(&carrier_frequency, "lora-freq", 868, "Carrier frequency in MHz")
+	rootCmd.Flags().StringVar(&lora_radio, "radio", "", "Radio to use instead of the RFM9x on --lora-spi-port (e.g. rfm9x:/dev/spidev0.1?reset=GPIO25, sx126x:/dev/spidev0.0?reset=GPIO18&busy=GPIO20 or sim://239.76.82.65:1276?x=0&y=0)")
+	rootCmd.Flags().StringVar(&carrier_frequency, "lora-freq", "868", "Carrier frequency in MHz (e.g. 868.1) or a channel plan and channel number (e.g. EU868:0)")
+	rootCmd.Flags().Uint8Var(&lora_sf, "lora-sf", 7, "Spreading factor [7, 12]")
+	rootCmd.Flags().UintVar(&lora_bw, "lora-bw", 0, "Signal bandwidth in Hz [0 for the channel's own or 125000]")
+	rootCmd.Flags().Uint8Var(&lora_cr, "lora-cr", 5, "Coding rate denominator (i.e. 4/x) [5, 8]")
+	rootCmd.Flags().UintVar(&lora_tx_power, "lora-tx-power", 13, "Transmission power in dBm [5, 23]")
+	rootCmd.Flags().StringVar(&lora_sync_word, "lora-sync-word", "private", "Sync word telling LoRa networks apart: private, public (i.e. LoRaWAN) or a value such as 0x42")
+	rootCmd.Flags().Uint8Var(&lora_address, "lora-address", 255, "Node address of this radio [255 to receive everything]")
 	rootCmd.Flags().Int64Var(&lora_debug_level, "lora-dbg", 2, "Debug level from 0 to 5, being 4 the most verbose.")
 	rootCmd.Flags().Int64Var(&lora_recv_wait, "lora-wait", 500, "Time to wait on reception in ms.")
+	rootCmd.Flags().MarkDeprecated("lora-wait", "the radio's IRQ flags are now checked continuously")
 	rootCmd.Flags().Int64Var(&lora_recv_timeout, "lora-timeout", 0, "Reception timeout in ms. To wait forever specify 0.")
+	rootCmd.Flags().IntVar(&lora_health_interval, "lora-health-interval", 60, "Time between checks of the radio's health in s, resetting it if unhealthy [0 to disable them]")
+	rootCmd.Flags().IntVar(&lora_rx_silence, "lora-rx-silence", 0, "Time without receiving packets after which the radio is reset in s [0 to never reset it on that account]")
 }
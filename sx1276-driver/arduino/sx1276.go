@@ -3,6 +3,8 @@ package arduino
 import (
 	"machine"
 	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
 )
 
 // Opts defines configurable options for the device.
@@ -30,6 +32,11 @@ type Opts struct {
 	// provided in MegaHertz (i.e. MHz).
 	FrequencyMHz int64
 
+	// FrequencyHz specifies the carrier frequency in Hz, which
+	// makes it possible to use channels such as 868.1 MHz.
+	// When provided, it takes precedence over FrequencyMHz.
+	FrequencyHz uint
+
 	// PreambleLength specifies the size of the preamble to be included
 	// on LoRa packets by the radio. This preamble aides in the
 	// synchronization of sender and receiver and should be
@@ -54,6 +61,36 @@ type Opts struct {
 	CodingRate      byte
 	SpreadingFactor byte
 	TxPowerDbm      uint
+
+	// SyncWord specifies the LoRa sync word, which must match
+	// the one of the radios we talk to. Leave it as 0 to use
+	// sx1276.SyncWordPrivate, the one LoRa radios ship with.
+	SyncWord byte
+
+	// Logger receives the messages the device logs, tagged with
+	// a "device" field holding Name if provided. Leave it as nil
+	// to discard them, or use sx1276.PrintLogger to print them
+	// on the serial console.
+	Logger sx1276.Logger
+
+	// Name tells the device apart from others in its log messages.
+	Name string
+}
+
+// frequencyHz returns the carrier frequency in o in Hz.
+func (o *Opts) frequencyHz() uint {
+	if o.FrequencyHz != 0 {
+		return o.FrequencyHz
+	}
+	return uint(o.FrequencyMHz) * 1000000
+}
+
+// syncWord returns the LoRa sync word in o.
+func (o *Opts) syncWord() byte {
+	if o.SyncWord != 0 {
+		return o.SyncWord
+	}
+	return sx1276.SyncWordPrivate
 }
 
 // DefaultOpts are the recommended options for the radio.
@@ -75,35 +112,13 @@ var DefaultOpts = Opts{
 
 // Dev represents an RFM9x radio
 type Dev struct {
-	// s is the SPI instance representing the interface.
-	s machine.SPI
-
-	// rWBuff is used as the backing information source
-	// and destination on SPI transactions.
-	rWBuff []byte
-
-	slaveSelectPin machine.Pin
-
-	// resetPin specifies the GPIO pin physically connected
-	// to the chip's reset pin.
-	resetPin machine.Pin
-
-	// frequencyMHz specifies the radio's carrier frequency.
-	frequencyMHz int64
-
-	// preambleLength specifies the length of
-	// the preamble on generated and received packets.
-	preambleLength uint
+	// Radio is the hardware-independent core driving
+	// the chip. Its configuration getters and setters
+	// are available straight from the device.
+	*sx1276.Radio
 
-	// highPower specifies whether we're using large
-	// output powers.
-	highPower bool
-
-	// agc specifies whether Automatic Gain Control is enabled.
-	agc bool
-
-	// crc specifies whether Cyclic Redundancy Checks are enabled.
-	crc bool
+	// log receives the messages the device logs.
+	log sx1276.Logger
 }
 
 // New initialises and returns a reference to a new RFM9x radio.
@@ -114,78 +129,80 @@ type Dev struct {
 // If errors are encountered during initialisation, an empty
 // reference along with an error is returned.
 func New(o *Opts) (*Dev, error) {
+	log := o.Logger
+	if log == nil {
+		log = sx1276.NopLogger
+	}
+	if o.Name != "" {
+		log = sx1276.With(log, "device", o.Name)
+	}
+
 	s := machine.SPI0
 	if err := s.Configure(
 		machine.SPIConfig{Frequency: o.Baudrate, LSBFirst: o.LittleEndian, Mode: o.Mode}); err != nil {
-		println("error configuring the SPI port:", err)
+		log.Log(sx1276.LogLevelWarn, "couldn't configure the SPI port", "err", err)
 	}
 
 	o.ResetPin.Configure(machine.PinConfig{Mode: machine.PinOutput})
 
-	dev := &Dev{
+	bus := &spiBus{
 		s:              s,
 		rWBuff:         make([]byte, 4),
 		resetPin:       o.ResetPin,
 		slaveSelectPin: machine.D10,
-		frequencyMHz:   o.FrequencyMHz,
-		preambleLength: o.PreambleLength,
-		highPower:      o.HighPower,
-		agc:            o.Agc,
-		crc:            o.Crc,
 	}
 
+	dev := &Dev{Radio: sx1276.New(bus), log: log}
+
 	dev.Reset()
 	if v, err := dev.Version(); v != 18 || err != nil {
-		println("Wrong radio version detected!", v, err)
+		log.Log(sx1276.LogLevelWarn, "wrong radio version detected", "version", v, "err", err)
 	}
 
-	dev.SetMode(OpModeSleep)
+	dev.SetMode(sx1276.OpModeSleep)
 	time.Sleep(10 * time.Millisecond)
-	println("Current operating mode: ", OpModeText(dev.Mode()))
 
 	dev.SetLoRa(true)
-	println("LoRa mode enabled? ", dev.LoRa())
-
-	if o.FrequencyMHz > 525 {
-		dev.SetLowFreqMode(false)
-		println("Low frequency mode enabled? ", dev.LowFreqMode())
-	}
 
 	dev.SetFifoBaseAddrs(0x0, 0x0)
-	dev.SetCarrierFrequencyMHz(o.FrequencyMHz)
-	dev.SetPreambleLength(uint16(o.PreambleLength))
-	dev.SetBwHz(o.BandwidthKHz)
-	dev.SetCodingRate(o.CodingRate)
-	dev.SetSpreadingFactor(o.SpreadingFactor)
-	dev.SetCrc(o.Crc)
-	dev.SetAgc(o.Agc)
-	dev.SetTxPower(o.TxPowerDbm)
-	dev.SetMode(OpModeStandby)
-
-	txB, rxB := dev.FifoBaseAddrs()
-	println("FiFo base addresses -> Tx = ", txB, " Rx = ", rxB)
-
-	mFreq, _ := dev.CarrierFrequencyMHz()
-	println("Current modulating frequency: ", mFreq, " MHz")
-
-	preL, _ := dev.PreambleLength()
-	println("Current preamble length frequency: ", preL, " bytes")
-
-	bwHz, _ := dev.BwHz()
-	println("Current bandwidth: ", bwHz, " Hz")
-
-	cR, _ := dev.CodingRate()
-	println("Current coding rate: ", cR)
-
-	sF, _ := dev.SpreadingFactor()
-	println("Current spreading factor:", sF)
-	println("CRC enabled? ", dev.Crc())
-	println("AGC enabled? ", dev.Agc())
-
-	txPow, _ := dev.TxPower()
-	println("Current TX power: ", txPow, " dBm")
-	time.Sleep(10 * time.Millisecond)
-	println("Current operating mode: ", OpModeText(dev.Mode()))
+
+	conf := sx1276.Config{
+		FrequencyHz:     o.frequencyHz(),
+		PreambleLength:  uint16(o.PreambleLength),
+		BandwidthHz:     o.BandwidthKHz,
+		CodingRate:      o.CodingRate,
+		SpreadingFactor: o.SpreadingFactor,
+		HighPower:       o.HighPower,
+		TxPowerDbm:      o.TxPowerDbm,
+		SyncWord:        o.syncWord(),
+		Crc:             o.Crc,
+		Agc:             o.Agc,
+		SymbolTimeout:   sx1276.DefaultConfig.SymbolTimeout,
+	}
+	if err := dev.ApplyConfig(conf); err != nil {
+		return nil, err
+	}
+	dev.SetMode(sx1276.OpModeStandby)
+
+	// Reading the configuration back takes a few SPI
+	// transactions, which we spare if nobody listens.
+	if log != sx1276.NopLogger {
+		txB, rxB, _ := dev.FifoBaseAddrs()
+		mFreq, _ := dev.CarrierFrequencyHz()
+		preL, _ := dev.PreambleLength()
+		bwHz, _ := dev.BwHz()
+		cR, _ := dev.CodingRate()
+		sF, _ := dev.SpreadingFactor()
+		sW, _ := dev.SyncWord()
+		txPow, _ := dev.TxPower()
+		log.Log(sx1276.LogLevelDebug, "configured the radio",
+			"fifo_tx_base", txB, "fifo_rx_base", rxB,
+			"frequency_hz", mFreq, "low_freq", dev.LowFreqMode(),
+			"preamble", preL, "bandwidth_hz", bwHz, "coding_rate", cR, "sf", sF,
+			"ldro", dev.LowDataRateOptimize(), "sync_word", sW,
+			"crc", dev.Crc(), "agc", dev.Agc(), "tx_power_dbm", txPow,
+			"mode", sx1276.OpModeText(dev.Mode()))
+	}
 
 	return dev, nil
 }
@@ -196,22 +213,9 @@ func New(o *Opts) (*Dev, error) {
 // by reading back the value of a register with
 // a well known default value.
 func (d *Dev) Reset() {
-	// d.resetPin.High()
-	d.resetPin.Low()
-	time.Sleep(100 * time.Millisecond)
-	d.resetPin.High()
-	time.Sleep(100 * time.Millisecond)
-
-	if mode, _ := d.readRegister(RegOpMode, 3, 0); mode != 0x1 {
-		println("Looks like the RESET didn't work as planned: current Op Mode is ", mode)
+	if err := d.Radio.Reset(); err != nil {
+		d.log.Log(sx1276.LogLevelWarn, "the reset didn't work as planned", "err", err)
 	} else {
-		println("The RESET looks good!")
+		d.log.Log(sx1276.LogLevelDebug, "the reset looks good")
 	}
 }
-
-// Version returns the chips version number
-// along with any errors raised by the
-// SPI transaction.
-func (d *Dev) Version() (byte, error) {
-	return d.readByte(RegVersion)
-}
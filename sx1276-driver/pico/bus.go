@@ -0,0 +1,97 @@
+package pico
+
+import (
+	"machine"
+	"time"
+)
+
+// spiBus implements sx1276.RegisterBus on top of TinyGo's
+// machine.SPI, driving the slave select line by hand.
+type spiBus struct {
+	// s is the SPI instance representing the interface.
+	s machine.SPI
+
+	slaveSelectPin machine.Pin
+
+	// resetPin specifies the GPIO pin physically connected
+	// to the chip's reset pin.
+	resetPin machine.Pin
+
+	// rWBuff is used as the backing information source
+	// and destination on SPI transactions.
+	rWBuff []byte
+}
+
+// Read retrieves a byte located at the provided
+// addr over a SPI connection.
+// It returns the read data and any errors raised by the
+// SPI transaction.
+func (b *spiBus) Read(addr byte) (byte, error) {
+	b.rWBuff[0] = addr & 0x7F
+	b.slaveSelectPin.Low()
+	defer b.slaveSelectPin.High()
+	if err := b.s.Tx(b.rWBuff[:2], b.rWBuff[:2]); err != nil {
+		return 0xFF, err
+	}
+	return b.rWBuff[1], nil
+}
+
+// Write writes the specified data at the provided addr
+// over a SPI connection.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) Write(addr, data byte) error {
+	b.rWBuff[0] = (addr | 0x80) & 0xFF
+	b.rWBuff[1] = data & 0xFF
+	b.slaveSelectPin.Low()
+	defer b.slaveSelectPin.High()
+	return b.s.Tx(b.rWBuff[:2], nil)
+}
+
+// WriteBurst writes a stream of bytes (i.e. data) at the
+// provided addr keeping the SS line low instead of toggling
+// it back and forth. Bytes are shifted out one at a time so
+// that no buffer needs to be allocated.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) WriteBurst(addr byte, data []byte) error {
+	b.slaveSelectPin.Low()
+	defer b.slaveSelectPin.High()
+	if _, err := b.s.Transfer((addr | 0x80) & 0xFF); err != nil {
+		return err
+	}
+	for _, c := range data {
+		if _, err := b.s.Transfer(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBurst fills data with a stream of bytes read from the
+// provided addr. Just like with WriteBurst, the SS line is
+// kept low throughout.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) ReadBurst(addr byte, data []byte) error {
+	b.slaveSelectPin.Low()
+	defer b.slaveSelectPin.High()
+	if _, err := b.s.Transfer(addr & 0x7F); err != nil {
+		return err
+	}
+	for i := range data {
+		c, err := b.s.Transfer(0x0)
+		if err != nil {
+			return err
+		}
+		data[i] = c
+	}
+	return nil
+}
+
+// Reset pulses the chip's reset pin and waits
+// for it to come back up.
+func (b *spiBus) Reset() error {
+	b.resetPin.Low()
+	time.Sleep(100 * time.Millisecond)
+	b.resetPin.High()
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
@@ -1,3 +1,7 @@
 module github.com/ulbios/lora/sx1276-driver/pico
 
 go 1.19
+
+require github.com/ulbios/lora/sx1276-driver/sx1276 v0.0.0
+
+replace github.com/ulbios/lora/sx1276-driver/sx1276 => ../sx1276
@@ -0,0 +1,136 @@
+package rfm9x
+
+import (
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// spiBus implements sx1276.RegisterBus on top of a periph SPI
+// connection, shadowing the configuration registers if asked to.
+type spiBus struct {
+	// cnx is the SPI connection with the chip itself.
+	cnx spi.Conn
+
+	// resetPin specifies the GPIO pin physically connected
+	// to the chip's reset pin.
+	resetPin gpio.PinIO
+
+	// rWBuff is used as the backing information source
+	// and destination on SPI transactions.
+	rWBuff [4]byte
+
+	// burstBuff backs burst accesses to the FIFO so that
+	// they can be carried out in a single SPI transaction
+	// without allocating. It can hold the address byte
+	// plus the whole FIFO.
+	burstBuff [257]byte
+
+	// cache shadows the configuration registers. It's nil
+	// when register caching is disabled.
+	cache *regCache
+
+	// log is the logger of the device driving the bus.
+	log *dev_logger
+}
+
+// Read retrieves a byte located at the provided
+// addr over a SPI connection unless it's been cached.
+// It returns the read data and any errors raised by the
+// SPI transaction.
+func (b *spiBus) Read(addr byte) (byte, error) {
+	if data, ok := b.cached(addr); ok {
+		return data, nil
+	}
+	b.rWBuff[0] = addr & 0x7F
+	if err := b.cnx.Tx(b.rWBuff[:2], b.rWBuff[:2]); err != nil {
+		return 0xFF, err
+	}
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("read register", "addr", addr, "value", b.rWBuff[1])
+	}
+	b.shadow(addr, b.rWBuff[1])
+	return b.rWBuff[1], nil
+}
+
+// Write writes the specified data at the provided addr
+// over a SPI connection. Writes leaving a cached register
+// untouched are skipped and those issued during a batch are
+// held back until it's flushed.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) Write(addr, data byte) error {
+	if c_data, ok := b.cached(addr); ok && c_data == data {
+		return nil
+	}
+	if b.shadow(addr, data) {
+		return nil
+	}
+	b.rWBuff[0] = (addr | 0x80) & 0xFF
+	b.rWBuff[1] = data & 0xFF
+	if err := b.cnx.Tx(b.rWBuff[:2], b.rWBuff[:2]); err != nil {
+		return err
+	}
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("wrote register", "addr", addr, "value", data)
+	}
+	return nil
+}
+
+// WriteBurst writes a stream of bytes (i.e. data) at the
+// provided addr in a single SPI transaction. This permits
+// keeping the SS line low instead of toggling it back and forth.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) WriteBurst(addr byte, data []byte) error {
+	buff := b.burstBuff[:len(data)+1]
+	buff[0] = (addr | 0x80) & 0xFF
+	copy(buff[1:], data)
+	if err := b.cnx.Tx(buff, buff); err != nil {
+		return err
+	}
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("wrote burst", "addr", addr, "length", len(data))
+	}
+	return nil
+}
+
+// ReadBurst fills data with a stream of bytes read from the
+// provided addr in a single SPI transaction. Just like with
+// WriteBurst, the SS line is kept low throughout.
+// It returns any errors raised by the SPI transaction.
+func (b *spiBus) ReadBurst(addr byte, data []byte) error {
+	buff := b.burstBuff[:len(data)+1]
+	buff[0] = addr & 0x7F
+	for i := range buff[1:] {
+		buff[i+1] = 0x0
+	}
+	if err := b.cnx.Tx(buff, buff); err != nil {
+		return err
+	}
+	copy(data, buff[1:])
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("read burst", "addr", addr, "length", len(data))
+	}
+	return nil
+}
+
+// Reset pulses the chip's reset pin and waits for it to come
+// back up. The cache is invalidated as registers go back to
+// their default values.
+// It returns any errors raised when driving the pin.
+func (b *spiBus) Reset() error {
+	if err := b.resetPin.Out(gpio.High); err != nil {
+		return err
+	}
+	if err := b.resetPin.Out(gpio.Low); err != nil {
+		return err
+	}
+	time.Sleep(100 * time.Microsecond)
+	if err := b.resetPin.Out(gpio.High); err != nil {
+		return err
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	b.invalidate()
+	return nil
+}
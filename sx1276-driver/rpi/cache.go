@@ -0,0 +1,225 @@
+package rfm9x
+
+import "github.com/ulbios/lora/sx1276-driver/sx1276"
+
+// regCache shadows the contents of the configuration registers so
+// that reading them back doesn't cost an SPI transaction. Writes go
+// through to the chip unless a batch is in progress, in which case
+// they're held back until the batch is flushed. As the LoRa and
+// FSK/OOK modems map different registers onto the banked addresses,
+// those of the FSK/OOK modem are shadowed in the upper half.
+type regCache struct {
+	// val holds the last known value of each register.
+	val [0x100]byte
+
+	// valid specifies whether the value in val can be trusted.
+	valid [0x100]bool
+
+	// dirty specifies whether the value in val is still
+	// to be written to the chip as part of a batch.
+	dirty [0x100]bool
+
+	// fsk specifies whether the FSK/OOK modem's registers are
+	// the ones behind the banked addresses, as seen on RegOpMode.
+	fsk bool
+
+	// paged specifies whether fsk can be trusted.
+	paged bool
+
+	// batching specifies whether writes are being held back.
+	batching bool
+}
+
+// Bounds of the addresses whose registers depend on the modem.
+const (
+	bankedStart byte = 0x0D
+	bankedEnd   byte = 0x3F
+)
+
+// cacheableRegs holds the registers whose contents only change
+// when we write them. Those the chip updates on its own, such
+// as RegOpMode, RegIrqFlags, the FIFO pointers or RegLna, whose
+// LnaGain the AGC keeps adjusting, must always be read over SPI.
+// RegVersion isn't shadowed either, as it's hardly ever read.
+var cacheableRegs = map[byte]bool{
+	byte(sx1276.RegFrfMsb):             true,
+	byte(sx1276.RegFrfMid):             true,
+	byte(sx1276.RegFrfLsb):             true,
+	byte(sx1276.RegPaConfig):           true,
+	byte(sx1276.RegPaRamp):             true,
+	byte(sx1276.RegOcp):                true,
+	byte(sx1276.RegFifoTxBaseAddr):     true,
+	byte(sx1276.RegFifoRxBaseAddr):     true,
+	byte(sx1276.RegIrqFlagsMask):       true,
+	byte(sx1276.RegModemConfigA):       true,
+	byte(sx1276.RegModemConfigB):       true,
+	byte(sx1276.RegSymbTimeoutLsb):     true,
+	byte(sx1276.RegPreambleMsb):        true,
+	byte(sx1276.RegPreambleLsb):        true,
+	byte(sx1276.RegPayloadLength):      true,
+	byte(sx1276.RegMaxPayloadLength):   true,
+	byte(sx1276.RegHopPeriod):          true,
+	byte(sx1276.RegModemConfigC):       true,
+	byte(sx1276.RegIfFreq2):            true,
+	byte(sx1276.RegIfFreq1):            true,
+	byte(sx1276.RegDetectionOptimize):  true,
+	byte(sx1276.RegHighBwOptimize1):    true,
+	byte(sx1276.RegDetectionThreshold): true,
+	byte(sx1276.RegSyncWord):           true,
+	byte(sx1276.RegHighBwOptimize2):    true,
+	byte(sx1276.RegDioMappingA):        true,
+	byte(sx1276.RegDioMappingB):        true,
+	byte(sx1276.RegPaDac):              true,
+	byte(sx1276.RegBitrateMsb):         true,
+	byte(sx1276.RegBitrateLsb):         true,
+	byte(sx1276.RegFdevMsb):            true,
+	byte(sx1276.RegFdevLsb):            true,
+	byte(sx1276.RegBitrateFrac):        true,
+}
+
+// cacheableFskRegs holds the banked registers of the FSK/OOK
+// modem whose contents only change when we write them.
+var cacheableFskRegs = map[byte]bool{
+	byte(sx1276.RegRssiConfig):       true,
+	byte(sx1276.RegRxBw):             true,
+	byte(sx1276.RegAfcBw):            true,
+	byte(sx1276.RegPreambleDetect):   true,
+	byte(sx1276.RegFskPreambleMsb):   true,
+	byte(sx1276.RegFskPreambleLsb):   true,
+	byte(sx1276.RegSyncConfig):       true,
+	byte(sx1276.RegSyncValue1):       true,
+	byte(sx1276.RegSyncValue1 + 1):   true,
+	byte(sx1276.RegSyncValue1 + 2):   true,
+	byte(sx1276.RegSyncValue1 + 3):   true,
+	byte(sx1276.RegSyncValue1 + 4):   true,
+	byte(sx1276.RegSyncValue1 + 5):   true,
+	byte(sx1276.RegSyncValue1 + 6):   true,
+	byte(sx1276.RegSyncValue1 + 7):   true,
+	byte(sx1276.RegPacketConfig1):    true,
+	byte(sx1276.RegPacketConfig2):    true,
+	byte(sx1276.RegFskPayloadLength): true,
+	byte(sx1276.RegFifoThresh):       true,
+}
+
+// slot returns where the register at addr is shadowed and whether
+// it's cacheable at all. Banked registers aren't until RegOpMode
+// tells which modem they belong to.
+func (c *regCache) slot(addr byte) (int, bool) {
+	if addr < bankedStart || addr > bankedEnd {
+		return int(addr), cacheableRegs[addr]
+	}
+	if !c.paged {
+		return 0, false
+	}
+	if c.fsk {
+		return 0x80 | int(addr), cacheableFskRegs[addr]
+	}
+	return int(addr), cacheableRegs[addr]
+}
+
+// page keeps track of the modem selected through RegOpMode,
+// whose contents are provided on data.
+func (c *regCache) page(addr, data byte) {
+	if addr == byte(sx1276.RegOpMode) {
+		c.fsk, c.paged = data&0x80 == 0, true
+	}
+}
+
+// cached returns the shadowed value of the register at addr and
+// whether it could be found. It never hits the SPI bus.
+func (b *spiBus) cached(addr byte) (byte, bool) {
+	if b.cache == nil {
+		return 0, false
+	}
+	i, ok := b.cache.slot(addr)
+	if !ok || !b.cache.valid[i] {
+		return 0, false
+	}
+	return b.cache.val[i], true
+}
+
+// shadow records data as the current value of the register at addr.
+// It returns true if the write is to be held back as part of a batch.
+// Writes to RegOpMode switch the banked registers over as needed.
+func (b *spiBus) shadow(addr byte, data byte) bool {
+	if b.cache == nil {
+		return false
+	}
+	b.cache.page(addr, data)
+	i, ok := b.cache.slot(addr)
+	if !ok {
+		return false
+	}
+	b.cache.val[i] = data
+	b.cache.valid[i] = true
+	if b.cache.batching {
+		b.cache.dirty[i] = true
+		return true
+	}
+	return false
+}
+
+// invalidate forgets every shadowed register value.
+func (b *spiBus) invalidate() {
+	if b.cache == nil {
+		return
+	}
+	batching := b.cache.batching
+	*b.cache = regCache{batching: batching}
+}
+
+// InvalidateCache forgets every shadowed register value so that
+// they're read back from the chip on their next access. It should
+// be called whenever the radio's state may have changed behind our
+// back. Reset calls it on its own.
+func (d *Dev) InvalidateCache() {
+	d.bus.invalidate()
+}
+
+// batch runs fn holding back every write to a cacheable register
+// and then writes the registers whose value changed, grouping
+// consecutive ones into a single burst SPI transaction. If fn
+// fails nothing is written and the cache is invalidated instead.
+// When the cache is disabled a temporary one is used for the batch.
+func (b *spiBus) batch(fn func() error) error {
+	if b.cache == nil {
+		b.cache = &regCache{}
+		defer func() { b.cache = nil }()
+	}
+
+	b.cache.batching = true
+	err := fn()
+	b.cache.batching = false
+
+	if err != nil {
+		b.invalidate()
+		return err
+	}
+
+	return b.flush()
+}
+
+// flush writes every dirty register to the chip. Registers with
+// consecutive addresses are written in a single burst transaction
+// relying on the chip's address auto-increment. Batches never
+// switch modems, so the dirty banked registers always belong to
+// the selected one.
+// It returns any errors raised by the underlying SPI transactions.
+func (b *spiBus) flush() error {
+	for start := 0; start < len(b.cache.dirty); start++ {
+		if !b.cache.dirty[start] {
+			continue
+		}
+		end := start
+		for end < len(b.cache.dirty) && b.cache.dirty[end] {
+			b.cache.dirty[end] = false
+			end++
+		}
+		if err := b.WriteBurst(byte(start&0x7F), b.cache.val[start:end]); err != nil {
+			b.invalidate()
+			return err
+		}
+		start = end
+	}
+	return nil
+}
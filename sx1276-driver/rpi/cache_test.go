@@ -0,0 +1,81 @@
+package rfm9x
+
+import (
+	"testing"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// peek reads the register at addr straight from chip, bypassing the cache.
+func peek(t *testing.T, chip *sx1276sim.Chip, addr byte) byte {
+	t.Helper()
+
+	buf := []byte{addr & 0x7F, 0}
+	if err := chip.Tx(buf, buf); err != nil {
+		t.Fatalf("Tx() = %v", err)
+	}
+	return buf[1]
+}
+
+func TestCacheBanks(t *testing.T) {
+	d, chip := newSimDev(t, DefaultOpts, false)
+
+	// Each modem maps a cacheable register of its own onto these.
+	addrs := []byte{
+		byte(sx1276.RegSymbTimeoutLsb),    // RegPreambleDetect
+		byte(sx1276.RegModemConfigC),      // RegFskPreambleLsb
+		byte(sx1276.RegIfFreq1),           // RegPacketConfig1
+		byte(sx1276.RegDetectionOptimize), // RegPacketConfig2
+	}
+	want := map[Modem]byte{ModemLoRa: 0x11, ModemFsk: 0x22}
+
+	for _, m := range []Modem{ModemLoRa, ModemFsk} {
+		if err := d.SetModem(m); err != nil {
+			t.Fatalf("SetModem(%v) = %v", m, err)
+		}
+		for i, addr := range addrs {
+			if err := d.bus.Write(addr, want[m]+byte(i)); err != nil {
+				t.Fatalf("Write(%#02x) = %v", addr, err)
+			}
+		}
+	}
+
+	// The values written to either bank must survive switching back and forth.
+	for _, m := range []Modem{ModemLoRa, ModemFsk, ModemLoRa} {
+		if err := d.SetModem(m); err != nil {
+			t.Fatalf("SetModem(%v) = %v", m, err)
+		}
+		for i, addr := range addrs {
+			got, ok := d.bus.cached(addr)
+			if !ok {
+				t.Errorf("register %#02x of modem %v isn't cached", addr, m)
+			}
+			if got != want[m]+byte(i) {
+				t.Errorf("register %#02x of modem %v is cached as %#02x, want %#02x", addr, m, got, want[m]+byte(i))
+			}
+			if raw := peek(t, chip, addr); raw != got {
+				t.Errorf("register %#02x of modem %v is cached as %#02x, but it's %#02x", addr, m, got, raw)
+			}
+		}
+	}
+
+	// Until RegOpMode tells which modem is selected banked
+	// registers can't be told apart, so they aren't cached.
+	d.InvalidateCache()
+	if _, err := d.bus.Read(addrs[0]); err != nil {
+		t.Fatalf("Read(%#02x) = %v", addrs[0], err)
+	}
+	if _, ok := d.bus.cached(addrs[0]); ok {
+		t.Errorf("register %#02x was cached before knowing the modem", addrs[0])
+	}
+	if _, err := d.bus.Read(byte(sx1276.RegOpMode)); err != nil {
+		t.Fatalf("Read(RegOpMode) = %v", err)
+	}
+	if _, err := d.bus.Read(addrs[0]); err != nil {
+		t.Fatalf("Read(%#02x) = %v", addrs[0], err)
+	}
+	if got, ok := d.bus.cached(addrs[0]); !ok || got != want[ModemLoRa] {
+		t.Errorf("register %#02x is cached as %#02x, %v, want %#02x", addrs[0], got, ok, want[ModemLoRa])
+	}
+}
@@ -0,0 +1,82 @@
+package rfm9x
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// LbtPolicy configures listen-before-talk: before every transmission
+// the channel is sensed through Channel Activity Detection and, while
+// it's busy, we back off for a random interval and try again.
+type LbtPolicy struct {
+	// MaxAttempts is how many times the channel is sensed before
+	// giving up with ErrChannelBusy. Leave it as 0 to disable LBT.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the random interval we
+	// wait for whenever the channel is found to be busy.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultLbtPolicy is a sensible policy for nodes sharing a channel.
+// Note LBT is disabled on DefaultOpts.
+var DefaultLbtPolicy = LbtPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  50 * time.Millisecond,
+	MaxBackoff:  1 * time.Second,
+}
+
+// ChannelActivity performs a Channel Activity Detection and returns
+// whether a LoRa preamble was detected on the channel with the current
+// modem parameters. It gives up once ctx is done, returning the context's
+// error. If the device is listening it's put back in Rx once done,
+// handing any packet being received over to the listener first.
+// It fails with ErrModem unless the LoRa modem is selected.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) ChannelActivity(ctx context.Context) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Modem() != sx1276.ModemLoRa {
+		return false, fmt.Errorf("%w: CAD needs the LoRa modem", ErrModem)
+	}
+	defer d.core.Idle()
+
+	if err := d.core.FinishRx(ctx); err != nil {
+		return false, err
+	}
+	return d.channelActivity(ctx)
+}
+
+// channelActivity implements ChannelActivity from Standby on the
+// first hopping channel, if hopping. The radio is left in Standby,
+// which it enters on its own after a CAD.
+func (d *Dev) channelActivity(ctx context.Context) (bool, error) {
+	if err := d.SetMode(sx1276.OpModeStandby); err != nil {
+		return false, spiError(err)
+	}
+	if err := d.restartHopping(); err != nil {
+		return false, err
+	}
+	if err := d.StartCad(); err != nil {
+		return false, spiError(err)
+	}
+
+	for {
+		flags, err := d.IrqFlags()
+		if err != nil {
+			return false, spiError(err)
+		}
+		if flags&sx1276.IrqCadDone != 0 {
+			return flags&sx1276.IrqCadDetected != 0, nil
+		}
+		if err := d.core.WaitForIrq(ctx, pollInterval); err != nil {
+			d.SetMode(sx1276.OpModeStandby)
+			return false, err
+		}
+	}
+}
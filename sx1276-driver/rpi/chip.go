@@ -0,0 +1,86 @@
+package rfm9x
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// chip is the Transceiver through which the device's Core drives
+// the SX127x. It's kept apart from Dev so that its methods don't
+// end up in the device's API.
+type chip struct {
+	d *Dev
+}
+
+// StartRx fails with ErrModem unless the LoRa modem is selected.
+func (c chip) StartRx() error {
+	if c.d.Modem() != sx1276.ModemLoRa {
+		return fmt.Errorf("%w: listening needs the LoRa modem", ErrModem)
+	}
+	return c.d.startRx(false)
+}
+
+func (c chip) Standby() {
+	c.d.standby()
+}
+
+// PickUp retunes the radio on every hop until a packet arrives.
+func (c chip) PickUp() (Packet, bool, error) {
+	flags, err := c.d.IrqFlags()
+	if err != nil {
+		return Packet{}, false, spiError(err)
+	}
+	if flags&sx1276.IrqRxDone == 0 {
+		return Packet{}, false, c.d.serviceHop(flags)
+	}
+	return c.d.pickUp(flags, nil)
+}
+
+// Receiving checks whether a valid header has been received. In
+// implicit header mode there's no header to flag, so it checks whether
+// the modem has detected a signal instead.
+func (c chip) Receiving() (bool, error) {
+	flags, err := c.d.IrqFlags()
+	if err != nil {
+		return false, spiError(err)
+	}
+	if !c.d.conf.ImplicitHeader {
+		return flags&sx1276.IrqValidHeader != 0, nil
+	}
+
+	stat, err := c.d.ModemStatus()
+	if err != nil {
+		return false, spiError(err)
+	}
+	return stat&sx1276.ModemStatSignalDetected != 0, nil
+}
+
+func (c chip) ChannelActivity(ctx context.Context) (bool, error) {
+	return c.d.channelActivity(ctx)
+}
+
+func (c chip) TimeOnAir(n int) (time.Duration, error) {
+	return c.d.timeOnAir(n)
+}
+
+func (c chip) CheckHealth() error {
+	return c.d.checkHealth()
+}
+
+func (c chip) Recover() error {
+	return c.d.recover()
+}
+
+// IrqPin returns DIO0 unless hopping or using the FSK/OOK modem, in
+// which case the flags are polled every fastPollInterval as neither
+// hops nor the FIFO's level are signalled on DIO0.
+func (c chip) IrqPin() (gpio.PinIO, time.Duration) {
+	if c.d.hopping() || c.d.fsk() {
+		return nil, fastPollInterval
+	}
+	return c.d.dio0Pin, 0
+}
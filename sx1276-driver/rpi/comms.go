@@ -1,112 +1,491 @@
 package rfm9x
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
 )
 
-// TxDone returns a boolean indicating whether the Tx IRQ
-// flag is set or not. If the underlying SPI transcation
-// throws an error we'll default to assuming the Tx ins't
-// finished, thus returning false.
-func (d *Dev) TxDone() bool {
-	tx_flag, err := d.read_register(RegIrqFlags, 1, 3)
-	if err != nil {
-		return false
-	}
-	return tx_flag == 0x1
-}
+var (
+	// ErrTxTimeout is returned when a transmission doesn't
+	// finish before the provided context is done.
+	ErrTxTimeout = errors.New("timeout on transmission")
 
-// RxDone returns a boolean indicating whether the Rx IRQ
-// flag is set or not. If the underlying SPI transcation
-// throws an error we'll default to assuming the Rx ins't
-// finished, thus returning false.
-func (d *Dev) RxDone() bool {
-	rx_flag, err := d.read_register(RegIrqFlags, 1, 6)
-	if err != nil {
-		return false
-	}
-	return rx_flag == 0x1
+	// ErrRxTimeout is returned when no packet is received
+	// before the provided context is done.
+	ErrRxTimeout = errors.New("timeout on reception")
+
+	// ErrEmptyPacket is returned when the radio signals a
+	// reception but the received packet carries no data.
+	ErrEmptyPacket = sx1276.ErrEmptyPacket
+
+	// ErrCRC is returned when the received packet's payload
+	// doesn't match its Cyclic Redundancy Check.
+	ErrCRC = sx1276.ErrCRC
+
+	// ErrShortPacket is returned when the received packet
+	// is too short to hold a RadioHead header.
+	ErrShortPacket = errors.New("received packet is too short")
+
+	// ErrPayloadTooLong is returned when the data to send
+	// doesn't fit in the radio's FIFO.
+	ErrPayloadTooLong = sx1276.ErrPayloadTooLong
+
+	// ErrInvalidHeader is returned when a packet is received
+	// without the radio flagging a valid header.
+	ErrInvalidHeader = sx1276.ErrInvalidHeader
+
+	// ErrPayloadLength is returned when the packet to send doesn't
+	// match the fixed payload length of implicit header mode.
+	ErrPayloadLength = sx1276.ErrPayloadLength
+
+	// ErrChannelBusy is returned when listen-before-talk finds
+	// the channel busy on every attempt.
+	ErrChannelBusy = errors.New("the channel is busy")
+
+	// ErrDutyCycle is returned when a transmission would
+	// exceed the device's duty cycle limit.
+	ErrDutyCycle = errors.New("the duty cycle limit would be exceeded")
+
+	// ErrListening is returned when trying to receive packets
+	// one at a time whilst the device is listening continuously.
+	ErrListening = errors.New("the device is already listening")
+
+	// ErrModem is returned when trying to do something
+	// the selected modem doesn't support.
+	ErrModem = sx1276.ErrModem
+
+	// ErrSPI wraps any error raised by the underlying SPI
+	// transactions so that callers can tell bus problems
+	// apart from radio ones.
+	ErrSPI = errors.New("SPI transaction failed")
+
+	// ErrUnhealthy is returned when the radio isn't as the
+	// device left it, as happens when the chip browns out.
+	ErrUnhealthy = errors.New("the radio is unhealthy")
+)
+
+// spiError wraps err so that it matches ErrSPI.
+func spiError(err error) error {
+	return fmt.Errorf("%w: %v", ErrSPI, err)
 }
 
-// Send transmits the data provided on data. The radio will be
-// transitioned to Tx mode and then returned back to Standby
-// once the transmission is finished. As of now, the call blocks
-// until the transmission finishes, possibly causing a deadlock.
+// Send transmits the data provided on data to the configured
+// destination. The radio will be transitioned to Tx mode and then
+// returned back to Standby once the transmission is finished. The call
+// blocks until the transmission finishes: use SendContext to bound the wait.
 // It returns any errors triggered by the underlying SPI
 // transactions.
 func (d *Dev) Send(data []byte) error {
-	d.SetMode(OpModeStandby)
-	logger.debug("# COMMS # Current operating mode: %s\n", OpModeText(d.Mode()))
+	return d.SendContext(context.Background(), data)
+}
+
+// SendContext transmits the data provided on data just like Send
+// does, but gives up once ctx is done, in which case ErrTxTimeout
+// is returned. The radio is returned to Standby with its IRQ flags
+// cleared on every exit path. Errors raised by the underlying SPI
+// transactions match ErrSPI.
+func (d *Dev) SendContext(ctx context.Context, data []byte) error {
+	return d.SendTo(ctx, d.destination, data)
+}
+
+// SendTo transmits data to the node whose address is to
+// just like SendContext does.
+func (d *Dev) SendTo(ctx context.Context, to byte, data []byte) error {
+	return d.SendHeader(ctx, Header{To: to, ID: d.nextID()}, data)
+}
 
-	d.write_register(RegFifoAddrPtr, 8, 0, 0x0)
-	rh_header := []byte{0xFF, 0xFF, 0x0, 0x0}
-	payload := append(rh_header, data...)
-	d.write_payload(byte(RegFifo), payload)
+// SendHeader transmits data behind the provided RadioHead header
+// just like SendContext does. The header's From field is always
+// overwritten with the device's address, but its ID and Flags
+// are sent as they are, which lets upper layers manage them.
+// If the device is listening it's put back in Rx once done, and a
+// packet being received when called is waited for and handed over
+// to the listener first rather than dropped.
+// When a listen-before-talk policy is configured the channel is
+// sensed first, failing with ErrChannelBusy if it stays busy.
+// Listening carries on whilst backing off from a busy channel.
+// Transmissions exceeding the duty cycle limit fail with
+// ErrDutyCycle, or are held back until they fit if the policy
+// is to delay them.
+// In implicit header mode the header and data must add up to
+// the fixed payload length, failing with ErrPayloadLength if not.
+// The same goes for fixed length packets with the FSK/OOK modem,
+// which never listens before talking.
+func (d *Dev) SendHeader(ctx context.Context, h Header, data []byte) error {
+	if len(data) > MaxPayloadLength {
+		return fmt.Errorf("%w: %d bytes (max. %d)", ErrPayloadTooLong, len(data), MaxPayloadLength)
+	}
 
-	logger.debug("# COMMS # Wrote %v to the FiFo [length = %v]\n", payload, byte(len(payload)))
-	d.write_register(RegPayloadLength, 8, 0, byte(len(payload)))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.core.Idle()
+
+	if err := d.core.FinishRx(ctx); err != nil {
+		if errors.Is(err, ErrSPI) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+	}
+	// The device may change whilst waiting for the channel or
+	// for airtime, so it's only checked once we're clear to send.
+	lbt := d.Modem() == sx1276.ModemLoRa
+	if err := d.core.ClearToSend(ctx, HeaderLength+len(data), lbt); err != nil {
+		return err
+	}
+	if err := d.SetMode(sx1276.OpModeStandby); err != nil {
+		return spiError(err)
+	}
+	h.From = d.address
+	payload := append(h.bytes(), data...)
+	if d.Modem() == sx1276.ModemFsk {
+		return d.sendFsk(ctx, payload)
+	}
 
-	d.SetMode(OpModeTx)
-	d.write_register(RegDioMappingA, 2, 6, 0x1)
-	// time.Sleep(500 * time.Millisecond)
-	// logger.debug("# COMMS # Current operating mode: %s\n", OpModeText(d.Get_mode()))
-	logger.debug("# COMMS # Current operating mode: %s\n", fmt.Sprint(d.read_register(RegOpMode, 8, 0)))
+	if err := d.restartHopping(); err != nil {
+		return err
+	}
+	if err := d.ClearIrqFlags(); err != nil {
+		return spiError(err)
+	}
 
-	for !d.TxDone() {
-		logger.debug("# COMMS # Sending hasn't been ACKd yet...\n")
-		time.Sleep(1 * time.Second)
+	if err := d.WritePacket(payload); err != nil {
+		if errors.Is(err, ErrPayloadLength) {
+			return err
+		}
+		return spiError(err)
 	}
-	logger.debug("# COMMS # Looks like they've ACKd us!\n")
+	d.log.debug("wrote the FIFO", "payload", payload, "length", len(payload), "header", h)
 
-	d.SetMode(OpModeStandby)
+	if err := d.MapDio0(sx1276.Dio0TxDone); err != nil {
+		return spiError(err)
+	}
+	if err := d.SetMode(sx1276.OpModeTx); err != nil {
+		return spiError(err)
+	}
+	if d.log.enabled(LogLevelDebug) {
+		d.log.debug("transmitting", "mode", sx1276.OpModeText(d.Mode()))
+	}
 
-	// Clear IRQs
-	d.write_register(RegIrqFlags, 8, 0, 0xFF)
+	for {
+		flags, err := d.IrqFlags()
+		if err != nil {
+			return spiError(err)
+		}
+		if flags&sx1276.IrqTxDone != 0 {
+			break
+		}
+		if err := d.serviceHop(flags); err != nil {
+			return err
+		}
+		d.log.debug("waiting for TxDone")
+		if err := d.core.WaitForIrq(ctx, pollInterval); err != nil {
+			return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+		}
+	}
+	d.log.debug("the packet is out")
 
 	return nil
 }
 
+// Receive listens for an incoming packet and returns its payload.
+// The radio is transitioned to Rx mode and then returned to Standby
+// once a packet arrives or the timeout expires. Between checks of
+// the RxDone flag we block for wait, or until DIO0 raises if a pin
+// has been configured for it. A timeout of 0 waits forever. With
+// the FSK/OOK modem the flags are polled every millisecond instead,
+// as packets longer than the FIFO must be read out as they arrive.
+// Returned errors can be matched just like those of ReceiveContext.
 func (d *Dev) Receive(wait, timeout time.Duration) ([]byte, error) {
-	logger.debug("# COMMS # Beginning to listen for a packet\n")
-	d.SetMode(OpModeRx)
-
-	var timeWaited time.Duration = 0
-	for !d.RxDone() {
-		time.Sleep(wait)
-		logger.debug("# COMMS # Waiting for another %v...\n", wait)
-		timeWaited += wait
-		if timeout != 0 && timeWaited >= timeout {
-			d.write_register(RegIrqFlags, 8, 0, 0xFF)
-			d.SetMode(OpModeStandby)
-			return nil, fmt.Errorf("timeout on reception")
+	ctx := context.Background()
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	p, err := d.receive(ctx, wait, nil)
+	return p.Payload, err
+}
+
+// ReceiveContext listens for an incoming packet and returns its
+// payload, giving up once ctx is done. The radio is returned to
+// Standby with its IRQ flags cleared on every exit path.
+// Returned errors match ErrRxTimeout, ErrEmptyPacket, ErrShortPacket,
+// ErrInvalidHeader, ErrCRC, ErrListening or ErrSPI. Under CrcPolicyFlag
+// packets with a wrong or missing CRC are returned along with an error
+// matching ErrCRC.
+func (d *Dev) ReceiveContext(ctx context.Context) ([]byte, error) {
+	p, err := d.receive(ctx, pollInterval, nil)
+	return p.Payload, err
+}
+
+// receive implements Receive, ReceiveContext, ReceivePacket and
+// ReceivePacketInto, polling the IRQ flags every wait when no DIO0
+// pin is available. Packets addressed to other nodes are dropped
+// without leaving Rx. If buf isn't nil packets are read into it.
+func (d *Dev) receive(ctx context.Context, wait time.Duration, buf []byte) (Packet, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core.Listening() {
+		return Packet{}, ErrListening
+	}
+
+	defer d.standby()
+
+	d.log.debug("listening for a packet")
+	if d.Modem() == sx1276.ModemFsk {
+		return d.receiveFsk(ctx, buf)
+	}
+	if err := d.startRx(false); err != nil {
+		return Packet{}, err
+	}
+
+	for {
+		flags, err := d.waitForRxDone(ctx, wait)
+		if err != nil {
+			return Packet{}, err
 		}
+
+		p, ok, err := d.pickUp(flags, buf)
+		if !ok && err == nil {
+			continue
+		}
+		return p, err
 	}
+}
 
-	pkt_len, _ := d.read_register(RegRxNbBytes, 8, 0)
-	logger.debug("# COMMS # Received a %d-bit bytes long packet!", pkt_len)
+// ReceiveSingle opens a single reception window lasting for the
+// configured symbol timeout (check Config.SymbolTimeout) and returns
+// the packet received within it along with its link metadata. If a
+// preamble shows up within the window the radio keeps receiving until
+// the packet is over, but never for longer than the longest packet
+// lasts on the air. The window also closes on packets addressed to
+// other nodes. It returns an error matching ErrRxTimeout if no packet
+// for us arrives in time or ctx is done first and ErrModem unless the
+// LoRa modem is selected: other errors are just like those of
+// ReceiveContext.
+func (d *Dev) ReceiveSingle(ctx context.Context) (Packet, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	if pkt_len == 0 {
-		d.write_register(RegIrqFlags, 8, 0, 0xFF)
-		d.SetMode(OpModeStandby)
-		return nil, fmt.Errorf("received an empty packet")
+	if d.core.Listening() {
+		return Packet{}, ErrListening
+	}
+	if d.Modem() != sx1276.ModemLoRa {
+		return Packet{}, fmt.Errorf("%w: Rx single mode needs the LoRa modem", ErrModem)
 	}
 
-	pkt_addr, _ := d.read_register(RegFifoRxCurrentAddr, 8, 0)
-	d.write_register(RegFifoAddrPtr, 8, 0, pkt_addr)
+	defer d.standby()
 
-	pkt := make([]byte, pkt_len)
-	for i := 0; i < int(pkt_len); i++ {
-		b, _ := d.read_register(RegFifo, 8, 0)
-		pkt[i] = b
+	c, err := d.Radio.ReadConfig()
+	if err != nil {
+		return Packet{}, spiError(err)
 	}
+	window := time.Duration(c.SymbolTimeout) * sx1276.SymbolTime(c)
 
-	logger.debug("# COMMS # Received %v from the FiFo [length = %v]\n", pkt, len(pkt))
+	d.log.debug("opening a reception window", "window", window)
+	if err := d.startRx(true); err != nil {
+		return Packet{}, err
+	}
 
-	// Clear IRQs
-	d.write_register(RegIrqFlags, 8, 0, 0xFF)
+	// RxTimeout isn't signalled on DIO0, so we check the flags
+	// once the window is over in case we're waiting on the pin.
+	w_ctx, cancel := context.WithTimeout(ctx, window+pollInterval)
+	defer cancel()
 
-	d.SetMode(OpModeStandby)
+	flags, err := d.waitForRxDone(w_ctx, pollInterval)
+	if err != nil && w_ctx.Err() != nil && ctx.Err() == nil {
+		// A packet might still be on its way, but it
+		// won't last for longer than the longest one.
+		p_ctx, p_cancel := context.WithTimeout(ctx, sx1276.TimeOnAir(c, sx1276.MaxPacketLength)+pollInterval)
+		defer p_cancel()
+		flags, err = d.waitForRxDone(p_ctx, pollInterval)
+	}
+	if err != nil {
+		return Packet{}, err
+	}
 
-	return pkt, nil
+	p, ok, err := d.pickUp(flags, nil)
+	if !ok && err == nil {
+		return Packet{}, fmt.Errorf("%w: the packet was addressed to someone else", ErrRxTimeout)
+	}
+	return p, err
+}
+
+// startRx tunes the radio to the first hopping channel, if
+// hopping, maps DIO0 to RxDone, clears the IRQ flags and
+// transitions the radio to Rx continuous mode, or to Rx
+// single mode if single is set.
+// It returns any errors raised by the underlying SPI transactions.
+func (d *Dev) startRx(single bool) error {
+	if err := d.restartHopping(); err != nil {
+		return err
+	}
+	if err := d.MapDio0(sx1276.Dio0RxDone); err != nil {
+		return spiError(err)
+	}
+	if err := d.ClearIrqFlags(); err != nil {
+		return spiError(err)
+	}
+	mode := sx1276.OpModeRx
+	if single {
+		mode = sx1276.OpModeRxSingle
+	}
+	if err := d.SetMode(mode); err != nil {
+		return spiError(err)
+	}
+	return nil
+}
+
+// pickUp retrieves the packet signalled by flags and clears the IRQ
+// flags so that the next one can be detected whilst staying in Rx.
+// The returned boolean is true if the packet is to be handed to the
+// caller, which includes those flagged under CrcPolicyFlag. Packets
+// addressed to other nodes are dropped without raising any errors.
+// The packet is read into buf unless it's nil.
+func (d *Dev) pickUp(flags byte, buf []byte) (Packet, bool, error) {
+	d.core.Heard()
+	p, err := d.readPacket(flags, buf)
+	if err := d.ClearIrqFlags(); err != nil {
+		return Packet{}, false, spiError(err)
+	}
+	// The next packet starts on the first channel again.
+	if err := d.restartHopping(); err != nil {
+		return Packet{}, false, err
+	}
+	return d.filter(p, err)
+}
+
+// filter decides whether the packet p, picked up with the provided
+// err, is to be handed to the caller just like pickUp does, keeping
+// the reception statistics up to date.
+func (d *Dev) filter(p Packet, err error) (Packet, bool, error) {
+	if err != nil {
+		flagged := errors.Is(err, ErrCRC) && d.crcPolicy == CrcPolicyFlag
+		return p, flagged, err
+	}
+
+	if !d.accepts(p.Header) {
+		atomic.AddUint64(&d.stats.Filtered, 1)
+		d.log.debug("dropping a packet addressed to someone else", "header", p.Header)
+		return Packet{}, false, nil
+	}
+
+	atomic.AddUint64(&d.stats.RxPackets, 1)
+	return p, true, nil
+}
+
+// waitForRxDone blocks until the RxDone IRQ flag is set or
+// ctx is done, polling the flags every wait. It returns the
+// contents of RegIrqFlags at the time the packet arrived.
+// In Rx single mode it gives up as soon as RxTimeout is set.
+func (d *Dev) waitForRxDone(ctx context.Context, wait time.Duration) (byte, error) {
+	for {
+		flags, err := d.IrqFlags()
+		if err != nil {
+			return 0, spiError(err)
+		}
+		if flags&sx1276.IrqRxDone != 0 {
+			return flags, nil
+		}
+		if flags&sx1276.IrqRxTimeout != 0 {
+			return 0, fmt.Errorf("%w: no preamble within the reception window", ErrRxTimeout)
+		}
+		if err := d.serviceHop(flags); err != nil {
+			return 0, err
+		}
+		d.log.debug("waiting for RxDone", "wait", wait)
+		if err := d.core.WaitForIrq(ctx, wait); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrRxTimeout, err)
+		}
+	}
+}
+
+// readPacket retrieves the packet the radio has just
+// received along with its metadata. The IRQ flags read
+// when the reception was detected are provided on flags.
+// The packet is read into buf or into a freshly allocated
+// slice if buf is nil.
+func (d *Dev) readPacket(flags byte, buf []byte) (Packet, error) {
+	p := Packet{Time: time.Now()}
+
+	if err := d.CheckHeader(flags); err != nil {
+		atomic.AddUint64(&d.stats.HeaderErrors, 1)
+		return Packet{}, err
+	}
+
+	crcErr := d.checkCrc(flags)
+	if crcErr != nil && (!errors.Is(crcErr, ErrCRC) || d.crcPolicy == CrcPolicyReject) {
+		return Packet{}, crcErr
+	}
+
+	if err := d.readPacketMeta(&p); err != nil {
+		return Packet{}, spiError(err)
+	}
+
+	pkt, err := d.ReadPacket(buf)
+	switch {
+	case errors.Is(err, ErrEmptyPacket):
+		return Packet{}, err
+	case errors.Is(err, io.ErrShortBuffer):
+		return Packet{}, fmt.Errorf("%w: packet doesn't fit into a %d bytes buffer", io.ErrShortBuffer, len(buf))
+	case err != nil:
+		return Packet{}, spiError(err)
+	}
+
+	// Boxing the arguments allocates even when nothing's logged.
+	if d.log.enabled(LogLevelDebug) {
+		d.log.debug("read the FIFO", "packet", pkt, "length", len(pkt),
+			"rssi_dbm", p.RssiDBm, "snr_db", p.SnrDB, "freq_error_hz", p.FreqErrorHz)
+	}
+
+	if p.Header, p.Payload, err = parseHeader(pkt); err != nil {
+		return Packet{}, err
+	}
+
+	return p, crcErr
+}
+
+// checkCrc inspects the IRQ flags of a received packet along with
+// RegHopChannel to make sure its payload CRC was present and valid.
+// It returns an error matching ErrCRC describing the problem, if any,
+// or one matching ErrSPI if the underlying SPI transaction fails.
+func (d *Dev) checkCrc(flags byte) error {
+	err := d.CheckCrc(flags)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sx1276.ErrMissingCRC):
+		atomic.AddUint64(&d.stats.MissingCrc, 1)
+		d.log.warn("received a packet without a CRC")
+		return err
+	case errors.Is(err, ErrCRC):
+		atomic.AddUint64(&d.stats.CrcErrors, 1)
+		d.log.warn("received a packet with a wrong CRC")
+		return err
+	default:
+		return spiError(err)
+	}
+}
+
+// standby returns the radio to Standby and clears every IRQ flag,
+// tuning it back to the first hopping channel if hopping. It's meant
+// to be deferred so that the radio is left in a known state no
+// matter how a transmission or reception ends.
+func (d *Dev) standby() {
+	if err := d.SetMode(sx1276.OpModeStandby); err != nil {
+		d.log.warn("couldn't return the radio to Standby", "err", err)
+	}
+	if err := d.ClearIrqFlags(); err != nil {
+		d.log.warn("couldn't clear the IRQ flags", "err", err)
+	}
+	if err := d.RestartHopping(); err != nil {
+		d.log.warn("couldn't return to the first hopping channel", "err", err)
+	}
 }
@@ -0,0 +1,140 @@
+package rfm9x
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// newSimDev opens a device with options o over a fresh simulated
+// chip, waiting on its DIO0 pin if dio0 is set. Transmissions are
+// instant so that tests don't wait for their time on air.
+func newSimDev(t *testing.T, o Opts, dio0 bool) (*Dev, *sx1276sim.Chip) {
+	t.Helper()
+
+	chip := sx1276sim.New()
+	chip.Instant = true
+	o.ResetPin = chip.ResetPin()
+	if dio0 {
+		o.DIO0Pin = chip.DIO0()
+	}
+	d, err := New(chip, &o)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return d, chip
+}
+
+// inject hands f to chip as soon as it's in Rx, giving up once ctx is done.
+func inject(ctx context.Context, chip *sx1276sim.Chip, f sx1276sim.Frame) {
+	for !chip.Inject(f) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestReceiveSingleTimeout(t *testing.T) {
+	d, chip := newSimDev(t, DefaultOpts, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		for !chip.InjectTimeout() && ctx.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if _, err := d.ReceiveSingle(ctx); !errors.Is(err, ErrRxTimeout) {
+		t.Fatalf("ReceiveSingle() = %v, want %v", err, ErrRxTimeout)
+	}
+}
+
+func TestReceiveSingleGivesUp(t *testing.T) {
+	o := DefaultOpts
+	d, chip := newSimDev(t, o, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A preamble shows up, but the packet never arrives.
+	go func() {
+		for !chip.InjectPreamble() && ctx.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	c := o.ModemConfig()
+	limit := time.Duration(c.SymbolTimeout)*sx1276.SymbolTime(c) + sx1276.TimeOnAir(c, sx1276.MaxPacketLength) + time.Second
+	start := time.Now()
+	if _, err := d.ReceiveSingle(ctx); !errors.Is(err, ErrRxTimeout) {
+		t.Fatalf("ReceiveSingle() = %v, want %v", err, ErrRxTimeout)
+	}
+	if took := time.Since(start); took > limit {
+		t.Errorf("gave up after %v, want %v at most", took, limit)
+	}
+}
+
+// flagReader counts how many times the IRQ flags are read
+// over the SPI connection with the chip it wraps.
+type flagReader struct {
+	*sx1276sim.Chip
+	reads int64
+}
+
+func (f *flagReader) Connect(fr physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	if _, err := f.Chip.Connect(fr, mode, bits); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *flagReader) Tx(w, r []byte) error {
+	if w[0] == byte(sx1276.RegIrqFlags) {
+		atomic.AddInt64(&f.reads, 1)
+	}
+	return f.Chip.Tx(w, r)
+}
+
+func TestSendWaitsOnDio0(t *testing.T) {
+	chip := sx1276sim.New()
+	port := &flagReader{Chip: chip}
+
+	c := sx1276.DefaultConfig
+	c.SpreadingFactor = 9
+	o := DefaultOpts
+	o.Config = &c
+	o.ResetPin, o.DIO0Pin = chip.ResetPin(), chip.DIO0()
+	d, err := New(port, &o)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	atomic.StoreInt64(&port.reads, 0)
+	start := time.Now()
+	if err := d.Send([]byte("hello")); err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	if err := d.SendContext(ctx, []byte("hello")); err != nil {
+		t.Fatalf("SendContext() = %v", err)
+	}
+	took := time.Since(start)
+
+	// Polling every pollInterval would read them dozens of times.
+	if reads := atomic.LoadInt64(&port.reads); reads > 4 {
+		t.Errorf("read the IRQ flags %d times in %v", reads, took)
+	}
+}
@@ -0,0 +1,117 @@
+package rfm9x
+
+import (
+	"testing"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+func TestBwHz(t *testing.T) {
+	d, _ := newSimDev(t, DefaultOpts, false)
+
+	for _, bw := range append(sx1276.BWID2Hz[:], 500000) {
+		if err := d.SetBwHz(bw); err != nil {
+			t.Fatalf("SetBwHz(%d) = %v", bw, err)
+		}
+		if got, err := d.BwHz(); err != nil || got != bw {
+			t.Errorf("BwHz() = %d, %v after SetBwHz(%d)", got, err, bw)
+		}
+	}
+
+	// Bandwidths in between are rounded up to the next one.
+	for _, tc := range []struct{ bw, want uint }{
+		{100000, 125000},
+		{300000, 500000},
+		{1, 7800},
+	} {
+		if err := d.SetBwHz(tc.bw); err != nil {
+			t.Fatalf("SetBwHz(%d) = %v", tc.bw, err)
+		}
+		if got, _ := d.BwHz(); got != tc.want {
+			t.Errorf("BwHz() = %d after SetBwHz(%d), want %d", got, tc.bw, tc.want)
+		}
+	}
+}
+
+func TestWriteRegister(t *testing.T) {
+	d, _ := newSimDev(t, DefaultOpts, false)
+
+	before, err := d.ReadRegister(sx1276.RegModemConfigA, 8, 0)
+	if err != nil {
+		t.Fatalf("ReadRegister() = %v", err)
+	}
+
+	// Bits beyond size must be ignored rather than spill over.
+	if err := d.WriteRegister(sx1276.RegModemConfigA, 4, 4, 0xF8); err != nil {
+		t.Fatalf("WriteRegister() = %v", err)
+	}
+	after, _ := d.ReadRegister(sx1276.RegModemConfigA, 8, 0)
+	if want := 0x80 | before&0x0F; after != want {
+		t.Errorf("RegModemConfigA = %#02x, want %#02x", after, want)
+	}
+
+	if err := d.WriteRegister(sx1276.RegModemConfigA, 3, 1, 0xFA); err != nil {
+		t.Fatalf("WriteRegister() = %v", err)
+	}
+	if got, _ := d.ReadRegister(sx1276.RegModemConfigA, 3, 1); got != 0x2 {
+		t.Errorf("ReadRegister() = %#x, want 0x2", got)
+	}
+	if got, _ := d.ReadRegister(sx1276.RegModemConfigA, 4, 4); got != 0x8 {
+		t.Errorf("the upper nibble changed to %#x", got)
+	}
+}
+
+func TestTxPower(t *testing.T) {
+	for _, tc := range []struct {
+		high bool
+		pow  uint
+	}{
+		{true, 5},
+		{true, 17},
+		{true, 20},
+		{true, 21},
+		{true, 23},
+		{false, 0},
+		{false, 10},
+		{false, 14},
+	} {
+		conf := DefaultConfig
+		conf.HighPower = tc.high
+		conf.TxPowerDbm = tc.pow
+		o := DefaultOpts
+		o.Config = &conf
+		d, _ := newSimDev(t, o, false)
+
+		if got, err := d.TxPower(); err != nil || uint(got) != tc.pow {
+			t.Errorf("TxPower() = %d, %v with HighPower = %v, want %d", got, err, tc.high, tc.pow)
+		}
+	}
+}
+
+func TestCarrierFrequencyHz(t *testing.T) {
+	d, _ := newSimDev(t, DefaultOpts, false)
+
+	for _, f := range []uint{
+		sx1276.MinFrequencyHz,
+		433175000,
+		868100000,
+		868525000,
+		915000000,
+		sx1276.MaxFrequencyHz,
+	} {
+		if err := d.SetCarrierFrequencyHz(f); err != nil {
+			t.Fatalf("SetCarrierFrequencyHz(%d) = %v", f, err)
+		}
+		got, err := d.CarrierFrequencyHz()
+		if err != nil {
+			t.Fatalf("CarrierFrequencyHz() = %v", err)
+		}
+		if diff := int64(got) - int64(f); diff > sx1276.FStepHz/2 || diff < -sx1276.FStepHz/2 {
+			t.Errorf("CarrierFrequencyHz() = %d after setting %d", got, f)
+		}
+	}
+
+	if err := d.SetCarrierFrequencyHz(sx1276.MaxFrequencyHz + 1); err == nil {
+		t.Errorf("SetCarrierFrequencyHz() accepted a frequency out of range")
+	}
+}
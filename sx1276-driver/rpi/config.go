@@ -0,0 +1,103 @@
+package rfm9x
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Config gathers every LoRa modem parameter of the radio so
+// that emitters and receivers can be configured identically
+// from a single place through ApplyConfig.
+type Config = sx1276.Config
+
+// DefaultConfig holds the modem parameters New configures
+// unless told otherwise.
+var DefaultConfig = sx1276.DefaultConfig
+
+// ApplyConfig validates and then configures every modem parameter
+// in c. Register writes are batched so that only those registers
+// whose value actually changes are written, grouping consecutive
+// ones into a single SPI transaction. If c isn't valid nothing is
+// written at all. The radio should be in Sleep or Standby. In
+// implicit header mode the fixed payload length must leave room
+// for the RadioHead header: the data sent through Send must then
+// be exactly PayloadLength - HeaderLength bytes long.
+// It returns any errors raised by the validation, the setters or
+// the underlying SPI transactions.
+func (d *Dev) ApplyConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.ImplicitHeader && int(c.PayloadLength) < HeaderLength {
+		return fmt.Errorf("the payload length must make room for the %d bytes RadioHead header: %d", HeaderLength, c.PayloadLength)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.bus.batch(func() error { return d.Radio.ApplyConfig(c) }); err != nil {
+		return err
+	}
+	d.conf = c
+	return nil
+}
+
+// The LoRa sync words. Check sx1276.SyncWords
+// for every named sync word.
+const (
+	SyncWordPrivate = sx1276.SyncWordPrivate
+	SyncWordPublic  = sx1276.SyncWordPublic
+)
+
+// ParseSyncWord parses either a sync word's name, such as
+// public, or its value, such as 0x34. Check
+// sx1276.ParseSyncWord for the details.
+func ParseSyncWord(s string) (byte, error) {
+	return sx1276.ParseSyncWord(s)
+}
+
+// ReadConfig reconstructs the live configuration from the radio's
+// registers, which makes it possible to detect drift with respect
+// to the configuration that was applied. Registers are always read
+// from the chip itself, bypassing (and then refreshing) the cache.
+// It returns any errors raised by the underlying SPI transactions.
+func (d *Dev) ReadConfig() (Config, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.InvalidateCache()
+
+	return d.Radio.ReadConfig()
+}
+
+// Channel is a carrier frequency along with
+// the bandwidth it's meant to be used with.
+type Channel = sx1276.Channel
+
+// Plan describes a regional LoRa channel plan.
+// Check sx1276.Plan for the details.
+type Plan = sx1276.Plan
+
+// The regional channel plans. Check sx1276.Plans for
+// every known plan indexed by name.
+var (
+	EU868 = sx1276.EU868
+	EU433 = sx1276.EU433
+	US915 = sx1276.US915
+	AU915 = sx1276.AU915
+)
+
+// ParseFrequency parses either a carrier frequency in MHz, such
+// as 868.1, or a plan's name and channel number, such as EU868:0.
+// Check sx1276.ParseFrequency for the details.
+func ParseFrequency(s string) (Channel, Plan, error) {
+	return sx1276.ParseFrequency(s)
+}
+
+// PlanDutyCycle returns the duty cycle policy enforcing the
+// limit in p, which is disabled if p doesn't restrict it.
+func PlanDutyCycle(p Plan) DutyCyclePolicy {
+	return DutyCyclePolicy{Limit: p.DutyCycle, Window: time.Hour}
+}
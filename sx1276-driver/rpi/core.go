@@ -0,0 +1,538 @@
+package rfm9x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// listenBufferSize is the capacity of the channels returned by Listen.
+const listenBufferSize = 16
+
+// healthBufferSize is the capacity of the channel returned by Watch.
+const healthBufferSize = 4
+
+// Transceiver is the chip-specific half of a driver, which Core drives
+// to provide what every radio does alike: listening, listen-before-talk,
+// duty cycle accounting and the health watchdog. Its methods are called
+// with the lock handed to NewCore held, save for IrqPin, which must be
+// safe to call without it.
+type Transceiver interface {
+	// StartRx clears the IRQ flags and puts the radio in Rx
+	// continuous mode.
+	StartRx() error
+
+	// Standby returns the radio to standby and clears its IRQ
+	// flags, logging rather than returning any errors.
+	Standby()
+
+	// PickUp picks up the packet received whilst in Rx, if any,
+	// just like the drivers' Receive does. The returned boolean is
+	// true only if the packet is to be delivered. If none has been
+	// received it services the radio as needed to keep receiving.
+	PickUp() (Packet, bool, error)
+
+	// Receiving checks whether a packet is on its way whilst in Rx.
+	Receiving() (bool, error)
+
+	// ChannelActivity performs a Channel Activity Detection from
+	// standby, leaving the radio in standby, and returns whether
+	// the channel is busy.
+	ChannelActivity(ctx context.Context) (bool, error)
+
+	// TimeOnAir returns how long it takes to send n bytes of
+	// payload, RadioHead header included.
+	TimeOnAir(n int) (time.Duration, error)
+
+	// CheckHealth and Recover check the radio's health and
+	// recover it just like the drivers' homonymous methods do.
+	CheckHealth() error
+	Recover() error
+
+	// IrqPin returns the pin the IRQs we wait on are signalled on,
+	// or nil if the IRQ flags are to be polled instead, along with
+	// the longest we may go without checking them, if any.
+	IrqPin() (gpio.PinIO, time.Duration)
+}
+
+// CoreOpts configures a Core. Check Opts for the meaning of each field.
+type CoreOpts struct {
+	Lbt       LbtPolicy
+	DutyCycle DutyCyclePolicy
+	Logger    Logger
+	LogLevel  Log_level
+	Name      string
+}
+
+// Core holds the logic shared by the drivers of every radio, which
+// reach their chips through a Transceiver. Unless stated otherwise,
+// its methods must be called with the lock handed to NewCore held.
+type Core struct {
+	// lastRx is when the last packet was received, in nanoseconds
+	// since the epoch. It's accessed atomically, so it comes first
+	// to be 64-bit aligned on 32-bit platforms such as ARM.
+	lastRx int64
+
+	// mu serialises access to the radio between Listen's
+	// goroutine and transmissions issued whilst listening.
+	mu sync.Locker
+
+	// t drives the chip.
+	t Transceiver
+
+	// log is the device's own logger.
+	log *dev_logger
+
+	// listening specifies whether Listen is running.
+	listening bool
+
+	// pending holds the packets picked up on the listener's
+	// behalf before leaving Rx, which it delivers first.
+	pending []pickup
+
+	// lbt configures listen-before-talk.
+	lbt LbtPolicy
+
+	// rnd drives the listen-before-talk backoff.
+	rnd *rand.Rand
+
+	// duty accounts for the airtime spent transmitting.
+	duty *DutyCycle
+}
+
+// pickup is the outcome of picking a packet up, as returned by PickUp.
+type pickup struct {
+	p   Packet
+	ok  bool
+	err error
+}
+
+// NewCore returns the Core of a device driving its chip through t
+// and serialising access to it through mu.
+func NewCore(t Transceiver, mu sync.Locker, o CoreOpts) *Core {
+	return &Core{
+		mu:   mu,
+		t:    t,
+		log:  newLogger(o.Logger, o.LogLevel, o.Name),
+		lbt:  o.Lbt,
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		duty: NewDutyCycle(o.DutyCycle),
+	}
+}
+
+// Listening checks whether Listen is running.
+func (c *Core) Listening() bool {
+	return c.listening
+}
+
+// Listen implements the drivers' Listen. It needn't
+// be called with the lock held.
+func (c *Core) Listen(ctx context.Context) (<-chan Packet, <-chan error) {
+	pkts := make(chan Packet, listenBufferSize)
+	errs := make(chan error, listenBufferSize)
+	go c.listen(ctx, pkts, errs)
+	return pkts, errs
+}
+
+// listen implements Listen's background loop.
+func (c *Core) listen(ctx context.Context, pkts chan<- Packet, errs chan<- error) {
+	defer close(pkts)
+	defer close(errs)
+
+	c.mu.Lock()
+	if c.listening {
+		c.mu.Unlock()
+		errs <- ErrListening
+		return
+	}
+	c.listening = true
+	c.pending = nil
+	err := c.t.StartRx()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.listening = false
+		c.pending = nil
+		c.t.Standby()
+		c.mu.Unlock()
+		c.log.debug("stopped listening")
+	}()
+
+	if err != nil {
+		errs <- err
+		return
+	}
+	c.log.debug("began listening continuously")
+
+	for {
+		p, ok, err := c.poll()
+		if err != nil {
+			select {
+			case errs <- err:
+			default:
+				c.log.warn("dropping a listener error", "err", err)
+			}
+			if errors.Is(err, ErrSPI) {
+				return
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if ok {
+			select {
+			case pkts <- p:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// We're the only ones blocking on the IRQ pin whilst listening.
+		if err := c.waitForIrqOn(ctx, pollInterval, true); err != nil {
+			return
+		}
+	}
+}
+
+// poll checks whether a packet has been received and picks it up
+// if so, handing the ones picked up by FinishRx over first. The
+// returned boolean is true only if a packet is to be delivered.
+func (c *Core) poll() (Packet, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) > 0 {
+		r := c.pending[0]
+		c.pending = c.pending[1:]
+		return r.p, r.ok, r.err
+	}
+	return c.t.PickUp()
+}
+
+// FinishRx makes sure taking a listening radio out of Rx doesn't drop
+// any packet: one already received is picked up and one on its way is
+// waited for, but never for longer than the longest packet lasts on
+// the air. Either way it's queued for the listener. It returns an error
+// matching ErrSPI if an SPI transaction fails or the context's error if
+// ctx is done first.
+func (c *Core) FinishRx(ctx context.Context) error {
+	if !c.listening {
+		return nil
+	}
+
+	w_ctx := ctx
+	for {
+		p, ok, err := c.t.PickUp()
+		if errors.Is(err, ErrSPI) {
+			return err
+		}
+		if ok || err != nil {
+			c.pending = append(c.pending, pickup{p, ok, err})
+			return nil
+		}
+		receiving, err := c.t.Receiving()
+		if err != nil || !receiving {
+			return err
+		}
+
+		if w_ctx == ctx {
+			toa, err := c.t.TimeOnAir(sx1276.MaxPacketLength)
+			if err != nil {
+				return err
+			}
+			var cancel context.CancelFunc
+			w_ctx, cancel = context.WithTimeout(ctx, toa+pollInterval)
+			defer cancel()
+		}
+		c.log.debug("waiting for the packet being received")
+		if err := c.WaitForIrq(w_ctx, pollInterval); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.log.warn("gave up on the packet being received")
+			return nil
+		}
+	}
+}
+
+// Idle returns the radio to Rx if the device is listening or
+// to standby otherwise, clearing every IRQ flag in both cases.
+// It's meant to be deferred once done transmitting or sensing
+// the channel.
+func (c *Core) Idle() {
+	if !c.listening {
+		c.t.Standby()
+		return
+	}
+	if err := c.t.StartRx(); err != nil {
+		c.log.warn("couldn't resume listening", "err", err)
+	}
+}
+
+// ClearToSend blocks until a transmission of n bytes of payload,
+// RadioHead header included, may start. If lbt is set the channel
+// must be clear as per the LbtPolicy, and the transmission must fit
+// within the duty cycle, which it's charged for before returning.
+// If the policy is to delay transmissions, the radio is idled and
+// the lock released whilst waiting for airtime, just like whilst
+// backing off from a busy channel, after which the channel is sensed
+// again. Callers must thus check the device's state once it returns
+// rather than before calling it. It returns ErrChannelBusy if the
+// channel stays busy, an error matching ErrDutyCycle if n bytes don't
+// fit, one matching ErrTxTimeout if ctx is done first or one matching
+// ErrSPI if an SPI transaction fails.
+func (c *Core) ClearToSend(ctx context.Context, n int, lbt bool) error {
+	for {
+		if lbt {
+			if err := c.listenBeforeTalk(ctx); err != nil {
+				return err
+			}
+		}
+
+		toa, err := c.t.TimeOnAir(n)
+		if err != nil {
+			return err
+		}
+		// Charging is what reserves the airtime, so it's never
+		// taken by someone else between checking and charging.
+		used, err := c.duty.Charge(time.Now(), toa)
+		if err == nil {
+			c.log.debug("spending airtime", "time_on_air", toa, "used", used, "window", c.duty.Window())
+			return nil
+		}
+		if !c.duty.Policy().Delay {
+			return err
+		}
+		wait, err := c.duty.Wait(time.Now(), toa)
+		if err != nil {
+			return err
+		}
+
+		c.log.debug("holding the transmission back to honour the duty cycle", "wait", wait)
+		if err := c.release(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// listenBeforeTalk blocks until the channel is clear as per the
+// LbtPolicy, returning straight away if LBT is disabled. Errors are
+// just like those of ClearToSend.
+func (c *Core) listenBeforeTalk(ctx context.Context) error {
+	if c.lbt.MaxAttempts <= 0 {
+		return nil
+	}
+
+	for try := 1; ; try++ {
+		busy, err := c.t.ChannelActivity(ctx)
+		if errors.Is(err, ErrSPI) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+		}
+		if !busy {
+			return nil
+		}
+
+		c.log.debug("the channel is busy", "attempt", try, "max_attempts", c.lbt.MaxAttempts)
+		if try >= c.lbt.MaxAttempts {
+			return fmt.Errorf("%w: gave up after %d attempts", ErrChannelBusy, try)
+		}
+
+		if err := c.release(ctx, c.backoff()); err != nil {
+			return err
+		}
+	}
+}
+
+// release idles the radio and releases the lock for wait so that
+// listeners keep on receiving meanwhile, handing any packet received
+// over to them once it's taken again. It returns an error matching
+// ErrTxTimeout if ctx is done first or one matching ErrSPI if an SPI
+// transaction fails.
+func (c *Core) release(ctx context.Context, wait time.Duration) error {
+	c.Idle()
+	c.mu.Unlock()
+
+	var err error
+	t := time.NewTimer(wait)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		err = fmt.Errorf("%w: %v", ErrTxTimeout, ctx.Err())
+	case <-t.C:
+	}
+
+	c.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if err := c.FinishRx(ctx); err != nil {
+		if errors.Is(err, ErrSPI) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+	}
+	return nil
+}
+
+// backoff returns a random interval within the bounds of the LbtPolicy.
+func (c *Core) backoff() time.Duration {
+	span := c.lbt.MaxBackoff - c.lbt.MinBackoff
+	if span <= 0 {
+		return c.lbt.MinBackoff
+	}
+	return c.lbt.MinBackoff + time.Duration(c.rnd.Int63n(int64(span)+1))
+}
+
+// Airtime returns how long the device has spent transmitting over
+// the duty cycle's window. It needn't be called with the lock held.
+func (c *Core) Airtime() time.Duration {
+	return c.duty.Used(time.Now())
+}
+
+// Watch implements the drivers' Watch. It needn't
+// be called with the lock held.
+func (c *Core) Watch(ctx context.Context, p HealthPolicy) <-chan HealthEvent {
+	events := make(chan HealthEvent, healthBufferSize)
+	go c.watch(ctx, p, events)
+	return events
+}
+
+// watch implements Watch's background loop.
+func (c *Core) watch(ctx context.Context, p HealthPolicy, events chan<- HealthEvent) {
+	defer close(events)
+
+	if p.Interval <= 0 {
+		p.Interval = DefaultHealthPolicy.Interval
+	}
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	// Silence is measured from the last packet, but never
+	// from before we started watching or last recovered.
+	since := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		now := time.Now()
+		problem := c.t.CheckHealth()
+		if last := time.Unix(0, atomic.LoadInt64(&c.lastRx)); last.After(since) {
+			since = last
+		}
+		if silence := now.Sub(since); problem == nil && p.RxSilence > 0 && silence > p.RxSilence {
+			problem = fmt.Errorf("%w: no packet received for %v", ErrUnhealthy, silence.Round(time.Millisecond))
+		}
+		if problem == nil {
+			c.mu.Unlock()
+			continue
+		}
+		c.log.warn("the radio looks unhealthy", "problem", problem)
+		ev := HealthEvent{Time: now, Problem: problem, Err: c.t.Recover()}
+		since = time.Now()
+		c.mu.Unlock()
+
+		if ev.Err != nil {
+			c.log.warn("couldn't recover the radio", "err", ev.Err)
+		}
+		select {
+		case events <- ev:
+		default:
+			c.log.warn("dropping a health event", "problem", ev.Problem, "err", ev.Err)
+		}
+	}
+}
+
+// Heard records that a packet has just been received, which
+// Watch relies on to measure silence. It needn't be called
+// with the lock held.
+func (c *Core) Heard() {
+	atomic.StoreInt64(&c.lastRx, time.Now().UnixNano())
+}
+
+// WaitForIrq blocks for at most wait or until ctx is done, in which
+// case the context's error is returned. If the Transceiver has an IRQ
+// pin we instead block on it until a rising edge is detected, ctx's
+// deadline is reached or edgeTimeout elapses, whatever comes first.
+// If ctx is cancelled in the meantime the wait on the pin is halted.
+// Whilst listening the listener alone blocks on the pin, as an edge
+// only wakes one of the goroutines waiting on it up, so we poll the
+// IRQ flags every wait instead.
+func (c *Core) WaitForIrq(ctx context.Context, wait time.Duration) error {
+	return c.waitForIrqOn(ctx, wait, !c.listening)
+}
+
+// waitForIrqOn implements WaitForIrq, blocking on the IRQ
+// pin only if pin is set. It doesn't need the lock.
+func (c *Core) waitForIrqOn(ctx context.Context, wait time.Duration, pin bool) error {
+	irq, max := c.t.IrqPin()
+	use_pin := irq != nil && pin
+	if use_pin {
+		wait = edgeTimeout
+	}
+	if max > 0 && wait > max {
+		wait = max
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+	}
+
+	if use_pin {
+		if wait > 0 && c.waitForEdge(ctx, irq, wait) {
+			c.log.debug("detected an edge on the IRQ pin", "pin", irq)
+		}
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// waitForEdge blocks on irq for at most wait and returns whether
+// a rising edge was detected. As WaitForEdge can't be handed ctx,
+// the pin is halted if ctx is done first. We don't return before
+// WaitForEdge does so that no one else waits on the pin meanwhile.
+func (c *Core) waitForEdge(ctx context.Context, irq gpio.PinIO, wait time.Duration) bool {
+	if ctx.Done() == nil {
+		return irq.WaitForEdge(wait)
+	}
+
+	edge := make(chan bool, 1)
+	go func() {
+		edge <- irq.WaitForEdge(wait)
+	}()
+	select {
+	case got := <-edge:
+		return got
+	case <-ctx.Done():
+		if err := irq.Halt(); err != nil {
+			c.log.warn("couldn't halt the wait on the IRQ pin", "pin", irq, "err", err)
+		}
+		return <-edge
+	}
+}
@@ -0,0 +1,199 @@
+package rfm9x
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// DutyCyclePolicy bounds the fraction of time the device spends
+// transmitting, which regulations such as ETSI EN 300 220 in the
+// EU impose on most sub-bands.
+type DutyCyclePolicy struct {
+	// Limit is the fraction of Window we may spend on the
+	// air, such as 0.01 for 1%. Leave it as 0 to disable it.
+	Limit float64
+
+	// Window is the sliding window airtime is accounted
+	// over. It defaults to an hour when left as 0.
+	Window time.Duration
+
+	// Delay makes transmissions exceeding the limit wait until
+	// enough airtime is available instead of failing straight
+	// away with ErrDutyCycle.
+	Delay bool
+}
+
+// EU868DutyCycle is the 1% limit that applies to sub-band g1
+// (868.0 to 868.6 MHz), where the default EU868 channels live.
+var EU868DutyCycle = PlanDutyCycle(EU868)
+
+// TimeOnAir returns how long it takes to send payloadLen bytes
+// of data with the modem parameters in c. The RadioHead header
+// is accounted for, so payloadLen is just the length of the data
+// handed to Send. Refer to sx1276.TimeOnAir for the details.
+func TimeOnAir(c Config, payloadLen int) time.Duration {
+	return sx1276.TimeOnAir(c, HeaderLength+payloadLen)
+}
+
+// FskTimeOnAir returns how long it takes to send payloadLen bytes
+// of data with the FSK/OOK modem parameters in c, RadioHead header
+// included just like with TimeOnAir.
+func FskTimeOnAir(c FskConfig, payloadLen int) time.Duration {
+	return sx1276.FskTimeOnAir(c, HeaderLength+payloadLen)
+}
+
+// Airtime returns how long the device has spent transmitting
+// over the duty cycle's window, which is an hour by default.
+// It's safe to call it concurrently with Send and Receive.
+func (d *Dev) Airtime() time.Duration {
+	return d.core.Airtime()
+}
+
+// timeOnAir returns how long it takes to send n bytes of payload,
+// RadioHead header included, with the selected modem. Errors raised
+// by the underlying SPI transactions match ErrSPI. The device's lock
+// must be held.
+func (d *Dev) timeOnAir(n int) (time.Duration, error) {
+	if d.Modem() == sx1276.ModemFsk {
+		c, err := d.Radio.ReadFskConfig()
+		if err != nil {
+			return 0, spiError(err)
+		}
+		return sx1276.FskTimeOnAir(c, n), nil
+	}
+
+	c, err := d.Radio.ReadConfig()
+	if err != nil {
+		return 0, spiError(err)
+	}
+	return sx1276.TimeOnAir(c, n), nil
+}
+
+// airtime is a transmission accounted for by DutyCycle.
+type airtime struct {
+	end time.Time
+	toa time.Duration
+}
+
+// DutyCycle keeps track of the airtime spent over a sliding window
+// to enforce a DutyCyclePolicy. It's safe for concurrent use, which
+// lets the drivers of other radios share the same accounting.
+type DutyCycle struct {
+	policy DutyCyclePolicy
+
+	mu  sync.Mutex
+	txs []airtime
+}
+
+// NewDutyCycle returns a DutyCycle enforcing p
+// which has yet to account for any airtime.
+func NewDutyCycle(p DutyCyclePolicy) *DutyCycle {
+	return &DutyCycle{policy: p}
+}
+
+// Policy returns the policy being enforced.
+func (a *DutyCycle) Policy() DutyCyclePolicy {
+	return a.policy
+}
+
+// Window returns the length of the sliding window.
+func (a *DutyCycle) Window() time.Duration {
+	if a.policy.Window <= 0 {
+		return time.Hour
+	}
+	return a.policy.Window
+}
+
+// budget returns how much airtime fits in the window.
+func (a *DutyCycle) budget() time.Duration {
+	return time.Duration(a.policy.Limit * float64(a.Window()))
+}
+
+// prune forgets the transmissions that are no longer within
+// the window at now. The lock must be held.
+func (a *DutyCycle) prune(now time.Time) {
+	kept := a.txs[:0]
+	for _, tx := range a.txs {
+		if now.Before(tx.end.Add(a.Window())) {
+			kept = append(kept, tx)
+		}
+	}
+	a.txs = kept
+}
+
+// Used returns the airtime spent over the window at now.
+func (a *DutyCycle) Used(now time.Time) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.prune(now)
+	return a.spent()
+}
+
+// spent adds up the airtime of every transmission
+// we keep track of. The lock must be held.
+func (a *DutyCycle) spent() time.Duration {
+	var used time.Duration
+	for _, tx := range a.txs {
+		used += tx.toa
+	}
+	return used
+}
+
+// Wait returns how long from now until a transmission lasting
+// toa fits within the duty cycle. Transmissions are accounted
+// for in full until their end leaves the window. It returns an
+// error matching ErrDutyCycle if toa exceeds the whole budget.
+func (a *DutyCycle) Wait(now time.Time, toa time.Duration) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.wait(now, toa)
+}
+
+// wait implements Wait. The lock must be held.
+func (a *DutyCycle) wait(now time.Time, toa time.Duration) (time.Duration, error) {
+	if a.policy.Limit <= 0 {
+		return 0, nil
+	}
+	if toa > a.budget() {
+		return 0, fmt.Errorf("%w: %v of airtime exceeds the %v budget", ErrDutyCycle, toa, a.budget())
+	}
+
+	a.prune(now)
+	excess := a.spent() + toa - a.budget()
+	for _, tx := range a.txs {
+		if excess <= 0 {
+			break
+		}
+		excess -= tx.toa
+		if excess <= 0 {
+			return tx.end.Add(a.Window()).Sub(now), nil
+		}
+	}
+	return 0, nil
+}
+
+// Charge records a transmission lasting toa starting at now,
+// returning the airtime spent over the window including it.
+// It returns an error matching ErrDutyCycle without recording
+// anything if the transmission doesn't fit within the duty cycle.
+func (a *DutyCycle) Charge(now time.Time, toa time.Duration) (time.Duration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wait, err := a.wait(now, toa)
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return 0, fmt.Errorf("%w: %v of airtime needed, available in %v", ErrDutyCycle, toa, wait.Round(time.Second))
+	}
+
+	a.prune(now)
+	a.txs = append(a.txs, airtime{end: now.Add(toa), toa: toa})
+	return a.spent(), nil
+}
@@ -0,0 +1,86 @@
+package rfm9x
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDutyCycleDisabled(t *testing.T) {
+	a := NewDutyCycle(DutyCyclePolicy{})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.Charge(now, time.Hour); err != nil {
+			t.Fatalf("Charge() = %v without a limit", err)
+		}
+	}
+	if wait, err := a.Wait(now, time.Hour); wait != 0 || err != nil {
+		t.Errorf("Wait() = %v, %v without a limit", wait, err)
+	}
+}
+
+func TestDutyCycle(t *testing.T) {
+	// 1% of an hour leaves a budget of 36 s.
+	a := NewDutyCycle(DutyCyclePolicy{Limit: 0.01, Window: time.Hour})
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	if _, err := a.Wait(t0, 37*time.Second); !errors.Is(err, ErrDutyCycle) {
+		t.Errorf("Wait() = %v for more than the whole budget, want %v", err, ErrDutyCycle)
+	}
+
+	steps := []struct {
+		name   string
+		at     time.Duration
+		toa    time.Duration
+		wait   time.Duration
+		charge bool
+		used   time.Duration
+	}{
+		{name: "first transmission", at: 0, toa: 30 * time.Second, charge: true, used: 30 * time.Second},
+		{name: "over budget", at: time.Second, toa: 10 * time.Second, wait: time.Hour + 29*time.Second},
+		{name: "what's left of the budget", at: time.Second, toa: 6 * time.Second, charge: true, used: 36 * time.Second},
+		{name: "nothing left", at: 2 * time.Minute, toa: time.Millisecond, wait: time.Hour - 90*time.Second},
+		{name: "second one left the window", at: time.Hour + 29*time.Second, toa: 6 * time.Second, charge: true, used: 36 * time.Second},
+		{name: "first one still in the window", at: time.Hour + 29*time.Second, toa: time.Second, wait: time.Second},
+		{name: "first one left the window", at: time.Hour + 30*time.Second, toa: 30 * time.Second, charge: true, used: 36 * time.Second},
+		{name: "every one left the window", at: 3 * time.Hour, toa: 36 * time.Second, charge: true, used: 36 * time.Second},
+	}
+	for _, s := range steps {
+		now := t0.Add(s.at)
+
+		wait, err := a.Wait(now, s.toa)
+		if err != nil || wait != s.wait {
+			t.Fatalf("%s: Wait() = %v, %v, want %v", s.name, wait, err, s.wait)
+		}
+
+		used, err := a.Charge(now, s.toa)
+		if !s.charge {
+			if !errors.Is(err, ErrDutyCycle) {
+				t.Fatalf("%s: Charge() = %v, want %v", s.name, err, ErrDutyCycle)
+			}
+			continue
+		}
+		if err != nil || used != s.used {
+			t.Fatalf("%s: Charge() = %v, %v, want %v", s.name, used, err, s.used)
+		}
+		if got := a.Used(now); got != s.used {
+			t.Errorf("%s: Used() = %v, want %v", s.name, got, s.used)
+		}
+	}
+}
+
+func TestDutyCycleDefaultWindow(t *testing.T) {
+	a := NewDutyCycle(DutyCyclePolicy{Limit: 0.1})
+	if w := a.Window(); w != time.Hour {
+		t.Errorf("Window() = %v, want an hour", w)
+	}
+
+	now := time.Now()
+	if _, err := a.Charge(now, 6*time.Minute); err != nil {
+		t.Fatalf("Charge() = %v", err)
+	}
+	if used := a.Used(now.Add(time.Hour + 6*time.Minute)); used != 0 {
+		t.Errorf("Used() = %v once the window is over, want 0", used)
+	}
+}
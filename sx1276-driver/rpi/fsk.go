@@ -0,0 +1,237 @@
+package rfm9x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Modem identifies the modems the radio can switch between.
+type Modem = sx1276.Modem
+
+// The modems the radio can switch between.
+const (
+	ModemLoRa = sx1276.ModemLoRa
+	ModemFsk  = sx1276.ModemFsk
+)
+
+// FskConfig gathers every FSK/OOK modem parameter of the radio.
+// Check sx1276.FskConfig for the details.
+type FskConfig = sx1276.FskConfig
+
+// DefaultFskConfig holds the FSK/OOK modem parameters New
+// configures unless told otherwise.
+var DefaultFskConfig = sx1276.DefaultFskConfig
+
+// SetModem switches the device over to modem m, leaving the radio in
+// Standby tuned to the carrier frequency that modem was last given.
+// Send and Receive, along with their variants, work with both modems,
+// keeping the RadioHead header, but Listen, ReceiveSingle, channel
+// activity detection and listen-before-talk need the LoRa modem and
+// fail with ErrModem otherwise. It fails with ErrListening whilst
+// listening.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) SetModem(m Modem) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core.Listening() {
+		return ErrListening
+	}
+
+	if err := d.Radio.SetModem(m); err != nil {
+		return spiError(err)
+	}
+	var fsk uint32
+	if m == ModemFsk {
+		fsk = 1
+	}
+	atomic.StoreUint32(&d.fskOn, fsk)
+
+	if err := d.SetMode(sx1276.OpModeStandby); err != nil {
+		return spiError(err)
+	}
+	d.log.debug("switched modems", "modem", m)
+	return nil
+}
+
+// fsk checks whether the FSK/OOK modem is selected.
+// It's safe to call it without holding the device's lock.
+func (d *Dev) fsk() bool {
+	return atomic.LoadUint32(&d.fskOn) != 0
+}
+
+// ApplyFskConfig validates and then configures every FSK/OOK modem
+// parameter in c, batching the register writes just like ApplyConfig
+// does. The FSK/OOK modem must be selected through SetModem, failing
+// with ErrModem otherwise. The PayloadLength must leave room for the
+// RadioHead header: with fixed length packets the data sent through
+// Send must then be exactly PayloadLength - HeaderLength bytes long.
+// It returns any errors raised by the validation or the underlying
+// SPI transactions.
+func (d *Dev) ApplyFskConfig(c FskConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if int(c.PayloadLength) < HeaderLength {
+		return fmt.Errorf("the payload length must make room for the %d bytes RadioHead header: %d", HeaderLength, c.PayloadLength)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.bus.batch(func() error { return d.Radio.ApplyFskConfig(c) }); err != nil {
+		return err
+	}
+	c.SyncWord = append([]byte(nil), c.SyncWord...)
+	d.fskConf = &c
+	return nil
+}
+
+// ReadFskConfig reconstructs the live FSK/OOK configuration from the
+// radio's registers just like ReadConfig does for the LoRa one. The
+// FSK/OOK modem must be selected, failing with ErrModem otherwise.
+// It also returns any errors raised by the underlying SPI transactions.
+func (d *Dev) ReadFskConfig() (FskConfig, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.InvalidateCache()
+
+	return d.Radio.ReadFskConfig()
+}
+
+// sendFsk transmits payload through the FSK/OOK modem, streaming it
+// through the FIFO as it drains if it doesn't fit in one go. The
+// device's lock must be held, the radio must be in Standby and the
+// airtime must have been charged. Errors are just like those of
+// SendHeader.
+func (d *Dev) sendFsk(ctx context.Context, payload []byte) error {
+	rest, err := d.WriteFskPacket(payload)
+	if err != nil {
+		if errors.Is(err, ErrPayloadLength) || errors.Is(err, ErrPayloadTooLong) {
+			return err
+		}
+		return spiError(err)
+	}
+	d.log.debug("wrote the FIFO", "payload", payload, "length", len(payload), "pending", len(rest))
+
+	if err := d.SetMode(sx1276.OpModeTx); err != nil {
+		return spiError(err)
+	}
+
+	for {
+		flags, err := d.FskIrqFlags()
+		if err != nil {
+			return spiError(err)
+		}
+		if flags&sx1276.IrqFskPacketSent != 0 {
+			break
+		}
+		if rest, err = d.FeedFskPacket(rest, flags); err != nil {
+			return spiError(err)
+		}
+		if err := d.core.WaitForIrq(ctx, fastPollInterval); err != nil {
+			return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+		}
+	}
+	d.log.debug("the packet is out")
+
+	return nil
+}
+
+// receiveFsk implements receive for the FSK/OOK modem, which
+// must be selected. The FIFO is polled every fastPollInterval
+// no matter what, as packets longer than it must be read out
+// whilst they're being received.
+func (d *Dev) receiveFsk(ctx context.Context, buf []byte) (Packet, error) {
+	if err := d.ClearFskFifo(); err != nil {
+		return Packet{}, spiError(err)
+	}
+	if err := d.SetMode(sx1276.OpModeRx); err != nil {
+		return Packet{}, spiError(err)
+	}
+
+	for {
+		p, ok, err := d.filter(d.readFskPacket(ctx, buf))
+		if !ok && err == nil {
+			continue
+		}
+		return p, err
+	}
+}
+
+// readFskPacket waits for the next packet to be received by the
+// FSK/OOK modem and reads it, into buf unless it's nil, as it
+// arrives. The radio keeps receiving once it's been read. Errors
+// are just like those of readPacket.
+func (d *Dev) readFskPacket(ctx context.Context, buf []byte) (Packet, error) {
+	var (
+		p     Packet
+		rx    sx1276.FskReception
+		flags byte
+		err   error
+	)
+	if buf != nil {
+		rx.Payload = buf[:0]
+	}
+
+	for {
+		if flags, err = d.FskIrqFlags(); err != nil {
+			return Packet{}, spiError(err)
+		}
+
+		// The RSSI is sampled whilst the packet is coming in.
+		if p.Time.IsZero() && flags&sx1276.IrqFskFifoEmpty == 0 {
+			p.Time = time.Now()
+			if p.RssiDBm, err = d.FskRssi(); err != nil {
+				return Packet{}, spiError(err)
+			}
+		}
+
+		done, err := d.ReadFskPacket(&rx, flags)
+		if err != nil {
+			return Packet{}, spiError(err)
+		}
+		if done {
+			break
+		}
+		if err := d.core.WaitForIrq(ctx, fastPollInterval); err != nil {
+			return Packet{}, fmt.Errorf("%w: %v", ErrRxTimeout, err)
+		}
+	}
+	pkt := rx.Payload
+	d.core.Heard()
+
+	crcErr := d.CheckFskCrc(flags)
+	if crcErr != nil {
+		atomic.AddUint64(&d.stats.CrcErrors, 1)
+		d.log.warn("received a packet with a wrong CRC")
+		if d.crcPolicy == CrcPolicyReject {
+			return Packet{}, crcErr
+		}
+	}
+
+	switch {
+	case len(pkt) == 0:
+		return Packet{}, ErrEmptyPacket
+	case buf != nil && len(pkt) > len(buf):
+		return Packet{}, fmt.Errorf("%w: packet doesn't fit into a %d bytes buffer", io.ErrShortBuffer, len(buf))
+	}
+
+	// Boxing the arguments allocates even when nothing's logged.
+	if d.log.enabled(LogLevelDebug) {
+		d.log.debug("read the FIFO", "packet", pkt, "length", len(pkt), "rssi_dbm", p.RssiDBm)
+	}
+
+	if p.Header, p.Payload, err = parseHeader(pkt); err != nil {
+		return Packet{}, err
+	}
+
+	return p, crcErr
+}
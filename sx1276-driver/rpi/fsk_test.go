@@ -0,0 +1,58 @@
+package rfm9x
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+)
+
+func TestFskLongPacket(t *testing.T) {
+	// Packets longer than the 64 bytes FIFO must be fed to it as it
+	// drains when sending and read out as it fills when receiving.
+	o := DefaultOpts
+	o.Modem = ModemFsk
+
+	o.NodeAddress = 1
+	tx, tx_chip := newSimDev(t, o, false)
+	o.NodeAddress = 2
+	rx, rx_chip := newSimDev(t, o, false)
+	tx_chip.Instant, rx_chip.Instant = false, false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	frames := make(chan sx1276sim.Frame, 1)
+	tx_chip.OnTransmit = func(f sx1276sim.Frame) { frames <- f }
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		data, err := rx.ReceiveContext(ctx)
+		results <- result{data, err}
+	}()
+
+	data := bytes.Repeat([]byte("fifo"), 50)
+	if err := tx.SendContext(ctx, data); err != nil {
+		t.Fatalf("SendContext() = %v", err)
+	}
+
+	f := <-frames
+	if len(f.Payload) != HeaderLength+len(data) {
+		t.Fatalf("sent %d bytes, want %d", len(f.Payload), HeaderLength+len(data))
+	}
+
+	inject(ctx, rx_chip, f)
+	r := <-results
+	if r.err != nil {
+		t.Fatalf("ReceiveContext() = %v", r.err)
+	}
+	if !bytes.Equal(r.data, data) {
+		t.Errorf("received %q, want %q", r.data, data)
+	}
+}
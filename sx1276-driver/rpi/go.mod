@@ -3,6 +3,9 @@ module github.com/ulbios/lora/sx1276-driver/rpi
 go 1.17
 
 require (
+	github.com/ulbios/lora/sx1276-driver/sx1276 v0.0.0
 	periph.io/x/conn/v3 v3.6.10
 	periph.io/x/host/v3 v3.7.2
 )
+
+replace github.com/ulbios/lora/sx1276-driver/sx1276 => ../sx1276
@@ -0,0 +1,78 @@
+package rfm9x
+
+import "fmt"
+
+// Header models the 4-byte header RadioHead prepends to every
+// packet. Keeping it around makes us wire-compatible with both
+// RadioHead and Adafruit's CircuitPython nodes.
+// Check https://www.airspayce.com/mikem/arduino/RadioHead/classRHGenericDriver.html
+// for more information.
+type Header struct {
+	// To is the address of the packet's recipient.
+	To byte
+
+	// From is the address of the packet's sender.
+	From byte
+
+	// ID is a sequence number identifying the packet.
+	ID byte
+
+	// Flags carries RadioHead's per-packet flags.
+	Flags byte
+}
+
+// bytes returns the header as it's laid out on the wire.
+func (h Header) bytes() []byte {
+	return []byte{h.To, h.From, h.ID, h.Flags}
+}
+
+// String returns a human-readable representation of the header.
+func (h Header) String() string {
+	return fmt.Sprintf("[to = %#x; from = %#x; id = %d; flags = %#x]", h.To, h.From, h.ID, h.Flags)
+}
+
+// parseHeader splits a raw packet into its header and payload.
+// It returns ErrShortPacket when pkt can't hold a header.
+func parseHeader(pkt []byte) (Header, []byte, error) {
+	if len(pkt) < HeaderLength {
+		return Header{}, nil, fmt.Errorf("%w: %d bytes", ErrShortPacket, len(pkt))
+	}
+	return Header{To: pkt[0], From: pkt[1], ID: pkt[2], Flags: pkt[3]}, pkt[HeaderLength:], nil
+}
+
+// Address returns the node address of the device.
+func (d *Dev) Address() byte {
+	return d.address
+}
+
+// SetAddress changes the node address of the device.
+// Packets not addressed to it or to BroadcastAddress
+// will be dropped unless promiscuous mode is enabled.
+func (d *Dev) SetAddress(addr byte) {
+	d.address = addr
+}
+
+// SetDestination changes the address Send and SendContext
+// deliver packets to.
+func (d *Dev) SetDestination(addr byte) {
+	d.destination = addr
+}
+
+// SetPromiscuous controls whether packets addressed
+// to other nodes are received too.
+func (d *Dev) SetPromiscuous(enable bool) {
+	d.promiscuous = enable
+}
+
+// accepts returns whether a packet with the provided
+// header is meant to be received by the device.
+func (d *Dev) accepts(h Header) bool {
+	return d.promiscuous || d.address == BroadcastAddress ||
+		h.To == BroadcastAddress || h.To == d.address
+}
+
+// nextID returns the sequence number for the next packet.
+func (d *Dev) nextID() byte {
+	d.seq++
+	return d.seq
+}
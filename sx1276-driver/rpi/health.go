@@ -0,0 +1,232 @@
+package rfm9x
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// chipVersion is the value RegVersion holds on SX1276/7/8/9 chips.
+const chipVersion = 0x12
+
+// HealthPolicy configures the watchdog started through Watch.
+type HealthPolicy struct {
+	// Interval is the time between health checks.
+	// It defaults to a minute when left as 0.
+	Interval time.Duration
+
+	// RxSilence makes the radio count as unhealthy once it goes
+	// for longer than that without receiving a packet. It's meant
+	// for receivers hearing from nodes that report periodically.
+	// Leave it as 0 to disable it.
+	RxSilence time.Duration
+}
+
+// DefaultHealthPolicy checks the radio's health every minute
+// without caring about how long it's been since the last packet.
+var DefaultHealthPolicy = HealthPolicy{Interval: time.Minute}
+
+// HealthEvent reports a problem found by the watchdog
+// along with the outcome of the ensuing recovery.
+type HealthEvent struct {
+	// Time is when the problem was found.
+	Time time.Time
+
+	// Problem describes what was wrong with the radio. It matches
+	// either ErrUnhealthy or, if the radio couldn't be checked at
+	// all, ErrSPI.
+	Problem error
+
+	// Err holds any errors raised whilst recovering the
+	// radio, being nil if it was recovered.
+	Err error
+}
+
+// CheckHealth checks whether the radio still is as we left it, which
+// stops being the case if it browns out and comes back with its default
+// registers. To that end, RegVersion must hold the SX127x's version, the
+// selected modem and operating mode must match those the device expects
+// (i.e. Rx whilst listening and Standby or Sleep otherwise) and the key
+// modem parameters must match those last applied through ApplyConfig or
+// ApplyFskConfig, so parameters changed through the individual setters
+// count as drift. Carrier frequencies are compared up to the
+// synthesiser's resolution, and not at all whilst hopping. Checks wait
+// for any ongoing transmission or reception to finish.
+// It returns an error matching ErrUnhealthy describing the first
+// mismatch found or one matching ErrSPI if the underlying SPI
+// transactions fail.
+func (d *Dev) CheckHealth() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.checkHealth()
+}
+
+// checkHealth implements CheckHealth. The device's lock must be held.
+func (d *Dev) checkHealth() error {
+	d.InvalidateCache()
+
+	v, err := d.Version()
+	if err != nil {
+		return spiError(err)
+	}
+	if v != chipVersion {
+		return fmt.Errorf("%w: RegVersion holds %#02x rather than %#02x", ErrUnhealthy, v, chipVersion)
+	}
+
+	op, err := d.ReadRegister(sx1276.RegOpMode, 8, 0)
+	if err != nil {
+		return spiError(err)
+	}
+	if lora := op>>7 == 0x1; lora == d.fsk() {
+		return fmt.Errorf("%w: the radio switched over to another modem (RegOpMode = %#02x)", ErrUnhealthy, op)
+	}
+	switch mode := d.Mode(); {
+	case d.core.Listening() && mode != sx1276.OpModeRx:
+		return fmt.Errorf("%w: the radio stopped listening and is in %s", ErrUnhealthy, sx1276.OpModeText(mode))
+	case !d.core.Listening() && mode != sx1276.OpModeStandby && mode != sx1276.OpModeSleep:
+		return fmt.Errorf("%w: the idle radio is in %s", ErrUnhealthy, sx1276.OpModeText(mode))
+	}
+
+	if d.fsk() {
+		return d.checkFskConfig()
+	}
+
+	c, err := d.Radio.ReadConfig()
+	if err != nil {
+		return spiError(err)
+	}
+	want := d.conf
+	switch {
+	case !d.hopping() && !sameFrequency(c.FrequencyHz, want.FrequencyHz):
+		return fmt.Errorf("%w: the radio is tuned to %v Hz rather than %v Hz", ErrUnhealthy, c.FrequencyHz, want.FrequencyHz)
+	case c.BandwidthHz != want.BandwidthHz || c.SpreadingFactor != want.SpreadingFactor || c.CodingRate != want.CodingRate:
+		return fmt.Errorf("%w: the radio uses BW = %v Hz, SF = %v and CR = 4/%v rather than BW = %v Hz, SF = %v and CR = 4/%v",
+			ErrUnhealthy, c.BandwidthHz, c.SpreadingFactor, c.CodingRate, want.BandwidthHz, want.SpreadingFactor, want.CodingRate)
+	case c.SyncWord != want.SyncWord:
+		return fmt.Errorf("%w: the radio uses sync word %#02x rather than %#02x", ErrUnhealthy, c.SyncWord, want.SyncWord)
+	case c.PreambleLength != want.PreambleLength:
+		return fmt.Errorf("%w: the radio uses a %v symbols preamble rather than a %v symbols one", ErrUnhealthy, c.PreambleLength, want.PreambleLength)
+	case c.ImplicitHeader != want.ImplicitHeader || c.Crc != want.Crc:
+		return fmt.Errorf("%w: the radio's implicit header and CRC settings (%v, %v) should be (%v, %v)",
+			ErrUnhealthy, c.ImplicitHeader, c.Crc, want.ImplicitHeader, want.Crc)
+	}
+	return nil
+}
+
+// checkFskConfig compares the key FSK/OOK modem parameters
+// against those last applied, if any, just like checkHealth
+// does for the LoRa ones.
+func (d *Dev) checkFskConfig() error {
+	if d.fskConf == nil {
+		return nil
+	}
+
+	c, err := d.Radio.ReadFskConfig()
+	if err != nil {
+		return spiError(err)
+	}
+	want := d.fskConf
+	switch {
+	case !sameFrequency(c.FrequencyHz, want.FrequencyHz):
+		return fmt.Errorf("%w: the radio is tuned to %v Hz rather than %v Hz", ErrUnhealthy, c.FrequencyHz, want.FrequencyHz)
+	case c.Ook != want.Ook:
+		return fmt.Errorf("%w: the radio's OOK setting should be %v", ErrUnhealthy, want.Ook)
+	case !bytes.Equal(c.SyncWord, want.SyncWord):
+		return fmt.Errorf("%w: the radio uses sync word %#x rather than %#x", ErrUnhealthy, c.SyncWord, want.SyncWord)
+	case c.PreambleLength != want.PreambleLength:
+		return fmt.Errorf("%w: the radio uses a %v bytes preamble rather than a %v bytes one", ErrUnhealthy, c.PreambleLength, want.PreambleLength)
+	}
+	return nil
+}
+
+// sameFrequency checks whether the carrier frequencies a and
+// b, in Hz, map to the same synthesiser setting give or take
+// a step of FStepHz.
+func sameFrequency(a, b uint) bool {
+	diff := int64(a) - int64(b)
+	return diff <= sx1276.FStepHz && diff >= -sx1276.FStepHz
+}
+
+// Recover pulses the radio's reset pin and configures it all over
+// again with the LoRa and FSK/OOK modem parameters and the hopping
+// sequence last applied, leaving the same modem selected. If the
+// device is listening the radio is put back in Rx, so listeners
+// carry on as if nothing happened save for the packets lost.
+// It returns any errors raised by the setters or the underlying
+// SPI transactions, the latter matching ErrSPI.
+func (d *Dev) Recover() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.recover()
+}
+
+// recover implements Recover. The device's lock must be held.
+func (d *Dev) recover() error {
+	d.log.warn("recovering the radio")
+
+	if err := d.Radio.Reset(); err != nil {
+		return fmt.Errorf("%w: the reset failed: %v", ErrUnhealthy, err)
+	}
+	v, err := d.Version()
+	if err != nil {
+		return spiError(err)
+	}
+	if v != chipVersion {
+		return fmt.Errorf("%w: RegVersion holds %#02x after a reset", ErrUnhealthy, v)
+	}
+
+	if err := d.SetMode(sx1276.OpModeSleep); err != nil {
+		return spiError(err)
+	}
+	if err := d.SetLoRa(true); err != nil {
+		return spiError(err)
+	}
+	if err := d.SetFifoBaseAddrs(0x0, 0x0); err != nil {
+		return spiError(err)
+	}
+	if err := d.bus.batch(func() error { return d.Radio.ApplyConfig(d.conf) }); err != nil {
+		return spiError(err)
+	}
+	if h := d.Radio.Hopping(); h.Period != 0 {
+		if err := d.Radio.SetHopping(h); err != nil {
+			return spiError(err)
+		}
+	}
+
+	if d.fskConf != nil {
+		if err := d.Radio.SetModem(ModemFsk); err != nil {
+			return spiError(err)
+		}
+		if err := d.bus.batch(func() error { return d.Radio.ApplyFskConfig(*d.fskConf) }); err != nil {
+			return spiError(err)
+		}
+		if !d.fsk() {
+			if err := d.Radio.SetModem(ModemLoRa); err != nil {
+				return spiError(err)
+			}
+		}
+	}
+	if err := d.SetMode(sx1276.OpModeStandby); err != nil {
+		return spiError(err)
+	}
+
+	if d.core.Listening() {
+		return d.startRx(false)
+	}
+	return nil
+}
+
+// Watch checks the radio's health every p.Interval until ctx is done,
+// at which point the returned channel is closed. Whenever CheckHealth
+// finds a problem, or no packet has been received for longer than
+// p.RxSilence, the radio is recovered through Recover and a HealthEvent
+// is delivered on the returned channel. Events are dropped if the
+// channel's buffer is full.
+func (d *Dev) Watch(ctx context.Context, p HealthPolicy) <-chan HealthEvent {
+	return d.core.Watch(ctx, p)
+}
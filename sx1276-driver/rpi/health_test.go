@@ -0,0 +1,288 @@
+package rfm9x
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// versionFaker makes the chip it wraps report
+// version on RegVersion once it's set.
+type versionFaker struct {
+	*sx1276sim.Chip
+	version uint32
+}
+
+func (f *versionFaker) Connect(fr physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	if _, err := f.Chip.Connect(fr, mode, bits); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *versionFaker) Tx(w, r []byte) error {
+	// w and r may share their backing array.
+	addr := w[0]
+	if err := f.Chip.Tx(w, r); err != nil {
+		return err
+	}
+	v := atomic.LoadUint32(&f.version)
+	if v == 0 || len(r) == 0 || addr&0x80 != 0 {
+		return nil
+	}
+	// Bursts reading RegVersion along with others are faked too.
+	if i := int(sx1276.RegVersion) - int(addr) + 1; i >= 1 && i < len(r) {
+		r[i] = byte(v)
+	}
+	return nil
+}
+
+// brownOut resets chip behind the driver's back, which brings
+// every register back to its reset value.
+func brownOut(chip *sx1276sim.Chip) {
+	chip.ResetPin().Out(gpio.Low)
+	chip.ResetPin().Out(gpio.High)
+}
+
+// startListening makes d listen until ctx is done,
+// returning once the radio is in Rx.
+func startListening(ctx context.Context, d *Dev) <-chan Packet {
+	pkts, _ := d.Listen(ctx)
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		listening := d.core.Listening()
+		d.mu.Unlock()
+		if listening {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return pkts
+}
+
+func TestCheckHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		listen  bool
+		hopping bool
+
+		// drift is applied to the device holding its lock.
+		drift func(d *Dev, f *versionFaker) error
+		want  error
+	}{
+		{"idle", false, false, nil, nil},
+		{"listening", true, false, nil, nil},
+		{"version", false, false, func(d *Dev, f *versionFaker) error {
+			atomic.StoreUint32(&f.version, 0x22)
+			return nil
+		}, ErrUnhealthy},
+		{"brown out", false, false, func(d *Dev, f *versionFaker) error {
+			brownOut(f.Chip)
+			return nil
+		}, ErrUnhealthy},
+		{"idle in rx", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetMode(sx1276.OpModeRx)
+		}, ErrUnhealthy},
+		{"stopped listening", true, false, func(d *Dev, f *versionFaker) error {
+			return d.SetMode(sx1276.OpModeStandby)
+		}, ErrUnhealthy},
+		{"sleeping", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetMode(sx1276.OpModeSleep)
+		}, nil},
+		{"frequency", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetCarrierFrequencyHz(868000000)
+		}, ErrUnhealthy},
+		{"frequency within a step", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetCarrierFrequencyHz(d.conf.FrequencyHz + uint(sx1276.FStepHz/2))
+		}, nil},
+		{"frequency whilst hopping", false, true, nil, nil},
+		{"spreading factor", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetSpreadingFactor(9)
+		}, ErrUnhealthy},
+		{"sync word", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetSyncWord(SyncWordPublic)
+		}, ErrUnhealthy},
+		{"preamble", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetPreambleLength(12)
+		}, ErrUnhealthy},
+		{"crc", false, false, func(d *Dev, f *versionFaker) error {
+			return d.SetCrc(false)
+		}, ErrUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip := sx1276sim.New()
+			chip.Instant = true
+			port := &versionFaker{Chip: chip}
+			o := DefaultOpts
+			o.ResetPin = chip.ResetPin()
+			if tt.hopping {
+				// Hopping retunes the radio away from the configured carrier.
+				o.Hopping = Hopping{ChannelsHz: []uint{903000000, 904000000}, Period: 10}
+			}
+			d, err := New(port, &o)
+			if err != nil {
+				t.Fatalf("New() = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if tt.listen {
+				startListening(ctx, d)
+			}
+			if tt.drift != nil {
+				d.mu.Lock()
+				err := tt.drift(d, port)
+				d.mu.Unlock()
+				if err != nil {
+					t.Fatalf("drift() = %v", err)
+				}
+			}
+
+			err = d.CheckHealth()
+			if tt.want == nil && err != nil {
+				t.Errorf("CheckHealth() = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("CheckHealth() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	for _, listen := range []bool{false, true} {
+		name := "idle"
+		if listen {
+			name = "listening"
+		}
+		t.Run(name, func(t *testing.T) {
+			c := sx1276.DefaultConfig
+			c.SpreadingFactor = 9
+			o := DefaultOpts
+			o.Config = &c
+			o.NodeAddress = 2
+			o.Hopping = Hopping{ChannelsHz: []uint{903000000, 904000000}, Period: 10}
+			d, chip := newSimDev(t, o, true)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var pkts <-chan Packet
+			if listen {
+				pkts = startListening(ctx, d)
+			}
+
+			brownOut(chip)
+			if err := d.CheckHealth(); !errors.Is(err, ErrUnhealthy) {
+				t.Fatalf("CheckHealth() = %v after a brown out, want %v", err, ErrUnhealthy)
+			}
+			if err := d.Recover(); err != nil {
+				t.Fatalf("Recover() = %v", err)
+			}
+			if err := d.CheckHealth(); err != nil {
+				t.Fatalf("CheckHealth() = %v after recovering", err)
+			}
+
+			d.mu.Lock()
+			got, err := d.Radio.ReadConfig()
+			period, p_err := d.HopPeriod()
+			d.mu.Unlock()
+			if err != nil || p_err != nil {
+				t.Fatalf("couldn't read the configuration back: %v, %v", err, p_err)
+			}
+			if got.SpreadingFactor != c.SpreadingFactor {
+				t.Errorf("SpreadingFactor = %d, want %d", got.SpreadingFactor, c.SpreadingFactor)
+			}
+			if got.FrequencyHz != o.Hopping.ChannelsHz[0] {
+				t.Errorf("FrequencyHz = %d, want the first hopping channel", got.FrequencyHz)
+			}
+			if period != o.Hopping.Period {
+				t.Errorf("HopPeriod() = %d, want %d", period, o.Hopping.Period)
+			}
+
+			if !listen {
+				return
+			}
+			inject(ctx, chip, sx1276sim.Frame{Payload: []byte{2, 1, 7, 0, 'x'}, Crc: true})
+			select {
+			case p := <-pkts:
+				if p.Header.ID != 7 {
+					t.Errorf("got a packet with ID %d, want 7", p.Header.ID)
+				}
+			case <-ctx.Done():
+				t.Fatal("the listener didn't carry on after recovering")
+			}
+		})
+	}
+}
+
+func TestWatchRecovers(t *testing.T) {
+	d, _ := newSimDev(t, DefaultOpts, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d.mu.Lock()
+	err := d.SetSpreadingFactor(9)
+	d.mu.Unlock()
+	if err != nil {
+		t.Fatalf("SetSpreadingFactor() = %v", err)
+	}
+
+	events := d.Watch(ctx, HealthPolicy{Interval: 10 * time.Millisecond})
+	select {
+	case ev := <-events:
+		if !errors.Is(ev.Problem, ErrUnhealthy) {
+			t.Errorf("Problem = %v, want %v", ev.Problem, ErrUnhealthy)
+		}
+		if ev.Err != nil {
+			t.Errorf("Err = %v, want nil", ev.Err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the drift went unnoticed")
+	}
+	if err := d.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth() = %v after recovering", err)
+	}
+}
+
+func TestWatchRxSilence(t *testing.T) {
+	d, _ := newSimDev(t, DefaultOpts, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := HealthPolicy{Interval: 10 * time.Millisecond, RxSilence: 100 * time.Millisecond}
+	start := time.Now()
+	events := d.Watch(ctx, p)
+
+	select {
+	case ev := <-events:
+		if !errors.Is(ev.Problem, ErrUnhealthy) {
+			t.Errorf("Problem = %v, want %v", ev.Problem, ErrUnhealthy)
+		}
+		if took := time.Since(start); took < p.RxSilence {
+			t.Errorf("reported the silence after %v, want %v at least", took, p.RxSilence)
+		}
+	case <-ctx.Done():
+		t.Fatal("the silence went unnoticed")
+	}
+
+	// Silence is measured from the recovery onwards.
+	select {
+	case ev := <-events:
+		t.Errorf("reported %v straight after recovering", ev.Problem)
+	case <-time.After(p.RxSilence - 2*p.Interval):
+	}
+}
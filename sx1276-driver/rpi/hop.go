@@ -0,0 +1,71 @@
+package rfm9x
+
+import (
+	"sync/atomic"
+
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Hopping configures Frequency Hopping Spread Spectrum, which
+// keeps long packets within the dwell time limits of regions
+// such as US915. Check sx1276.Hopping for the details.
+type Hopping = sx1276.Hopping
+
+// SetHopping validates and then configures the hopping sequence
+// in h, which both ends must share. Whilst hopping, every packet
+// is sent and received starting on the first channel and the
+// driver polls the IRQ flags every millisecond to retune the radio
+// on each hop, even if a DIO0 pin is available. Hop periods should
+// thus last for a few milliseconds at least. A Period of 0 disables
+// hopping.
+// It returns any errors raised by the validation or the underlying
+// SPI transactions, the latter matching ErrSPI.
+func (d *Dev) SetHopping(h Hopping) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.Radio.SetHopping(h); err != nil {
+		return spiError(err)
+	}
+
+	var hopping uint32
+	if h.Period != 0 {
+		hopping = 1
+	}
+	atomic.StoreUint32(&d.hops, hopping)
+	return nil
+}
+
+// hopping checks whether a hopping sequence is configured.
+// It's safe to call it without holding the device's lock.
+func (d *Dev) hopping() bool {
+	return atomic.LoadUint32(&d.hops) != 0
+}
+
+// serviceHop retunes the radio if flags signal it has just hopped
+// to another channel. Errors raised by the underlying SPI
+// transactions match ErrSPI.
+func (d *Dev) serviceHop(flags byte) error {
+	if flags&sx1276.IrqFhssChangeChannel == 0 {
+		return nil
+	}
+	if err := d.ServiceHop(flags); err != nil {
+		return spiError(err)
+	}
+	d.log.debug("hopped to the next channel")
+	return nil
+}
+
+// restartHopping tunes the radio to the first hopping channel
+// ahead of a packet. Errors raised by the underlying SPI
+// transactions match ErrSPI.
+func (d *Dev) restartHopping() error {
+	if err := d.RestartHopping(); err != nil {
+		return spiError(err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package rfm9x
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+func TestHopping(t *testing.T) {
+	// Hops last for 25 ms, so the packet takes more than the
+	// 64 hops RegHopChannel counts up to before wrapping around.
+	// Its length leaves time to retune on the last one too.
+	c := sx1276.DefaultConfig
+	c.SpreadingFactor, c.BandwidthHz = 12, 500000
+	o := DefaultOpts
+	o.Config = &c
+	o.Hopping = Hopping{ChannelsHz: []uint{903000000, 905000000, 907000000}, Period: 3}
+
+	o.NodeAddress = 1
+	tx, tx_chip := newSimDev(t, o, true)
+	o.NodeAddress = 2
+	rx, rx_chip := newSimDev(t, o, true)
+	tx_chip.Instant, rx_chip.Instant = false, false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	frames := make(chan sx1276sim.Frame, 1)
+	tx_chip.OnTransmit = func(f sx1276sim.Frame) { frames <- f }
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		data, err := rx.ReceiveContext(ctx)
+		results <- result{data, err}
+	}()
+
+	data := bytes.Repeat([]byte("hops"), 57)
+	if err := tx.SendContext(ctx, data); err != nil {
+		t.Fatalf("SendContext() = %v", err)
+	}
+
+	f := <-frames
+	if len(f.HopsHz) <= 64 {
+		t.Fatalf("the packet only took %d hops", len(f.HopsHz))
+	}
+	for i, hop := range f.HopsHz {
+		if want := o.Hopping.ChannelsHz[i%len(o.Hopping.ChannelsHz)]; hop != want {
+			t.Fatalf("hop %d was on %d Hz, want %d Hz", i, hop, want)
+		}
+	}
+
+	// The receiver only gets the packet if it follows every hop.
+	inject(ctx, rx_chip, f)
+	r := <-results
+	if r.err != nil {
+		t.Fatalf("ReceiveContext() = %v", r.err)
+	}
+	if !bytes.Equal(r.data, data) {
+		t.Errorf("received %q, want %q", r.data, data)
+	}
+}
@@ -0,0 +1,24 @@
+package rfm9x
+
+import "context"
+
+// Listen keeps the radio in Rx continuous mode and delivers every
+// packet addressed to us on the returned packet channel until ctx
+// is done, at which point the radio is returned to Standby and both
+// channels are closed.
+//
+// Packets that can't be picked up (e.g. due to a wrong CRC) are
+// reported on the error channel and listening continues. Errors
+// matching ErrSPI are reported too, but they stop the listener.
+// Just like with ReceiveContext, packets flagged under CrcPolicyFlag
+// are delivered on the packet channel as well as on the error one.
+//
+// Transmissions issued whilst listening briefly switch the radio
+// to Tx and then resume listening. Packets being received when
+// they're issued are delivered rather than dropped. Any other
+// kind of reception fails with ErrListening until ctx is done.
+// Listening needs the LoRa modem: it fails straight away with
+// ErrModem otherwise.
+func (d *Dev) Listen(ctx context.Context) (<-chan Packet, <-chan error) {
+	return d.core.Listen(ctx)
+}
@@ -1,34 +1,95 @@
 package rfm9x
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"strings"
 
-type Log_level uint
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Log_level ranks log messages by how verbose they are.
+type Log_level = sx1276.Log_level
 
 const (
-	LogLevelRegIO Log_level = iota
-	LogLevelDebug
-	LogLevelInfo
-	LogLevelWarn
-	LogLevelErr
+	LogLevelRegIO = sx1276.LogLevelRegIO
+	LogLevelDebug = sx1276.LogLevelDebug
+	LogLevelInfo  = sx1276.LogLevelInfo
+	LogLevelWarn  = sx1276.LogLevelWarn
+	LogLevelErr   = sx1276.LogLevelErr
 )
 
-// Based on the contents of https://stackoverflow.com/a/47515351/9541128.
-type rfm9x_logger struct {
+// Logger receives the messages devices log along with structured
+// fields. Check sx1276.Logger for the details.
+type Logger = sx1276.Logger
+
+// NopLogger discards every message. Devices log
+// through it unless Opts provides a Logger.
+var NopLogger = sx1276.NopLogger
+
+// NewStdLogger returns a Logger writing every message through l,
+// or through the standard logger if l is nil, as a single line
+// holding its level, the message and then its fields, such as
+// "* WARNING * the radio looks unhealthy device=rfm9x:/dev/spidev0.1".
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s stdLogger) Log(level Log_level, msg string, keyvals ...interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "* %s * %s", level, msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", keyvals[i], keyvals[i+1])
+	}
+	s.l.Print(b.String())
+}
+
+// dev_logger hands the messages a device logs at or above
+// level over to out. Each device has its own.
+type dev_logger struct {
+	out   Logger
 	level Log_level
 }
 
-func (l *rfm9x_logger) reg_io(fmt string, args ...interface{}) {
-	if l.level <= LogLevelRegIO {
-		log.Printf("* REG I/O * "+fmt, args...)
+// newLogger returns the logger of a device named name logging
+// through out, which defaults to NopLogger if nil.
+func newLogger(out Logger, level Log_level, name string) *dev_logger {
+	if out == nil {
+		out = NopLogger
+	}
+	if name != "" {
+		out = sx1276.With(out, "device", name)
 	}
+	return &dev_logger{out: out, level: level}
+}
+
+// enabled checks whether messages at level are logged at all,
+// which lets callers skip gathering their fields otherwise.
+func (l *dev_logger) enabled(level Log_level) bool {
+	return level >= l.level && l.out != NopLogger
 }
 
-func (l *rfm9x_logger) debug(fmt string, args ...interface{}) {
-	if l.level < LogLevelInfo {
-		log.Printf("* DEBUG * "+fmt, args...)
+func (l *dev_logger) reg_io(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelRegIO) {
+		l.out.Log(LogLevelRegIO, msg, keyvals...)
 	}
 }
 
-func (l *rfm9x_logger) warn(fmt string, args ...interface{}) {
-	log.Printf("* WARNING * "+fmt, args...)
+func (l *dev_logger) debug(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelDebug) {
+		l.out.Log(LogLevelDebug, msg, keyvals...)
+	}
+}
+
+func (l *dev_logger) warn(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelWarn) {
+		l.out.Log(LogLevelWarn, msg, keyvals...)
+	}
 }
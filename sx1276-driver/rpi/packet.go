@@ -0,0 +1,59 @@
+package rfm9x
+
+import (
+	"context"
+	"time"
+)
+
+// Packet represents a received packet along with the
+// link metadata the radio reported for it.
+type Packet struct {
+	// Header is the packet's RadioHead header.
+	Header Header
+
+	// Payload holds the received data, header excluded.
+	Payload []byte
+
+	// RssiDBm is the packet's Received Signal Strength
+	// Indicator in dBm, corrected for the RF port in use
+	// and for low SNR conditions.
+	RssiDBm int
+
+	// SnrDB is the packet's Signal to Noise Ratio in dB.
+	SnrDB float64
+
+	// FreqErrorHz is the estimated offset between the
+	// transmitter's carrier and ours in Hz.
+	FreqErrorHz int
+
+	// Time is the instant at which the packet's reception
+	// was detected.
+	Time time.Time
+}
+
+// ReceivePacket listens for an incoming packet just like ReceiveContext
+// does, but returns it along with its link metadata.
+func (d *Dev) ReceivePacket(ctx context.Context) (Packet, error) {
+	return d.receive(ctx, pollInterval, nil)
+}
+
+// ReceivePacketInto works just like ReceivePacket, but the packet is
+// read into buf instead of a freshly allocated slice, so the returned
+// Packet's Payload aliases buf. The buffer must be able to hold the
+// whole packet, header included: MaxPayloadLength + HeaderLength bytes
+// always suffice. Packets that don't fit fail with io.ErrShortBuffer.
+func (d *Dev) ReceivePacketInto(ctx context.Context, buf []byte) (Packet, error) {
+	return d.receive(ctx, pollInterval, buf)
+}
+
+// readPacketMeta fills in the link metadata of p
+// from the registers describing the last received packet.
+// It returns any errors raised by the underlying SPI transactions.
+func (d *Dev) readPacketMeta(p *Packet) error {
+	q, err := d.LinkQuality()
+	if err != nil {
+		return err
+	}
+	p.RssiDBm, p.SnrDB, p.FreqErrorHz = q.RssiDBm, q.SnrDB, q.FreqErrorHz
+	return nil
+}
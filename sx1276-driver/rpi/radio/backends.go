@@ -0,0 +1,240 @@
+package radio
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x/sx126xsim"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/conn/v3/spi/spireg"
+	"periph.io/x/host/v3"
+	"periph.io/x/host/v3/sysfs"
+)
+
+// openRfm9x opens an RFM9x wired to a local SPI port. Specs look like:
+//
+//	rfm9x:/dev/spidev0.1?reset=GPIO25&dio0=GPIO24&speed=5
+//
+// The path names the SPI port, with an empty one picking the first
+// available. Pins are looked up by name in periph's GPIO registry,
+// except for those written as sysfs:N, which refer to sysfs pin N.
+// That's needed on boards such as the Orange Pi, where the memory
+// mapped driver can't drive the reset line. The speed is in MHz.
+func openRfm9x(u *url.URL, o rfm9x.Opts) (Radio, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("radio: initialising periph: %v", err)
+	}
+
+	q := u.Query()
+
+	var err error
+	if name := q.Get("reset"); name != "" {
+		if o.ResetPin, err = pin(name); err != nil {
+			return nil, err
+		}
+	}
+	if name := q.Get("dio0"); name != "" {
+		if o.DIO0Pin, err = pin(name); err != nil {
+			return nil, err
+		}
+	}
+	if speed := q.Get("speed"); speed != "" {
+		if o.BaudrateMHz, err = uintParam("speed", speed); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := spiPort(u)
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := rfm9x.New(p, &o)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return Wrap(dev, p), nil
+}
+
+// openSx126x opens a radio based on an SX1261/2 wired to a local SPI
+// port. Specs look like:
+//
+//	sx126x:/dev/spidev0.0?reset=GPIO18&busy=GPIO20&dio1=GPIO16&speed=8&tcxo=1800&rfswitch=true
+//
+// The port and pins are given just like with rfm9x specs, defaulting to
+// those in sx126x.DefaultOpts. The tcxo is the voltage supplied to the
+// module's TCXO in mV, with 0 meaning it's clocked by a crystal, whilst
+// rfswitch specifies whether DIO2 drives its RF switch.
+func openSx126x(u *url.URL, o rfm9x.Opts) (Radio, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, fmt.Errorf("radio: initialising periph: %v", err)
+	}
+
+	s_opts, err := sx126xOpts(o)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+
+	pins := map[string]*gpio.PinIO{"reset": &s_opts.ResetPin, "busy": &s_opts.BusyPin, "dio1": &s_opts.DIO1Pin}
+	for param, p := range pins {
+		if name := q.Get(param); name != "" {
+			if *p, err = pin(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if speed := q.Get("speed"); speed != "" {
+		if s_opts.BaudrateMHz, err = uintParam("speed", speed); err != nil {
+			return nil, err
+		}
+	}
+	if tcxo := q.Get("tcxo"); tcxo != "" {
+		if s_opts.TcxoMillivolts, err = uintParam("tcxo", tcxo); err != nil {
+			return nil, err
+		}
+	}
+	if rf_switch := q.Get("rfswitch"); rf_switch != "" {
+		if s_opts.Dio2RfSwitch, err = strconv.ParseBool(rf_switch); err != nil {
+			return nil, fmt.Errorf("radio: malformed rfswitch %q: %v", rf_switch, err)
+		}
+	}
+
+	p, err := spiPort(u)
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := sx126x.New(p, &s_opts)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return WrapSx126x(dev, p), nil
+}
+
+// sx126xOpts turns the rfm9x options o into the equivalent ones for
+// an SX1261/2, taking the hardware description from sx126x.DefaultOpts.
+// It returns an error if o asks for features the SX1261/2 driver lacks.
+func sx126xOpts(o rfm9x.Opts) (sx126x.Opts, error) {
+	if o.Hopping.Period != 0 || o.Modem != rfm9x.ModemLoRa || o.Fsk != nil {
+		return sx126x.Opts{}, fmt.Errorf("radio: the sx126x driver supports neither frequency hopping nor the FSK/OOK modem")
+	}
+
+	conf := o.ModemConfig()
+	s_opts := sx126x.DefaultOpts
+	s_opts.Config = &conf
+	s_opts.Lbt = o.Lbt
+	s_opts.DutyCycle = o.DutyCycle
+	s_opts.CrcPolicy = o.CrcPolicy
+	s_opts.NodeAddress = o.NodeAddress
+	s_opts.Destination = o.Destination
+	s_opts.Promiscuous = o.Promiscuous
+	s_opts.Logger = o.Logger
+	s_opts.Name = o.Name
+	s_opts.LogLevel = o.LogLevel
+	return s_opts, nil
+}
+
+// openSim opens a simulated chip. Check sx1276sim.Open for the
+// parameters its specs understand. Adding chip=sx126x opens a
+// simulated SX1261/2 instead, which shares the medium with the
+// simulated SX1276s.
+func openSim(u *url.URL, o rfm9x.Opts) (Radio, error) {
+	switch chip := u.Query().Get("chip"); chip {
+	case "", "sx1276":
+	case "sx126x":
+		return openSx126xSim(u, o)
+	default:
+		return nil, fmt.Errorf("radio: unsupported simulated chip %q", chip)
+	}
+
+	chip, err := sx1276sim.Open(u.String())
+	if err != nil {
+		return nil, err
+	}
+	o.ResetPin = chip.ResetPin()
+	o.DIO0Pin = chip.DIO0()
+
+	dev, err := rfm9x.New(chip, &o)
+	if err != nil {
+		chip.Close()
+		return nil, err
+	}
+	return Wrap(dev, chip), nil
+}
+
+// openSx126xSim opens a simulated SX1261/2. Check sx126xsim.Open
+// for the parameters its specs understand.
+func openSx126xSim(u *url.URL, o rfm9x.Opts) (Radio, error) {
+	s_opts, err := sx126xOpts(o)
+	if err != nil {
+		return nil, err
+	}
+
+	chip, err := sx126xsim.Open(u.String())
+	if err != nil {
+		return nil, err
+	}
+	s_opts.ResetPin = chip.ResetPin()
+	s_opts.BusyPin = chip.Busy()
+	s_opts.DIO1Pin = chip.DIO1()
+
+	dev, err := sx126x.New(chip, &s_opts)
+	if err != nil {
+		chip.Close()
+		return nil, err
+	}
+	return WrapSx126x(dev, chip), nil
+}
+
+// spiPort opens the SPI port named by the path of u, with
+// an empty one picking the first available.
+func spiPort(u *url.URL) (spi.PortCloser, error) {
+	port := u.Path
+	if port == "" {
+		port = u.Opaque
+	}
+	p, err := spireg.Open(port)
+	if err != nil {
+		return nil, fmt.Errorf("radio: opening SPI port %q: %v", port, err)
+	}
+	return p, nil
+}
+
+// uintParam parses the value val of the spec parameter param.
+func uintParam(param, val string) (uint, error) {
+	n, err := strconv.ParseUint(val, 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("radio: malformed %s %q: %v", param, val, err)
+	}
+	return uint(n), nil
+}
+
+// pin returns the GPIO pin called name.
+func pin(name string) (gpio.PinIO, error) {
+	if n := strings.TrimPrefix(name, "sysfs:"); n != name {
+		num, err := strconv.Atoi(n)
+		if err != nil {
+			return nil, fmt.Errorf("radio: malformed sysfs pin %q: %v", name, err)
+		}
+		if p, ok := sysfs.Pins[num]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("radio: unknown sysfs pin %d", num)
+	}
+
+	if p := gpioreg.ByName(name); p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("radio: unknown GPIO pin %q", name)
+}
@@ -0,0 +1,154 @@
+/*
+Package radio abstracts away the LoRa radios the applications talk
+through so that they don't need to care about how one is built. Radios
+are described by URI-style specs such as:
+
+	rfm9x:/dev/spidev0.1?reset=GPIO25&dio0=GPIO24
+	sx126x:/dev/spidev0.0?reset=GPIO18&busy=GPIO20&dio1=GPIO16
+	sim://239.76.82.65:1276?x=0&y=0
+	sim://239.76.82.65:1276?x=0&y=0&chip=sx126x
+
+New kinds of radios are plugged in by adding a backend to the backends
+map: every application will then understand its scheme.
+*/
+package radio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+)
+
+// Radio is a LoRa radio sending and receiving RadioHead packets.
+type Radio interface {
+	// Send transmits data behind the RadioHead header h, whose From
+	// field is overwritten with the radio's address. It gives up
+	// once ctx is done.
+	Send(ctx context.Context, h rfm9x.Header, data []byte) error
+
+	// Receive returns the next packet addressed to us,
+	// giving up once ctx is done.
+	Receive(ctx context.Context) (rfm9x.Packet, error)
+
+	// Listen delivers every packet addressed to us until ctx is done.
+	// Check rfm9x.Dev's Listen for the semantics of both channels.
+	Listen(ctx context.Context) (<-chan rfm9x.Packet, <-chan error)
+
+	// Configure applies the modem parameters in c.
+	Configure(c rfm9x.Config) error
+
+	// Stats returns a snapshot of the radio's reception counters.
+	Stats() rfm9x.Stats
+
+	// Address returns the radio's RadioHead node address.
+	Address() byte
+
+	// Watch checks the radio's health every p.Interval until ctx is
+	// done, recovering it and reporting an event whenever it's found
+	// unhealthy. Check rfm9x.Dev's Watch for the details.
+	Watch(ctx context.Context, p rfm9x.HealthPolicy) <-chan rfm9x.HealthEvent
+
+	// Close releases the resources backing the radio.
+	Close() error
+}
+
+// backend builds a Radio from a parsed spec and the options to apply.
+type backend func(u *url.URL, o rfm9x.Opts) (Radio, error)
+
+// backends maps each spec scheme to the backend building its radios.
+var backends = map[string]backend{
+	"rfm9x":          openRfm9x,
+	"sx126x":         openSx126x,
+	sx1276sim.Scheme: openSim,
+}
+
+// Open builds the radio described by spec, configuring it with o. Fields
+// of o describing the hardware (e.g. ResetPin) are overridden by those
+// in spec. Check each backend for the parameters it understands. Radios
+// left unnamed by o are named after spec in their log messages.
+// It returns any errors raised when parsing spec or opening the radio.
+func Open(spec string, o rfm9x.Opts) (Radio, error) {
+	if o.Name == "" {
+		o.Name = spec
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("radio: malformed spec %q: %v", spec, err)
+	}
+
+	open, ok := backends[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("radio: unsupported radio %q", u.Scheme)
+	}
+	return open(u, o)
+}
+
+// Wrap turns an already opened device into a Radio. Closing
+// the returned radio closes c, which may be nil.
+func Wrap(dev *rfm9x.Dev, c io.Closer) Radio {
+	return device{dev: dev, closer: c}
+}
+
+// WrapSx126x turns an already opened SX1261/2 into a Radio
+// just like Wrap does.
+func WrapSx126x(dev *sx126x.Dev, c io.Closer) Radio {
+	return device{dev: dev, closer: c}
+}
+
+// driver is the API shared by the device drivers backing radios.
+type driver interface {
+	SendHeader(ctx context.Context, h rfm9x.Header, data []byte) error
+	ReceivePacket(ctx context.Context) (rfm9x.Packet, error)
+	Listen(ctx context.Context) (<-chan rfm9x.Packet, <-chan error)
+	ApplyConfig(c rfm9x.Config) error
+	Stats() rfm9x.Stats
+	Address() byte
+	Watch(ctx context.Context, p rfm9x.HealthPolicy) <-chan rfm9x.HealthEvent
+}
+
+// device adapts a device driver to the Radio interface.
+type device struct {
+	dev    driver
+	closer io.Closer
+}
+
+func (d device) Send(ctx context.Context, h rfm9x.Header, data []byte) error {
+	return d.dev.SendHeader(ctx, h, data)
+}
+
+func (d device) Receive(ctx context.Context) (rfm9x.Packet, error) {
+	return d.dev.ReceivePacket(ctx)
+}
+
+func (d device) Listen(ctx context.Context) (<-chan rfm9x.Packet, <-chan error) {
+	return d.dev.Listen(ctx)
+}
+
+func (d device) Configure(c rfm9x.Config) error {
+	return d.dev.ApplyConfig(c)
+}
+
+func (d device) Stats() rfm9x.Stats {
+	return d.dev.Stats()
+}
+
+func (d device) Address() byte {
+	return d.dev.Address()
+}
+
+func (d device) Watch(ctx context.Context, p rfm9x.HealthPolicy) <-chan rfm9x.HealthEvent {
+	return d.dev.Watch(ctx, p)
+}
+
+func (d device) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
@@ -0,0 +1,487 @@
+package radio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x/sx126xsim"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+)
+
+// simRadio is a radio backed by a simulated chip along
+// with the hooks tests drive that chip through.
+type simRadio struct {
+	Radio
+
+	// inject hands a frame to the chip if it's in Rx and
+	// preamble makes it start receiving one.
+	inject   func(f sx1276sim.Frame) bool
+	preamble func() bool
+
+	// onTransmit and channelBusy point to the
+	// homonymous hooks of the chip.
+	onTransmit  *func(sx1276sim.Frame)
+	channelBusy *func(sx1276sim.Frame) bool
+}
+
+// chips opens a radio with options o over a fresh simulated chip of
+// each kind, waiting on its IRQ pin if pin is set. Transmissions are
+// instant so that tests don't wait for their time on air.
+var chips = []struct {
+	name string
+	open func(t *testing.T, o rfm9x.Opts, pin bool) simRadio
+}{
+	{"sx1276", newSx1276Sim},
+	{"sx126x", newSx126xSim},
+}
+
+func newSx1276Sim(t *testing.T, o rfm9x.Opts, pin bool) simRadio {
+	t.Helper()
+
+	chip := sx1276sim.New()
+	chip.Instant = true
+	o.ResetPin = chip.ResetPin()
+	if pin {
+		o.DIO0Pin = chip.DIO0()
+	}
+	d, err := rfm9x.New(chip, &o)
+	if err != nil {
+		t.Fatalf("rfm9x.New() = %v", err)
+	}
+	return simRadio{Wrap(d, chip), chip.Inject, chip.InjectPreamble, &chip.OnTransmit, &chip.ChannelBusy}
+}
+
+func newSx126xSim(t *testing.T, o rfm9x.Opts, pin bool) simRadio {
+	t.Helper()
+
+	s_opts, err := sx126xOpts(o)
+	if err != nil {
+		t.Fatalf("sx126xOpts() = %v", err)
+	}
+	chip := sx126xsim.New()
+	chip.Instant = true
+	s_opts.ResetPin, s_opts.BusyPin = chip.ResetPin(), chip.Busy()
+	if pin {
+		s_opts.DIO1Pin = chip.DIO1()
+	}
+	d, err := sx126x.New(chip, &s_opts)
+	if err != nil {
+		t.Fatalf("sx126x.New() = %v", err)
+	}
+	return simRadio{WrapSx126x(d, chip), chip.Inject, chip.InjectPreamble, &chip.OnTransmit, &chip.ChannelBusy}
+}
+
+// inject hands f to r as soon as it's in Rx, giving up once ctx is done.
+func inject(ctx context.Context, r simRadio, f sx1276sim.Frame) {
+	retry(ctx, func() bool { return r.inject(f) })
+}
+
+// injectPreamble makes r start receiving a frame as soon
+// as it's in Rx, giving up once ctx is done.
+func injectPreamble(ctx context.Context, r simRadio) {
+	retry(ctx, r.preamble)
+}
+
+// retry calls f every millisecond until it succeeds or ctx is done.
+func retry(ctx context.Context, f func() bool) {
+	for !f() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// pinModes are the ways of waiting for IRQs every chip supports.
+var pinModes = []struct {
+	name string
+	pin  bool
+}{
+	{"polling", false},
+	{"pin", true},
+}
+
+func TestSendReceive(t *testing.T) {
+	for _, c := range chips {
+		for _, m := range pinModes {
+			t.Run(c.name+"/"+m.name, func(t *testing.T) {
+				o := rfm9x.DefaultOpts
+				o.NodeAddress = 1
+				tx := c.open(t, o, m.pin)
+				o.NodeAddress = 2
+				rx := c.open(t, o, m.pin)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				*tx.onTransmit = func(f sx1276sim.Frame) {
+					f.RssiDBm, f.SnrDB = -60, 7.5
+					inject(ctx, rx, f)
+				}
+
+				got := make(chan rfm9x.Packet, 1)
+				errs := make(chan error, 1)
+				go func() {
+					p, err := rx.Receive(ctx)
+					got <- p
+					errs <- err
+				}()
+
+				data := []byte("hello")
+				if err := tx.Send(ctx, rfm9x.Header{To: 2}, data); err != nil {
+					t.Fatalf("Send() = %v", err)
+				}
+				p := <-got
+				if err := <-errs; err != nil {
+					t.Fatalf("Receive() = %v", err)
+				}
+
+				if !bytes.Equal(p.Payload, data) {
+					t.Errorf("Payload = %q, want %q", p.Payload, data)
+				}
+				if p.Header.From != 1 || p.Header.To != 2 {
+					t.Errorf("Header = %v, want one from 0x1 to 0x2", p.Header)
+				}
+				if p.SnrDB != 7.5 {
+					t.Errorf("SnrDB = %v, want 7.5", p.SnrDB)
+				}
+				if s := rx.Stats(); s.RxPackets != 1 {
+					t.Errorf("Stats().RxPackets = %d, want 1", s.RxPackets)
+				}
+			})
+		}
+	}
+}
+
+func TestReceiveCrcError(t *testing.T) {
+	for _, c := range chips {
+		for _, tc := range []struct {
+			name   string
+			policy rfm9x.Crc_policy
+		}{
+			{"reject", rfm9x.CrcPolicyReject},
+			{"flag", rfm9x.CrcPolicyFlag},
+		} {
+			t.Run(c.name+"/"+tc.name, func(t *testing.T) {
+				o := rfm9x.DefaultOpts
+				o.CrcPolicy = tc.policy
+				r := c.open(t, o, false)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				data := []byte{0xFF, 0x01, 0x00, 0x00, 'x'}
+				go inject(ctx, r, sx1276sim.Frame{Payload: data, Crc: true, CrcError: true})
+
+				p, err := r.Receive(ctx)
+				if !errors.Is(err, rfm9x.ErrCRC) {
+					t.Fatalf("Receive() = %v, want %v", err, rfm9x.ErrCRC)
+				}
+				if flagged := p.Payload != nil; flagged != (tc.policy == rfm9x.CrcPolicyFlag) {
+					t.Errorf("packet handed back = %v under policy %d", flagged, tc.policy)
+				}
+				if s := r.Stats(); s.CrcErrors != 1 || s.RxPackets != 0 {
+					t.Errorf("Stats() = %+v, want a single CRC error", s)
+				}
+			})
+		}
+	}
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	for _, c := range chips {
+		for _, m := range pinModes {
+			t.Run(c.name+"/"+m.name, func(t *testing.T) {
+				r := c.open(t, rfm9x.DefaultOpts, m.pin)
+
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+
+				start := time.Now()
+				if _, err := r.Receive(ctx); !errors.Is(err, rfm9x.ErrRxTimeout) {
+					t.Fatalf("Receive() = %v, want %v", err, rfm9x.ErrRxTimeout)
+				}
+				if took := time.Since(start); took > 500*time.Millisecond {
+					t.Errorf("Receive() took %v to time out", took)
+				}
+			})
+		}
+	}
+}
+
+func TestReceiveCancel(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			r := c.open(t, rfm9x.DefaultOpts, true)
+
+			// Without a deadline we can't bound the wait on the pin up front.
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+
+			start := time.Now()
+			if _, err := r.Receive(ctx); !errors.Is(err, rfm9x.ErrRxTimeout) {
+				t.Fatalf("Receive() = %v, want %v", err, rfm9x.ErrRxTimeout)
+			}
+			if took := time.Since(start); took > 500*time.Millisecond {
+				t.Errorf("Receive() took %v to notice the cancellation", took)
+			}
+		})
+	}
+}
+
+func TestSendWhilstListening(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			o := rfm9x.DefaultOpts
+			o.NodeAddress = 2
+			r := c.open(t, o, true)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			pkts, _ := r.Listen(ctx)
+			const n = 10
+			for i := 0; i < n; i++ {
+				// The packet is still to be picked up when we send.
+				inject(ctx, r, sx1276sim.Frame{Payload: []byte{2, 1, byte(i), 0, 'x'}, Crc: true})
+				if err := r.Send(ctx, rfm9x.Header{To: 1}, []byte("y")); err != nil {
+					t.Fatalf("Send() = %v", err)
+				}
+			}
+
+			for i := 0; i < n; i++ {
+				select {
+				case p := <-pkts:
+					if p.Header.ID != byte(i) {
+						t.Errorf("packet %d has ID %d", i, p.Header.ID)
+					}
+				case <-ctx.Done():
+					t.Fatalf("only %d of %d packets were delivered", i, n)
+				}
+			}
+		})
+	}
+}
+
+func TestSendWhilstReceiving(t *testing.T) {
+	for _, c := range chips {
+		for _, implicit := range []bool{false, true} {
+			name := c.name + "/explicit"
+			if implicit {
+				name = c.name + "/implicit"
+			}
+			t.Run(name, func(t *testing.T) {
+				o := rfm9x.DefaultOpts
+				o.NodeAddress = 2
+				conf := o.ModemConfig()
+				if implicit {
+					conf.ImplicitHeader = true
+					conf.PayloadLength = byte(rfm9x.HeaderLength + 1)
+				}
+				o.Config = &conf
+				r := c.open(t, o, true)
+
+				sent := make(chan struct{}, 1)
+				*r.onTransmit = func(sx1276sim.Frame) { sent <- struct{}{} }
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				pkts, _ := r.Listen(ctx)
+				injectPreamble(ctx, r)
+
+				errs := make(chan error, 1)
+				go func() { errs <- r.Send(ctx, rfm9x.Header{To: 1}, []byte("y")) }()
+
+				// The packet on its way is waited for.
+				select {
+				case <-sent:
+					t.Fatal("transmitted whilst receiving a packet")
+				case <-time.After(50 * time.Millisecond):
+				}
+				if !r.inject(sx1276sim.Frame{Payload: []byte{2, 1, 7, 0, 'x'}, Crc: true}) {
+					t.Fatal("the radio left Rx whilst receiving a packet")
+				}
+				if err := <-errs; err != nil {
+					t.Fatalf("Send() = %v", err)
+				}
+
+				select {
+				case p := <-pkts:
+					if p.Header.ID != 7 {
+						t.Errorf("got a packet with ID %d, want 7", p.Header.ID)
+					}
+				case <-ctx.Done():
+					t.Fatal("the packet wasn't delivered")
+				}
+			})
+		}
+	}
+}
+
+func TestListenCrcFlag(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			o := rfm9x.DefaultOpts
+			o.CrcPolicy = rfm9x.CrcPolicyFlag
+			r := c.open(t, o, false)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			pkts, errs := r.Listen(ctx)
+			inject(ctx, r, sx1276sim.Frame{Payload: []byte{0xFF, 1, 0, 0, 'x'}, Crc: true, CrcError: true})
+
+			select {
+			case err := <-errs:
+				if !errors.Is(err, rfm9x.ErrCRC) {
+					t.Fatalf("got %v on the error channel, want %v", err, rfm9x.ErrCRC)
+				}
+			case <-ctx.Done():
+				t.Fatal("the CRC error wasn't reported")
+			}
+			select {
+			case p := <-pkts:
+				if string(p.Payload) != "x" {
+					t.Errorf("Payload = %q, want \"x\"", p.Payload)
+				}
+			case <-ctx.Done():
+				t.Fatal("the flagged packet wasn't delivered")
+			}
+		})
+	}
+}
+
+func TestListenBeforeTalk(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			o := rfm9x.DefaultOpts
+			o.Lbt = rfm9x.LbtPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+			r := c.open(t, o, false)
+
+			cads := 0
+			*r.channelBusy = func(sx1276sim.Frame) bool {
+				cads++
+				return true
+			}
+			sent := false
+			*r.onTransmit = func(sx1276sim.Frame) { sent = true }
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := r.Send(ctx, rfm9x.Header{To: 1}, []byte("x")); !errors.Is(err, rfm9x.ErrChannelBusy) {
+				t.Fatalf("Send() = %v, want %v", err, rfm9x.ErrChannelBusy)
+			}
+			if cads != 3 {
+				t.Errorf("performed %d CADs, want 3", cads)
+			}
+			if sent {
+				t.Error("transmitted on a busy channel")
+			}
+		})
+	}
+}
+
+func TestListenBeforeTalkWhilstListening(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			const backoff = 200 * time.Millisecond
+			o := rfm9x.DefaultOpts
+			o.NodeAddress = 2
+			o.Lbt = rfm9x.LbtPolicy{MaxAttempts: 2, MinBackoff: backoff, MaxBackoff: backoff}
+			r := c.open(t, o, true)
+
+			// The channel is only busy the first time it's sensed.
+			backingOff := make(chan struct{})
+			*r.channelBusy = func(sx1276sim.Frame) bool {
+				select {
+				case <-backingOff:
+					return false
+				default:
+					close(backingOff)
+					return true
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			pkts, _ := r.Listen(ctx)
+			sent := make(chan error, 1)
+			go func() { sent <- r.Send(ctx, rfm9x.Header{To: 1}, []byte("y")) }()
+
+			<-backingOff
+			start := time.Now()
+			inject(ctx, r, sx1276sim.Frame{Payload: []byte{2, 1, 0, 0, 'x'}, Crc: true})
+			if took := time.Since(start); took > backoff/2 {
+				t.Errorf("the radio only went back to Rx after %v", took)
+			}
+
+			select {
+			case p := <-pkts:
+				if string(p.Payload) != "x" {
+					t.Errorf("Payload = %q, want \"x\"", p.Payload)
+				}
+			case err := <-sent:
+				t.Fatalf("Send() = %v before the packet was delivered", err)
+			}
+			if err := <-sent; err != nil {
+				t.Fatalf("Send() = %v", err)
+			}
+		})
+	}
+}
+
+func TestSendDelayedConcurrently(t *testing.T) {
+	for _, c := range chips {
+		t.Run(c.name, func(t *testing.T) {
+			const backoff = 100 * time.Millisecond
+			data := []byte("hello")
+			toa := rfm9x.TimeOnAir(rfm9x.DefaultOpts.ModemConfig(), len(data))
+
+			// Only one transmission fits within the window at a time.
+			o := rfm9x.DefaultOpts
+			o.DutyCycle = rfm9x.DutyCyclePolicy{Limit: 0.15, Window: 10 * toa, Delay: true}
+			o.Lbt = rfm9x.LbtPolicy{MaxAttempts: 2, MinBackoff: backoff, MaxBackoff: backoff}
+			r := c.open(t, o, true)
+
+			// The channel is only busy the first time it's sensed, so
+			// the second transmission goes out whilst the first one
+			// is backing off and takes up all of the airtime.
+			backingOff := make(chan struct{})
+			cads := 0
+			*r.channelBusy = func(sx1276sim.Frame) bool {
+				cads++
+				if cads == 1 {
+					close(backingOff)
+					return true
+				}
+				return false
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			first := make(chan error, 1)
+			start := time.Now()
+			go func() { first <- r.Send(ctx, rfm9x.Header{To: 1}, data) }()
+			<-backingOff
+			if err := r.Send(ctx, rfm9x.Header{To: 1}, data); err != nil {
+				t.Fatalf("Send() = %v", err)
+			}
+			if err := <-first; err != nil {
+				t.Fatalf("Send() = %v", err)
+			}
+			if took := time.Since(start); took < o.DutyCycle.Window {
+				t.Errorf("sent both packets in %v, want %v at least", took, o.DutyCycle.Window)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Package reliable implements acknowledged datagram delivery on top of
+a LoRa radio. It's wire-compatible with RadioHead's RHReliableDatagram
+so that Arduino and CircuitPython nodes can take part in the exchange.
+
+Useful resources:
+
+	RHReliableDatagram: https://www.airspayce.com/mikem/arduino/RadioHead/classRHReliableDatagram.html
+	Reference Python implementation: https://github.com/adafruit/Adafruit_CircuitPython_RFM9x/blob/main/adafruit_rfm9x.py
+*/
+package reliable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/radio"
+)
+
+const (
+	// FlagAck marks a packet as being an acknowledgement.
+	FlagAck byte = 0x80
+
+	// FlagRetry marks a packet as being a retransmission.
+	FlagRetry byte = 0x40
+
+	// DefaultTimeout is RadioHead's default time to wait for an ACK.
+	DefaultTimeout = 200 * time.Millisecond
+
+	// DefaultRetries is RadioHead's default number of retransmissions.
+	DefaultRetries = 3
+)
+
+// ErrNoAck is returned when a packet isn't acknowledged
+// after exhausting every retransmission.
+var ErrNoAck = errors.New("packet wasn't acknowledged")
+
+// ackPayload is the payload RadioHead sends along with every ACK.
+var ackPayload = []byte{'!'}
+
+// Stats holds delivery counters for a Datagram.
+type Stats struct {
+	// Sent counts packets handed to SendToWait.
+	Sent uint64
+
+	// Acked counts packets whose delivery was acknowledged.
+	Acked uint64
+
+	// Retransmissions counts every retry we carried out.
+	Retransmissions uint64
+
+	// Duplicates counts received retransmissions we dropped.
+	Duplicates uint64
+}
+
+// Datagram wraps a LoRa radio to provide acknowledged delivery.
+// Just like the underlying radio, it's not safe for concurrent use.
+type Datagram struct {
+	// Timeout is the time we wait for an ACK before retransmitting.
+	// Every wait is extended by a random amount of up to Timeout so
+	// that colliding senders don't retry in lockstep.
+	Timeout time.Duration
+
+	// Retries is the maximum number of retransmissions.
+	Retries int
+
+	// dev is the radio we send and receive through.
+	dev radio.Radio
+
+	// seq is the ID of the last packet we sent.
+	seq byte
+
+	// seen maps each sender's address to the last ID we got from it.
+	seen map[byte]byte
+
+	// rnd drives the randomised backoff.
+	rnd *rand.Rand
+
+	// stats holds the counters exposed through Stats.
+	stats Stats
+}
+
+// New returns a Datagram sending and receiving through dev
+// with RadioHead's default timeout and number of retries.
+// Devices opened by hand can be used through radio.Wrap.
+func New(dev radio.Radio) *Datagram {
+	return &Datagram{
+		Timeout: DefaultTimeout,
+		Retries: DefaultRetries,
+		dev:     dev,
+		seen:    map[byte]byte{},
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SendToWait sends data to the node whose address is to and waits
+// for it to be acknowledged, retransmitting up to Retries times.
+// Packets sent to rfm9x.BroadcastAddress aren't acknowledged, so
+// they're only sent once. It returns ErrNoAck if the packet wasn't
+// acknowledged or any errors raised by the radio.
+func (r *Datagram) SendToWait(ctx context.Context, to byte, data []byte) error {
+	atomic.AddUint64(&r.stats.Sent, 1)
+
+	r.seq++
+	h := rfm9x.Header{To: to, ID: r.seq}
+
+	for try := 0; try <= r.Retries; try++ {
+		if try > 0 {
+			atomic.AddUint64(&r.stats.Retransmissions, 1)
+			h.Flags |= FlagRetry
+		}
+
+		if err := r.dev.Send(ctx, h, data); err != nil {
+			return err
+		}
+
+		if to == rfm9x.BroadcastAddress {
+			return nil
+		}
+
+		acked, err := r.waitForAck(ctx, h)
+		if err != nil {
+			return err
+		}
+		if acked {
+			atomic.AddUint64(&r.stats.Acked, 1)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: gave up after %d retries", ErrNoAck, r.Retries)
+}
+
+// waitForAck listens for the ACK of the packet sent with header h
+// for Timeout plus a random backoff. Packets other than the ACK
+// we're waiting for are dropped, except for retransmissions of
+// packets we already acknowledged, which are acknowledged again.
+// So are packets that couldn't be picked up, but any other errors
+// raised by the radio are returned.
+func (r *Datagram) waitForAck(ctx context.Context, h rfm9x.Header) (bool, error) {
+	wait := r.Timeout + time.Duration(r.rnd.Int63n(int64(r.Timeout)+1))
+	ackCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	for {
+		if ackCtx.Err() != nil {
+			// Tell our own cancellation apart from the ACK timeout.
+			return false, ctx.Err()
+		}
+
+		p, err := r.dev.Receive(ackCtx)
+		switch {
+		case errors.Is(err, rfm9x.ErrRxTimeout):
+			return false, ctx.Err()
+		case badPacket(err):
+			continue
+		case err != nil:
+			return false, err
+		}
+
+		if p.Header.Flags&FlagAck != 0 {
+			if p.Header.From == h.To && p.Header.ID == h.ID {
+				return true, nil
+			}
+			continue
+		}
+
+		if id, ok := r.seen[p.Header.From]; ok && id == p.Header.ID && r.forUs(p.Header) {
+			if err := r.ack(ctx, p.Header); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// badPacket checks whether err was raised because the packet
+// received was unusable, in which case we keep on listening.
+func badPacket(err error) bool {
+	return errors.Is(err, rfm9x.ErrCRC) || errors.Is(err, rfm9x.ErrInvalidHeader) ||
+		errors.Is(err, rfm9x.ErrShortPacket) || errors.Is(err, rfm9x.ErrEmptyPacket)
+}
+
+// RecvAck waits for a packet addressed to us, acknowledging it
+// unless it's a broadcast or, when the radio is promiscuous, it
+// was addressed to some other node. Retransmissions of packets we've
+// already received are acknowledged again but otherwise dropped,
+// as are stray ACKs. It returns the received packet or any errors
+// raised by the radio.
+func (r *Datagram) RecvAck(ctx context.Context) (rfm9x.Packet, error) {
+	for {
+		p, err := r.dev.Receive(ctx)
+		if err != nil {
+			return p, err
+		}
+
+		ok, err := r.Accept(ctx, p)
+		if err != nil {
+			return rfm9x.Packet{}, err
+		}
+		if ok {
+			return p, nil
+		}
+	}
+}
+
+// Accept processes a packet received by other means (e.g. through
+// radio.Radio.Listen) just like RecvAck does. It acknowledges p when
+// needed and returns whether it should be handed to the application,
+// which isn't the case for ACKs and duplicates. It also returns any
+// errors raised whilst sending the ACK.
+func (r *Datagram) Accept(ctx context.Context, p rfm9x.Packet) (bool, error) {
+	if p.Header.Flags&FlagAck != 0 {
+		return false, nil
+	}
+
+	if r.forUs(p.Header) {
+		if err := r.ack(ctx, p.Header); err != nil {
+			return false, err
+		}
+	}
+
+	if id, ok := r.seen[p.Header.From]; ok && id == p.Header.ID && p.Header.Flags&FlagRetry != 0 {
+		atomic.AddUint64(&r.stats.Duplicates, 1)
+		return false, nil
+	}
+	r.seen[p.Header.From] = p.Header.ID
+
+	return true, nil
+}
+
+// forUs checks whether the packet whose header is h is to be
+// acknowledged, which is only the case if it was addressed to
+// us. Just like with RadioHead, broadcasts and packets picked
+// up in promiscuous mode are never acknowledged.
+func (r *Datagram) forUs(h rfm9x.Header) bool {
+	return h.To == r.dev.Address() && h.To != rfm9x.BroadcastAddress
+}
+
+// ack acknowledges the packet whose header is h. Just like
+// with RadioHead, none of its flags are echoed back.
+func (r *Datagram) ack(ctx context.Context, h rfm9x.Header) error {
+	return r.dev.Send(ctx, rfm9x.Header{To: h.From, ID: h.ID, Flags: FlagAck}, ackPayload)
+}
+
+// Stats returns a snapshot of the delivery counters.
+func (r *Datagram) Stats() Stats {
+	return Stats{
+		Sent:            atomic.LoadUint64(&r.stats.Sent),
+		Acked:           atomic.LoadUint64(&r.stats.Acked),
+		Retransmissions: atomic.LoadUint64(&r.stats.Retransmissions),
+		Duplicates:      atomic.LoadUint64(&r.stats.Duplicates),
+	}
+}
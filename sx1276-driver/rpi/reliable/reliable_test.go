@@ -0,0 +1,214 @@
+package reliable
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/rpi/radio"
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+)
+
+// lossy wraps a radio, dropping the first n received packets
+// matching drop and counting the packets sent through it.
+type lossy struct {
+	radio.Radio
+	drop func(rfm9x.Packet) bool
+	n    int
+	sent int
+}
+
+func (l *lossy) Send(ctx context.Context, h rfm9x.Header, data []byte) error {
+	l.sent++
+	return l.Radio.Send(ctx, h, data)
+}
+
+func (l *lossy) Receive(ctx context.Context) (rfm9x.Packet, error) {
+	for {
+		p, err := l.Radio.Receive(ctx)
+		if err != nil || l.n == 0 || !l.drop(p) {
+			return p, err
+		}
+		l.n--
+	}
+}
+
+// newNode opens a simulated radio whose address is addr and
+// attaches it to m x metres away from the origin.
+func newNode(t *testing.T, m *sx1276sim.Medium, addr byte, x float64) *lossy {
+	t.Helper()
+
+	chip := sx1276sim.New()
+	m.Attach(chip, sx1276sim.Position{X: x})
+	o := rfm9x.DefaultOpts
+	o.NodeAddress = addr
+	o.ResetPin, o.DIO0Pin = chip.ResetPin(), chip.DIO0()
+	d, err := rfm9x.New(chip, &o)
+	if err != nil {
+		t.Fatalf("rfm9x.New() = %v", err)
+	}
+	t.Cleanup(func() { chip.Close() })
+	return &lossy{Radio: radio.Wrap(d, chip)}
+}
+
+func isAck(p rfm9x.Packet) bool {
+	return p.Header.Flags&FlagAck != 0
+}
+
+func isData(p rfm9x.Packet) bool {
+	return !isAck(p)
+}
+
+// outcome is what happened during an exchange.
+type outcome struct {
+	// sent is what SendToWait returned.
+	sent error
+
+	// p and received are what RecvAck returned first.
+	p        rfm9x.Packet
+	received error
+
+	// lingered is what RecvAck returned whilst lingering.
+	lingered error
+}
+
+// exchange sends data from a to b, which receives it through RecvAck
+// and then keeps on listening for up to linger so that it handles any
+// retransmissions.
+func exchange(ctx context.Context, a *Datagram, b *Datagram, to byte, data []byte, linger time.Duration) outcome {
+	var o outcome
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if o.p, o.received = b.RecvAck(ctx); o.received != nil {
+			return
+		}
+		l_ctx, cancel := context.WithTimeout(ctx, linger)
+		defer cancel()
+		_, o.lingered = b.RecvAck(l_ctx)
+	}()
+
+	o.sent = a.SendToWait(ctx, to, data)
+	<-done
+	return o
+}
+
+func TestSendToWait(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		dropData    int
+		dropAck     int
+		retries     uint64
+		duplicates  uint64
+		acksSent    int
+		wantRetried bool
+	}{
+		{name: "acked", acksSent: 1},
+		{name: "packet lost", dropData: 1, retries: 1, acksSent: 1, wantRetried: true},
+		{name: "ack lost", dropAck: 1, retries: 1, duplicates: 1, acksSent: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := sx1276sim.NewMedium()
+			a_dev, b_dev := newNode(t, m, 1, 0), newNode(t, m, 2, 10)
+			a_dev.drop, a_dev.n = isAck, tc.dropAck
+			b_dev.drop, b_dev.n = isData, tc.dropData
+			a, b := New(a_dev), New(b_dev)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			o := exchange(ctx, a, b, 2, []byte("hello"), 500*time.Millisecond)
+			if o.sent != nil {
+				t.Fatalf("SendToWait() = %v", o.sent)
+			}
+			if o.received != nil {
+				t.Fatalf("RecvAck() = %v", o.received)
+			}
+			// Duplicates are acknowledged but never handed back.
+			if !errors.Is(o.lingered, rfm9x.ErrRxTimeout) {
+				t.Fatalf("RecvAck() = %v after the packet, want %v", o.lingered, rfm9x.ErrRxTimeout)
+			}
+			p := o.p
+			if string(p.Payload) != "hello" || p.Header.From != 1 {
+				t.Errorf("RecvAck() = %q from 0x%x, want \"hello\" from 0x1", p.Payload, p.Header.From)
+			}
+			if retried := p.Header.Flags&FlagRetry != 0; retried != tc.wantRetried {
+				t.Errorf("received a retransmission = %v, want %v", retried, tc.wantRetried)
+			}
+
+			if s := a.Stats(); s.Sent != 1 || s.Acked != 1 || s.Retransmissions != tc.retries {
+				t.Errorf("sender's Stats() = %+v, want a packet acked after %d retries", s, tc.retries)
+			}
+			if s := b.Stats(); s.Duplicates != tc.duplicates {
+				t.Errorf("receiver's Stats().Duplicates = %d, want %d", s.Duplicates, tc.duplicates)
+			}
+			if b_dev.sent != tc.acksSent {
+				t.Errorf("the receiver sent %d ACKs, want %d", b_dev.sent, tc.acksSent)
+			}
+		})
+	}
+}
+
+func TestSendToWaitNoAck(t *testing.T) {
+	m := sx1276sim.NewMedium()
+	a_dev := newNode(t, m, 1, 0)
+	a := New(a_dev)
+	a.Timeout, a.Retries = 20*time.Millisecond, 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.SendToWait(ctx, 2, []byte("hello")); !errors.Is(err, ErrNoAck) {
+		t.Fatalf("SendToWait() = %v, want %v", err, ErrNoAck)
+	}
+	if a_dev.sent != 3 {
+		t.Errorf("sent the packet %d times, want 3", a_dev.sent)
+	}
+}
+
+func TestSendToWaitBroadcast(t *testing.T) {
+	m := sx1276sim.NewMedium()
+	a_dev, b_dev := newNode(t, m, 1, 0), newNode(t, m, 2, 10)
+	a, b := New(a_dev), New(b_dev)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	o := exchange(ctx, a, b, rfm9x.BroadcastAddress, []byte("hello"), 0)
+	if o.sent != nil {
+		t.Fatalf("SendToWait() = %v", o.sent)
+	}
+	if o.received != nil {
+		t.Fatalf("RecvAck() = %v", o.received)
+	}
+	if p := o.p; p.Header.To != rfm9x.BroadcastAddress {
+		t.Errorf("received a packet for 0x%x, want a broadcast", p.Header.To)
+	}
+	if a_dev.sent != 1 || b_dev.sent != 0 {
+		t.Errorf("sent %d packets and %d ACKs, want a single packet and no ACKs", a_dev.sent, b_dev.sent)
+	}
+}
+
+func TestSendToWaitWhilstListening(t *testing.T) {
+	m := sx1276sim.NewMedium()
+	a := New(newNode(t, m, 1, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a.dev.Listen(ctx)
+	// Wait for the listener to get going.
+	done, stop := context.WithCancel(ctx)
+	stop()
+	for {
+		if _, err := a.dev.Receive(done); errors.Is(err, rfm9x.ErrListening) {
+			break
+		}
+	}
+
+	if err := a.SendToWait(ctx, 2, []byte("hello")); !errors.Is(err, rfm9x.ErrListening) {
+		t.Fatalf("SendToWait() = %v, want %v", err, rfm9x.ErrListening)
+	}
+}
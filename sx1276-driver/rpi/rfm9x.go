@@ -2,8 +2,10 @@ package rfm9x
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
 	"periph.io/x/conn/v3/gpio"
 	"periph.io/x/conn/v3/physic"
 	"periph.io/x/conn/v3/spi"
@@ -21,12 +23,24 @@ type Opts struct {
 	// chip's RESET input is connected to.
 	ResetPin gpio.PinIO
 
+	// DIO0Pin specifies the physical GPIO pin the chip's
+	// DIO0 output is connected to. When provided, the driver
+	// waits for TxDone and RxDone through edge detection on
+	// this pin instead of polling the IRQ flags over SPI.
+	// Leave it as nil to fall back to polling.
+	DIO0Pin gpio.PinIO
+
 	// FrequencyMHz specifies the carrier frequency the radio
 	// is to operate at. That is, the frequency that'll be used
 	// to send and receive data. This value is assumed to be
 	// provided in MegaHertz (i.e. MHz).
 	FrequencyMHz int64
 
+	// FrequencyHz specifies the carrier frequency in Hz, which
+	// makes it possible to use channels such as 868.1 MHz.
+	// When provided, it takes precedence over FrequencyMHz.
+	FrequencyHz uint
+
 	// PreambleLength specifies the size of the preamble to be included
 	// on LoRa packets by the radio. This preamble aides in the
 	// synchronization of sender and receiver and should be
@@ -47,10 +61,111 @@ type Opts struct {
 	// it on the receiver.
 	Crc bool
 
-	// LogLevel controls how 'verbosy' the instantiated device is.
+	// SyncWord specifies the LoRa sync word, which must match
+	// the one of the radios we talk to. Leave it as 0 to use
+	// SyncWordPrivate, the one LoRa radios ship with.
+	SyncWord byte
+
+	// Hopping configures Frequency Hopping Spread Spectrum.
+	// It's disabled unless its Period is set.
+	Hopping Hopping
+
+	// Modem selects the modem the device starts with: ModemLoRa,
+	// the default, or ModemFsk. Check SetModem for switching
+	// between them afterwards.
+	Modem Modem
+
+	// Fsk holds the FSK/OOK modem parameters. They're applied when
+	// provided or when Modem is ModemFsk, in which case they default
+	// to DefaultFskConfig.
+	Fsk *FskConfig
+
+	// Lbt configures listen-before-talk for every transmission.
+	// It's disabled unless its MaxAttempts is set. Check
+	// DefaultLbtPolicy for a sensible configuration.
+	Lbt LbtPolicy
+
+	// DutyCycle bounds the airtime spent transmitting. It's
+	// disabled unless its Limit is set. Check EU868DutyCycle
+	// for the limit that applies to the default EU channels.
+	DutyCycle DutyCyclePolicy
+
+	// CrcPolicy controls what happens to received packets
+	// whose payload CRC is wrong or missing. Check the
+	// CrcPolicy* constants for the available choices.
+	CrcPolicy Crc_policy
+
+	// NodeAddress is the RadioHead address of this node. Packets
+	// addressed to other nodes are dropped unless it's set to
+	// BroadcastAddress, in which case every packet is received.
+	NodeAddress byte
+
+	// Destination is the RadioHead address Send delivers packets to.
+	Destination byte
+
+	// Promiscuous specifies whether to receive packets
+	// addressed to other nodes too.
+	Promiscuous bool
+
+	// CacheRegisters specifies whether to shadow the contents of
+	// the configuration registers so that they don't need to be
+	// read over SPI every time they're accessed.
+	CacheRegisters bool
+
+	// Config holds the modem parameters to configure the radio
+	// with. When provided, it takes precedence over FrequencyMHz,
+	// PreambleLength, HighPower, Crc, SyncWord and Agc. Otherwise,
+	// those are applied on top of DefaultConfig.
+	Config *Config
+
+	// Logger receives the messages the device logs, tagged with
+	// a "device" field holding Name if provided. Leave it as nil
+	// to discard them. Check NewStdLogger for logging through
+	// the standard logger.
+	Logger Logger
+
+	// Name tells the device apart from others in its log messages.
+	Name string
+
+	// LogLevel controls how 'verbosy' the instantiated device
+	// is: messages below it never reach Logger.
 	LogLevel Log_level
 }
 
+// frequencyHz returns the carrier frequency in o in Hz.
+func (o *Opts) frequencyHz() uint {
+	if o.FrequencyHz != 0 {
+		return o.FrequencyHz
+	}
+	return uint(o.FrequencyMHz) * 1000000
+}
+
+// syncWord returns the LoRa sync word in o.
+func (o *Opts) syncWord() byte {
+	if o.SyncWord != 0 {
+		return o.SyncWord
+	}
+	return sx1276.SyncWordPrivate
+}
+
+// ModemConfig returns the modem parameters New configures: Config
+// if provided or DefaultConfig with FrequencyMHz, PreambleLength,
+// HighPower, Crc, SyncWord and Agc applied on top otherwise.
+func (o *Opts) ModemConfig() Config {
+	if o.Config != nil {
+		return *o.Config
+	}
+
+	conf := DefaultConfig
+	conf.FrequencyHz = o.frequencyHz()
+	conf.PreambleLength = uint16(o.PreambleLength)
+	conf.HighPower = o.HighPower
+	conf.SyncWord = o.syncWord()
+	conf.Crc = o.Crc
+	conf.Agc = o.Agc
+	return conf
+}
+
 // DefaultOpts are the recommended options for the radio.
 var DefaultOpts = Opts{
 	BaudrateMHz:    5,
@@ -60,43 +175,73 @@ var DefaultOpts = Opts{
 	HighPower:      true,
 	Agc:            false,
 	Crc:            true,
+	CrcPolicy:      CrcPolicyReject,
+	NodeAddress:    BroadcastAddress,
+	Destination:    BroadcastAddress,
+	Promiscuous:    false,
+	CacheRegisters: true,
 	LogLevel:       LogLevelInfo,
 }
 
 // Dev represents an RFM9x radio
 type Dev struct {
-	// cnx is the SPI connection with the chip itself.
-	cnx spi.Conn
+	// Radio is the hardware-independent core driving the chip
+	// through bus. Its configuration getters and setters are
+	// available straight from the device.
+	*sx1276.Radio
 
-	// rWBuff is used as the backing information source
-	// and destination on SPI transactions.
-	rWBuff [4]byte
+	// mu serialises access to the radio between Listen's
+	// goroutine and transmissions issued whilst listening.
+	mu sync.Mutex
 
-	// resetPin specifies the GPIO pin physically connected
-	// to the chip's reset pin.
-	resetPin gpio.PinIO
+	// core listens, senses the channel, accounts for the
+	// airtime and watches the radio's health through mu.
+	core *Core
 
-	// frequencyMHz specifies the radio's carrier frequency.
-	frequencyMHz int64
+	// bus grants access to the chip's registers over SPI.
+	bus *spiBus
 
-	// preambleLength specifies the length of
-	// the preamble on generated and received packets.
-	preambleLength uint
+	// log is the device's own logger.
+	log *dev_logger
 
-	// highPower specifies whether we're using large
-	// output powers.
-	highPower bool
+	// dio0Pin specifies the GPIO pin physically connected
+	// to the chip's DIO0 output. It's nil when we are to
+	// poll the IRQ flags instead.
+	dio0Pin gpio.PinIO
 
-	// agc specifies whether Automatic Gain Control is enabled.
-	agc bool
+	// crcPolicy specifies how packets failing the CRC are handled.
+	crcPolicy Crc_policy
 
-	// crc specifies whether Cyclic Redundancy Checks are enabled.
-	crc bool
-}
+	// hops is set whilst a hopping sequence is configured.
+	// It's accessed atomically as it's checked without
+	// holding the lock.
+	hops uint32
+
+	// fskOn is set whilst the FSK/OOK modem is selected. It's
+	// accessed atomically for the same reason as hops.
+	fskOn uint32
 
-// logger is used throughout the package to
-// log information to stdout.
-var logger rfm9x_logger
+	// address is the device's RadioHead node address.
+	address byte
+
+	// destination is the address Send delivers packets to.
+	destination byte
+
+	// promiscuous specifies whether to receive every packet.
+	promiscuous bool
+
+	// seq is the ID of the last packet we sent.
+	seq byte
+
+	// conf and fskConf hold the LoRa and FSK/OOK modem parameters
+	// last applied, which are restored when recovering the radio.
+	// fskConf is nil unless the FSK/OOK modem was ever configured.
+	conf    Config
+	fskConf *FskConfig
+
+	// stats holds the reception counters exposed through Stats.
+	stats Stats
+}
 
 // New initialises and returns a reference to a new RFM9x radio.
 //
@@ -111,68 +256,101 @@ func New(p spi.Port, o *Opts) (*Dev, error) {
 		return nil, err
 	}
 
-	logger = rfm9x_logger{level: o.LogLevel}
+	log := newLogger(o.Logger, o.LogLevel, o.Name)
+	log.debug("connected to the radio", "duplex", c.Duplex())
 
-	logger.debug("Connection state: %v\n", c.Duplex().String())
+	bus := &spiBus{cnx: c, resetPin: o.ResetPin, log: log}
+	if o.CacheRegisters {
+		bus.cache = &regCache{}
+	}
 
 	dev := &Dev{
-		cnx:            c,
-		rWBuff:         [4]byte{},
-		resetPin:       o.ResetPin,
-		frequencyMHz:   o.FrequencyMHz,
-		preambleLength: o.PreambleLength,
-		highPower:      o.HighPower,
-		agc:            o.Agc,
-		crc:            o.Crc,
+		Radio:       sx1276.New(bus),
+		bus:         bus,
+		log:         log,
+		dio0Pin:     o.DIO0Pin,
+		crcPolicy:   o.CrcPolicy,
+		address:     o.NodeAddress,
+		destination: o.Destination,
+		promiscuous: o.Promiscuous,
+	}
+	dev.core = NewCore(chip{dev}, &dev.mu, CoreOpts{
+		Lbt:       o.Lbt,
+		DutyCycle: o.DutyCycle,
+		Logger:    o.Logger,
+		LogLevel:  o.LogLevel,
+		Name:      o.Name,
+	})
+
+	if dev.dio0Pin != nil {
+		if err := dev.dio0Pin.In(gpio.PullNoChange, gpio.RisingEdge); err != nil {
+			return nil, fmt.Errorf("couldn't configure edge detection on DIO0: %v", err)
+		}
+		log.debug("waiting for IRQs on DIO0", "pin", dev.dio0Pin)
 	}
 
 	dev.Reset()
-	if v, err := dev.Version(); v != 18 || err != nil {
-		logger.warn("Wrong radio version detected O_o!\n")
+	if v, err := dev.Version(); v != chipVersion || err != nil {
+		log.warn("wrong radio version detected", "version", v, "err", err)
 	}
 
-	dev.SetMode(OpModeSleep)
+	dev.SetMode(sx1276.OpModeSleep)
 	time.Sleep(10 * time.Millisecond)
-	logger.debug("Current operating mode: %s", OpModeText(dev.Mode()))
-
 	dev.SetLoRa(true)
-	logger.debug("LoRa mode enabled? %v\n", dev.LoRa())
-
-	if o.FrequencyMHz > 525 {
-		dev.SetLowFreqMode(false)
-		logger.debug("Low frequency mode enabled? %v\n", dev.LowFreqMode())
+	if log.enabled(LogLevelDebug) {
+		log.debug("selected the LoRa modem", "mode", sx1276.OpModeText(dev.Mode()), "lora", dev.LoRa())
 	}
 
 	dev.SetFifoBaseAddrs(0x0, 0x0)
-	dev.SetCarrierFrequencyMHz(o.FrequencyMHz)
-	dev.SetPreambleLength(uint16(o.PreambleLength))
-	dev.SetBwHz(125000)
-	dev.SetCodingRate(5)
-	dev.SetSpreadingFactor(7)
-	dev.SetCrc(o.Crc)
-	dev.SetAgc(o.Agc)
-	dev.SetTxPower(13)
-	dev.SetMode(OpModeStandby)
-
-	if o.LogLevel <= LogLevelDebug {
-		tx_b, rx_b := dev.FifoBaseAddrs()
-		logger.debug("FiFo base addresses -> Tx = %v; Rx = %v\n", tx_b, rx_b)
-		m_freq, _ := dev.CarrierFrequencyMHz()
-		logger.debug("Current modulating frequency: %v MHz\n", m_freq)
+
+	if err := dev.ApplyConfig(o.ModemConfig()); err != nil {
+		return nil, err
+	}
+	if o.Hopping.Period != 0 {
+		if err := dev.SetHopping(o.Hopping); err != nil {
+			return nil, err
+		}
+		log.debug("hopping", "channels_hz", o.Hopping.ChannelsHz, "period", o.Hopping.Period)
+	}
+	dev.SetMode(sx1276.OpModeStandby)
+
+	if log.enabled(LogLevelDebug) {
+		tx_b, rx_b, _ := dev.FifoBaseAddrs()
+		m_freq, _ := dev.CarrierFrequencyHz()
 		pre_l, _ := dev.PreambleLength()
-		logger.debug("Current preamble length frequency: %v bytes\n", pre_l)
 		bw_hz, _ := dev.BwHz()
-		logger.debug("Current bandwidth: %v Hz\n", bw_hz)
 		cr, _ := dev.CodingRate()
-		logger.debug("Current coding rate: %v\n", cr)
 		sf, _ := dev.SpreadingFactor()
-		logger.debug("Current spreading factor: %v \n", sf)
-		logger.debug("CRC enabled? %v\n", dev.Crc())
-		logger.debug("AGC enabled? %v\n", dev.Agc())
+		sync_w, _ := dev.SyncWord()
 		tx_pow, _ := dev.TxPower()
-		logger.debug("Current TX power: %v dBm\n", tx_pow)
 		time.Sleep(10 * time.Millisecond)
-		logger.debug("Current operating mode: %s", OpModeText(dev.Mode()))
+		log.debug("configured the radio",
+			"fifo_tx_base", tx_b, "fifo_rx_base", rx_b,
+			"frequency_hz", m_freq, "low_freq", dev.LowFreqMode(),
+			"preamble", pre_l, "bandwidth_hz", bw_hz, "coding_rate", cr, "sf", sf,
+			"ldro", dev.LowDataRateOptimize(), "sync_word", sync_w,
+			"crc", dev.Crc(), "agc", dev.Agc(), "tx_power_dbm", tx_pow,
+			"mode", sx1276.OpModeText(dev.Mode()))
+	}
+
+	if o.Fsk != nil || o.Modem == ModemFsk {
+		fsk_conf := DefaultFskConfig
+		if o.Fsk != nil {
+			fsk_conf = *o.Fsk
+		}
+		if err := dev.SetModem(ModemFsk); err != nil {
+			return nil, err
+		}
+		if err := dev.ApplyFskConfig(fsk_conf); err != nil {
+			return nil, err
+		}
+		log.debug("configured the FSK/OOK modem", "config", fsk_conf)
+		if o.Modem != ModemFsk {
+			if err := dev.SetModem(ModemLoRa); err != nil {
+				return nil, err
+			}
+		}
+		log.debug("selected a modem", "modem", dev.Modem())
 	}
 
 	return dev, nil
@@ -184,118 +362,36 @@ func New(p spi.Port, o *Opts) (*Dev, error) {
 // by reading back the value of a register with
 // a well known default value.
 func (d *Dev) Reset() {
-	logger.debug("Began resetting the radio!\n")
+	d.log.debug("resetting the radio")
 
-	d.resetPin.Out(gpio.High)
-	d.resetPin.Out(gpio.Low)
-	time.Sleep(100 * time.Microsecond)
-	d.resetPin.Out(gpio.High)
-	time.Sleep(5 * time.Millisecond)
-
-	if mode, _ := d.read_register(RegOpMode, 3, 0); mode != 0x1 {
-		logger.debug("Looks like the RESET didn't work as planned: current Op Mode is %d\n", mode)
+	if err := d.Radio.Reset(); err != nil {
+		d.log.debug("the reset didn't work as planned", "err", err)
 	} else {
-		logger.debug("The RESET looks good!\n")
+		d.log.debug("the reset looks good")
 	}
 }
 
-// Version returns the chips version number
-// along with any errors raised by the
-// SPI transaction.
-func (d *Dev) Version() (byte, error) {
-	return d.read_byte(RegVersion)
-}
-
 // Print_registers shows the contents of the main configuration registers.
 // It is mainly intended for debugging and checking the correctness of the
 // current configuration.
 func (d *Dev) Print_registers() {
-	fmt.Printf("Operation mode: %s\n", fmt.Sprint(d.read_register(RegOpMode, 3, 0)))
-	fmt.Printf("Low frequency mode: %s\n", fmt.Sprint(d.read_register(RegOpMode, 1, 3)))
-	fmt.Printf("Modulation type: %s\n", fmt.Sprint(d.read_register(RegOpMode, 2, 5)))
-	fmt.Printf("LoRa mode: %s\n", fmt.Sprint(d.read_register(RegOpMode, 1, 7)))
-	fmt.Printf("Output power: %s\n", fmt.Sprint(d.read_register(RegPaConfig, 4, 0)))
-	fmt.Printf("Max power: %s\n", fmt.Sprint(d.read_register(RegPaConfig, 3, 4)))
-	fmt.Printf("Pa Config: %s\n", fmt.Sprint(d.read_register(RegPaConfig, 8, 0)))
-	fmt.Printf("PA select: %s\n", fmt.Sprint(d.read_register(RegOpMode, 1, 7)))
-	fmt.Printf("PA DAC: %s\n", fmt.Sprint(d.read_register(RegPaDac, 3, 0)))
-	fmt.Printf("DIO 0 mapping: %s\n", fmt.Sprint(d.read_register(RegDioMappingA, 2, 6)))
-	fmt.Printf("Auto AGC: %s\n", fmt.Sprint(d.read_register(RegModemConfigC, 1, 2)))
-	fmt.Printf("Low datarate optimise: %s\n", fmt.Sprint(d.read_register(RegModemConfigC, 1, 3)))
-	fmt.Printf("LNA boost HF: %s\n", fmt.Sprint(d.read_register(RegLna, 2, 0)))
-	fmt.Printf("Auto IF on: %s\n", fmt.Sprint(d.read_register(RegDetectionOptimize, 1, 7)))
-	fmt.Printf("Detection optimise: %s\n", fmt.Sprint(d.read_register(RegDetectionOptimize, 3, 0)))
-
-	fmt.Printf("Raw Freq MSB register: %s\n", fmt.Sprint(d.read_register(RegFrfMsb, 8, 0)))
-	fmt.Printf("Raw Freq MID registers: %s\n", fmt.Sprint(d.read_register(RegFrfMid, 8, 0)))
-	fmt.Printf("Raw Freq LSB registers: %s\n", fmt.Sprint(d.read_register(RegFrfLsb, 8, 0)))
-}
-
-// read_register returns a register slice of the given size at the given offset
-// from the register identified by the provided addr.
-// It resturns the read data and any errors raised by the SPI transaction.
-func (d *Dev) read_register(addr reg_addr, size, offset byte) (byte, error) {
-	c_reg, err := d.read_byte(addr)
-	if err != nil {
-		return 0xFF, err
-	}
-	return (c_reg & (((1 << size) - 1) << offset)) >> offset, nil
-}
-
-// write_register overwrites a register slice of the given size at the
-// given offset with the given data. The register is identified by its addr.
-// It returns any errors raised by the SPI interface.
-func (d *Dev) write_register(addr reg_addr, size, offset, data byte) error {
-	c_reg, err := d.read_byte(addr)
-	if err != nil {
-		return err
-	}
-
-	// Clear out the register part we are to modify
-	c_reg &= (^((1 << size) - 1)) << offset
-
-	// Force that part to the provided data
-	c_reg |= (data & 0xFF) << offset
-
-	return d.write_byte(addr, c_reg)
-}
-
-// read_byte retrieves a byte located at the provided
-// addr over a SPI connection.
-// It returns the read data and any errors raised by the
-// SPI transaction.
-func (d *Dev) read_byte(addr reg_addr) (byte, error) {
-	d.rWBuff[0] = byte(addr) & 0x7F
-	if err := d.cnx.Tx(d.rWBuff[:2], d.rWBuff[:2]); err != nil {
-		return 0xFF, err
-	}
-	logger.reg_io("READ  @ Address -> %v; R/W buffer -> %v\n", addr, d.rWBuff)
-	return d.rWBuff[1], nil
-}
-
-// write_byte writes the specified data at the provided addr
-// over a SPI connection.
-// It returns any errors raised by the SPI transaction.
-func (d *Dev) write_byte(addr reg_addr, data byte) error {
-	d.rWBuff[0] = (byte(addr) | 0x80) & 0xFF
-	d.rWBuff[1] = data & 0xFF
-	if err := d.cnx.Tx(d.rWBuff[:2], d.rWBuff[:2]); err != nil {
-		return err
-	}
-	logger.reg_io("WRITE @ Address -> %v; R/W buffer -> %v\n", addr, d.rWBuff)
-	return nil
-}
-
-// write_payload writes a stream of bytes (i.e. data) at the
-// provided addr in a single SPI transaction. This permits
-// keeping the SS line low instead of toggling it back and forth.
-// It returns any errors raised by the SPI transaction.
-func (d *Dev) write_payload(addr byte, data []byte) error {
-	payload := []byte{(byte(addr) | 0x80) & 0xFF}
-	payload = append(payload, data...)
-	recv := make([]byte, len(payload))
-	if err := d.cnx.Tx(payload, recv); err != nil {
-		return err
-	}
-	return nil
+	fmt.Printf("Operation mode: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegOpMode, 3, 0)))
+	fmt.Printf("Low frequency mode: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegOpMode, 1, 3)))
+	fmt.Printf("Modulation type: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegOpMode, 2, 5)))
+	fmt.Printf("LoRa mode: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegOpMode, 1, 7)))
+	fmt.Printf("Output power: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegPaConfig, 4, 0)))
+	fmt.Printf("Max power: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegPaConfig, 3, 4)))
+	fmt.Printf("Pa Config: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegPaConfig, 8, 0)))
+	fmt.Printf("PA select: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegOpMode, 1, 7)))
+	fmt.Printf("PA DAC: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegPaDac, 3, 0)))
+	fmt.Printf("DIO 0 mapping: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegDioMappingA, 2, 6)))
+	fmt.Printf("Auto AGC: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegModemConfigC, 1, 2)))
+	fmt.Printf("Low datarate optimise: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegModemConfigC, 1, 3)))
+	fmt.Printf("LNA boost HF: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegLna, 2, 0)))
+	fmt.Printf("Auto IF on: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegDetectionOptimize, 1, 7)))
+	fmt.Printf("Detection optimise: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegDetectionOptimize, 3, 0)))
+
+	fmt.Printf("Raw Freq MSB register: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegFrfMsb, 8, 0)))
+	fmt.Printf("Raw Freq MID registers: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegFrfMid, 8, 0)))
+	fmt.Printf("Raw Freq LSB registers: %s\n", fmt.Sprint(d.ReadRegister(sx1276.RegFrfLsb, 8, 0)))
 }
@@ -0,0 +1,36 @@
+package rfm9x
+
+import "sync/atomic"
+
+// Stats holds per-device reception counters. They make it
+// possible to tell radio corruption apart from decoding errors
+// further up the stack.
+type Stats struct {
+	// RxPackets counts packets received without errors.
+	RxPackets uint64
+
+	// CrcErrors counts packets whose payload CRC didn't match.
+	CrcErrors uint64
+
+	// MissingCrc counts packets received without a CRC whilst
+	// we had CRCs enabled.
+	MissingCrc uint64
+
+	// HeaderErrors counts packets received without a valid header.
+	HeaderErrors uint64
+
+	// Filtered counts packets dropped for being addressed to other nodes.
+	Filtered uint64
+}
+
+// Stats returns a snapshot of the device's reception counters.
+// It's safe to call it concurrently with Send and Receive.
+func (d *Dev) Stats() Stats {
+	return Stats{
+		RxPackets:    atomic.LoadUint64(&d.stats.RxPackets),
+		CrcErrors:    atomic.LoadUint64(&d.stats.CrcErrors),
+		MissingCrc:   atomic.LoadUint64(&d.stats.MissingCrc),
+		HeaderErrors: atomic.LoadUint64(&d.stats.HeaderErrors),
+		Filtered:     atomic.LoadUint64(&d.stats.Filtered),
+	}
+}
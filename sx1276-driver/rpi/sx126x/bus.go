@@ -0,0 +1,151 @@
+package sx126x
+
+import (
+	"errors"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/spi"
+)
+
+// errBusy is returned when the chip doesn't release
+// its BUSY line in time for the next command.
+var errBusy = errors.New("the chip stayed busy for too long")
+
+// cmdBus issues commands to the chip over a periph SPI connection,
+// waiting for the chip to release its BUSY line ahead of each one
+// as per section 8.3.1 on the datasheet.
+type cmdBus struct {
+	// cnx is the SPI connection with the chip itself.
+	cnx spi.Conn
+
+	// resetPin specifies the GPIO pin physically connected
+	// to the chip's NRESET pin.
+	resetPin gpio.PinIO
+
+	// busyPin specifies the GPIO pin physically connected
+	// to the chip's BUSY pin.
+	busyPin gpio.PinIO
+
+	// buff backs every transaction so that commands don't allocate.
+	// It can hold the opcode, an offset or address, the status
+	// byte and the whole buffer.
+	buff [4 + 256]byte
+
+	// log is the logger of the device driving the bus.
+	log *dev_logger
+}
+
+// waitBusy blocks until the chip releases its BUSY line.
+// It returns errBusy if that doesn't happen within busyTimeout.
+func (b *cmdBus) waitBusy() error {
+	deadline := time.Now().Add(busyTimeout)
+	for b.busyPin.Read() == gpio.High {
+		if time.Now().After(deadline) {
+			return errBusy
+		}
+		time.Sleep(busyPollInterval)
+	}
+	return nil
+}
+
+// command issues the command op along with its parameters.
+// It returns any errors raised by the SPI transaction.
+func (b *cmdBus) command(op opcode, params ...byte) error {
+	if err := b.waitBusy(); err != nil {
+		return err
+	}
+	buff := b.buff[:len(params)+1]
+	buff[0] = byte(op)
+	copy(buff[1:], params)
+	if err := b.cnx.Tx(buff, buff); err != nil {
+		return err
+	}
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("issued command", "opcode", byte(op), "params", params)
+	}
+	return nil
+}
+
+// query issues the command op along with its parameters and reads
+// back len(out) bytes of data into out. It returns the status byte
+// the chip sends right before the data and any errors raised by the
+// SPI transaction.
+func (b *cmdBus) query(op opcode, params []byte, out []byte) (byte, error) {
+	if err := b.waitBusy(); err != nil {
+		return 0, err
+	}
+	n := len(params) + 1
+	buff := b.buff[:n+1+len(out)]
+	buff[0] = byte(op)
+	copy(buff[1:], params)
+	for i := range buff[n:] {
+		buff[n+i] = 0x0
+	}
+	if err := b.cnx.Tx(buff, buff); err != nil {
+		return 0, err
+	}
+	copy(out, buff[n+1:])
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("issued query", "opcode", byte(op), "params", params, "status", buff[n], "data", out)
+	}
+	return buff[n], nil
+}
+
+// writeRegister writes data to the consecutive registers
+// starting at addr. It returns any errors raised by the
+// SPI transaction.
+func (b *cmdBus) writeRegister(addr uint16, data ...byte) error {
+	return b.command(OpWriteRegister, append([]byte{byte(addr >> 8), byte(addr)}, data...)...)
+}
+
+// readRegister fills data with the contents of the consecutive
+// registers starting at addr. It returns any errors raised by the
+// SPI transaction.
+func (b *cmdBus) readRegister(addr uint16, data []byte) error {
+	_, err := b.query(OpReadRegister, []byte{byte(addr >> 8), byte(addr)}, data)
+	return err
+}
+
+// writeBuffer writes data to the data buffer starting at offset
+// in a single SPI transaction. It returns any errors raised by it.
+func (b *cmdBus) writeBuffer(offset byte, data []byte) error {
+	if err := b.waitBusy(); err != nil {
+		return err
+	}
+	buff := b.buff[:len(data)+2]
+	buff[0] = byte(OpWriteBuffer)
+	buff[1] = offset
+	copy(buff[2:], data)
+	if err := b.cnx.Tx(buff, buff); err != nil {
+		return err
+	}
+	if b.log.enabled(LogLevelRegIO) {
+		b.log.reg_io("wrote buffer", "offset", offset, "length", len(data))
+	}
+	return nil
+}
+
+// readBuffer fills data with the contents of the data buffer
+// starting at offset in a single SPI transaction. It returns
+// any errors raised by it.
+func (b *cmdBus) readBuffer(offset byte, data []byte) error {
+	_, err := b.query(OpReadBuffer, []byte{offset}, data)
+	return err
+}
+
+// reset pulses the chip's NRESET pin and waits for it to come
+// back up in STDBY_RC, which it signals by releasing BUSY.
+// It returns any errors raised when driving the pin.
+func (b *cmdBus) reset() error {
+	if err := b.resetPin.Out(gpio.Low); err != nil {
+		return err
+	}
+	time.Sleep(200 * time.Microsecond)
+	if err := b.resetPin.Out(gpio.High); err != nil {
+		return err
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	return b.waitBusy()
+}
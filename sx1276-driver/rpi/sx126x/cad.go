@@ -0,0 +1,59 @@
+package sx126x
+
+import (
+	"context"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+)
+
+// LbtPolicy configures listen-before-talk just like it does for rfm9x.
+type LbtPolicy = rfm9x.LbtPolicy
+
+// DefaultLbtPolicy is a sensible policy for nodes sharing a channel.
+// Note LBT is disabled on DefaultOpts.
+var DefaultLbtPolicy = rfm9x.DefaultLbtPolicy
+
+// ChannelActivity performs a Channel Activity Detection and returns
+// whether a LoRa preamble was detected on the channel with the current
+// modem parameters. It gives up once ctx is done, returning the context's
+// error. If the device is listening it's put back in Rx once done.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) ChannelActivity(ctx context.Context) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.core.Idle()
+
+	if err := d.core.FinishRx(ctx); err != nil {
+		return false, err
+	}
+	return d.channelActivity(ctx)
+}
+
+// channelActivity implements ChannelActivity from STDBY_RC. The
+// radio is left in STDBY_RC, which it enters on its own after a
+// CAD as per the exit mode configured through SetCadParams.
+func (d *Dev) channelActivity(ctx context.Context) (bool, error) {
+	if err := d.bus.command(OpSetStandby, StandbyRc); err != nil {
+		return false, spiError(err)
+	}
+	if err := d.clearIrqStatus(IrqCadDone | IrqCadDetected); err != nil {
+		return false, err
+	}
+	if err := d.bus.command(OpSetCad); err != nil {
+		return false, spiError(err)
+	}
+
+	for {
+		flags, err := d.irqStatus()
+		if err != nil {
+			return false, err
+		}
+		if flags&IrqCadDone != 0 {
+			return flags&IrqCadDetected != 0, d.clearIrqStatus(IrqCadDone | IrqCadDetected)
+		}
+		if err := d.core.WaitForIrq(ctx, pollInterval); err != nil {
+			d.bus.command(OpSetStandby, StandbyRc)
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package sx126x
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+)
+
+func TestChannelActivity(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		busy bool
+	}{
+		{"clear", false},
+		{"busy", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, chip := newSimDev(t, DefaultOpts, true)
+			chip.ChannelBusy = func(sx1276sim.Frame) bool { return tc.busy }
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			busy, err := d.ChannelActivity(ctx)
+			if err != nil {
+				t.Fatalf("ChannelActivity() = %v", err)
+			}
+			if busy != tc.busy {
+				t.Errorf("ChannelActivity() = %v, want %v", busy, tc.busy)
+			}
+		})
+	}
+}
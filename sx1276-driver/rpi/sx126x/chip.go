@@ -0,0 +1,77 @@
+package sx126x
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+// chip is the rfm9x.Transceiver through which the device's Core
+// drives the SX1261/2. It's kept apart from Dev so that its
+// methods don't end up in the device's API.
+type chip struct {
+	d *Dev
+}
+
+func (c chip) StartRx() error {
+	return c.d.startRx(RxContinuous)
+}
+
+func (c chip) Standby() {
+	c.d.standby()
+}
+
+// PickUp accounts for and drops headers with a wrong CRC
+// until a packet arrives.
+func (c chip) PickUp() (Packet, bool, error) {
+	flags, err := c.d.irqStatus()
+	if err != nil {
+		return Packet{}, false, err
+	}
+	if flags&IrqRxDone == 0 {
+		if flags&IrqHeaderErr != 0 {
+			atomic.AddUint64(&c.d.stats.HeaderErrors, 1)
+			c.d.log.warn("received a header with a wrong CRC")
+			return Packet{}, false, c.d.clearIrqStatus(IrqHeaderErr)
+		}
+		return Packet{}, false, nil
+	}
+	return c.d.pickUp(flags, nil)
+}
+
+// Receiving checks whether a valid header has been received. In
+// implicit header mode there's no header to flag, so it checks whether
+// a preamble has been detected instead.
+func (c chip) Receiving() (bool, error) {
+	flags, err := c.d.irqStatus()
+	if err != nil {
+		return false, err
+	}
+	if c.d.conf.ImplicitHeader {
+		return flags&(IrqHeaderValid|IrqPreambleDetected) != 0, nil
+	}
+	return flags&IrqHeaderValid != 0, nil
+}
+
+func (c chip) ChannelActivity(ctx context.Context) (bool, error) {
+	return c.d.channelActivity(ctx)
+}
+
+func (c chip) TimeOnAir(n int) (time.Duration, error) {
+	return TimeOnAir(c.d.conf, n-HeaderLength), nil
+}
+
+func (c chip) CheckHealth() error {
+	return c.d.checkHealth()
+}
+
+func (c chip) Recover() error {
+	return c.d.recover()
+}
+
+// IrqPin returns DIO1, which every IRQ we wait on is routed to.
+func (c chip) IrqPin() (gpio.PinIO, time.Duration) {
+	return c.d.dio1Pin, 0
+}
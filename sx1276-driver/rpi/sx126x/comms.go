@@ -0,0 +1,405 @@
+package sx126x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// The errors returned by the device are those of rfm9x, so that
+// callers can handle both kinds of radios alike. Check rfm9x for
+// the meaning of each of them.
+var (
+	ErrTxTimeout      = rfm9x.ErrTxTimeout
+	ErrRxTimeout      = rfm9x.ErrRxTimeout
+	ErrEmptyPacket    = rfm9x.ErrEmptyPacket
+	ErrCRC            = rfm9x.ErrCRC
+	ErrShortPacket    = rfm9x.ErrShortPacket
+	ErrPayloadTooLong = rfm9x.ErrPayloadTooLong
+	ErrInvalidHeader  = rfm9x.ErrInvalidHeader
+	ErrPayloadLength  = rfm9x.ErrPayloadLength
+	ErrChannelBusy    = rfm9x.ErrChannelBusy
+	ErrDutyCycle      = rfm9x.ErrDutyCycle
+	ErrListening      = rfm9x.ErrListening
+	ErrModem          = rfm9x.ErrModem
+	ErrSPI            = rfm9x.ErrSPI
+	ErrUnhealthy      = rfm9x.ErrUnhealthy
+)
+
+// spiError wraps err so that it matches ErrSPI.
+func spiError(err error) error {
+	return fmt.Errorf("%w: %v", ErrSPI, err)
+}
+
+// Send transmits the data provided on data to the configured
+// destination. The radio will be transitioned to Tx mode and then
+// returned back to STDBY_RC once the transmission is finished. The call
+// blocks until the transmission finishes: use SendContext to bound the wait.
+// It returns any errors triggered by the underlying SPI
+// transactions.
+func (d *Dev) Send(data []byte) error {
+	return d.SendContext(context.Background(), data)
+}
+
+// SendContext transmits the data provided on data just like Send
+// does, but gives up once ctx is done, in which case ErrTxTimeout
+// is returned. The radio is returned to STDBY_RC with its IRQ flags
+// cleared on every exit path. Errors raised by the underlying SPI
+// transactions match ErrSPI.
+func (d *Dev) SendContext(ctx context.Context, data []byte) error {
+	return d.SendTo(ctx, d.destination, data)
+}
+
+// SendTo transmits data to the node whose address is to
+// just like SendContext does.
+func (d *Dev) SendTo(ctx context.Context, to byte, data []byte) error {
+	return d.SendHeader(ctx, Header{To: to, ID: d.nextID()}, data)
+}
+
+// SendHeader transmits data behind the provided RadioHead header
+// just like SendContext does. The header's From field is always
+// overwritten with the device's address, but its ID and Flags
+// are sent as they are, which lets upper layers manage them.
+// If the device is listening it's put back in Rx once done.
+// Listen-before-talk, duty cycle limits and implicit header mode
+// work just like they do with rfm9x.Dev's SendHeader.
+func (d *Dev) SendHeader(ctx context.Context, h Header, data []byte) error {
+	if len(data) > MaxPayloadLength {
+		return fmt.Errorf("%w: %d bytes (max. %d)", ErrPayloadTooLong, len(data), MaxPayloadLength)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.core.Idle()
+
+	if err := d.core.FinishRx(ctx); err != nil {
+		if errors.Is(err, ErrSPI) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+	}
+	// The device may change whilst waiting for the channel or
+	// for airtime, so it's only checked once we're clear to send.
+	if err := d.core.ClearToSend(ctx, HeaderLength+len(data), true); err != nil {
+		return err
+	}
+	if err := d.bus.command(OpSetStandby, StandbyRc); err != nil {
+		return spiError(err)
+	}
+
+	h.From = d.address
+	payload := append(headerBytes(h), data...)
+	if d.conf.ImplicitHeader && len(payload) != int(d.conf.PayloadLength) {
+		return fmt.Errorf("%w: %d bytes (should be %d)", ErrPayloadLength, len(payload), d.conf.PayloadLength)
+	}
+
+	if err := d.bus.writeBuffer(0x00, payload); err != nil {
+		return spiError(err)
+	}
+	d.log.debug("wrote the buffer", "payload", payload, "length", len(payload), "header", h)
+
+	if err := d.setPacketParams(byte(len(payload))); err != nil {
+		return spiError(err)
+	}
+	if err := d.clearIrqStatus(IrqAll); err != nil {
+		return err
+	}
+	// No timeout: the transmission lasts for as long as it needs to.
+	if err := d.bus.command(OpSetTx, 0x00, 0x00, 0x00); err != nil {
+		return spiError(err)
+	}
+
+	for {
+		flags, err := d.irqStatus()
+		if err != nil {
+			return err
+		}
+		if flags&IrqTxDone != 0 {
+			break
+		}
+		d.log.debug("waiting for TxDone")
+		if err := d.core.WaitForIrq(ctx, pollInterval); err != nil {
+			return fmt.Errorf("%w: %v", ErrTxTimeout, err)
+		}
+	}
+	d.log.debug("the packet is out")
+
+	return nil
+}
+
+// Receive listens for an incoming packet and returns its payload.
+// The radio is transitioned to Rx mode and then returned to STDBY_RC
+// once a packet arrives or the timeout expires. Between checks of
+// the RxDone flag we block for wait, or until DIO1 raises if a pin
+// has been configured for it. A timeout of 0 waits forever.
+// Returned errors can be matched just like those of ReceiveContext.
+func (d *Dev) Receive(wait, timeout time.Duration) ([]byte, error) {
+	ctx := context.Background()
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	p, err := d.receive(ctx, wait, nil)
+	return p.Payload, err
+}
+
+// ReceiveContext listens for an incoming packet and returns its
+// payload, giving up once ctx is done. The radio is returned to
+// STDBY_RC with its IRQ flags cleared on every exit path.
+// Returned errors match ErrRxTimeout, ErrEmptyPacket, ErrShortPacket,
+// ErrCRC, ErrListening or ErrSPI. Under CrcPolicyFlag packets with a
+// wrong CRC are returned along with an error matching ErrCRC. Note the
+// SX1261/2 doesn't tell whether a packet carried a CRC at all, so
+// packets sent without one can't be told apart.
+func (d *Dev) ReceiveContext(ctx context.Context) ([]byte, error) {
+	p, err := d.receive(ctx, pollInterval, nil)
+	return p.Payload, err
+}
+
+// receive implements Receive, ReceiveContext, ReceivePacket and
+// ReceivePacketInto, polling the IRQ flags every wait when no DIO1
+// pin is available. Packets addressed to other nodes are dropped
+// without leaving Rx. If buf isn't nil packets are read into it.
+func (d *Dev) receive(ctx context.Context, wait time.Duration, buf []byte) (Packet, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core.Listening() {
+		return Packet{}, ErrListening
+	}
+
+	defer d.standby()
+
+	d.log.debug("listening for a packet")
+	if err := d.startRx(RxContinuous); err != nil {
+		return Packet{}, err
+	}
+
+	for {
+		flags, err := d.waitForRxDone(ctx, wait)
+		if err != nil {
+			return Packet{}, err
+		}
+
+		p, ok, err := d.pickUp(flags, buf)
+		if !ok && err == nil {
+			continue
+		}
+		return p, err
+	}
+}
+
+// ReceiveSingle opens a single reception window lasting for the
+// configured symbol timeout (check Config.SymbolTimeout) and returns
+// the packet received within it along with its link metadata. If a
+// packet's header shows up within the window the radio keeps receiving
+// until the packet is over. The window also closes on packets addressed
+// to other nodes. It returns an error matching ErrRxTimeout if no packet
+// for us arrives in time or ctx is done first: other errors are just
+// like those of ReceiveContext.
+func (d *Dev) ReceiveSingle(ctx context.Context) (Packet, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core.Listening() {
+		return Packet{}, ErrListening
+	}
+
+	defer d.standby()
+
+	window := time.Duration(d.conf.SymbolTimeout) * sx1276.SymbolTime(d.conf)
+	steps := uint32(window / RtcStep)
+	if steps == 0 {
+		steps = 1
+	}
+
+	d.log.debug("opening a reception window", "window", window)
+	if err := d.startRx(steps); err != nil {
+		return Packet{}, err
+	}
+
+	// Unlike the SX1276, the chip signals the end of the window
+	// on DIO1, so there's no need to check on it ourselves.
+	flags, err := d.waitForRxDone(ctx, pollInterval)
+	if err != nil {
+		return Packet{}, err
+	}
+
+	p, ok, err := d.pickUp(flags, nil)
+	if !ok && err == nil {
+		return Packet{}, fmt.Errorf("%w: the packet was addressed to someone else", ErrRxTimeout)
+	}
+	return p, err
+}
+
+// startRx clears the IRQ flags and transitions the radio to Rx,
+// either continuously or for the number of RTC steps in timeout.
+// It returns any errors raised by the underlying SPI transactions.
+func (d *Dev) startRx(timeout uint32) error {
+	if err := d.setPacketParams(d.rxLength()); err != nil {
+		return spiError(err)
+	}
+	if err := d.clearIrqStatus(IrqAll); err != nil {
+		return err
+	}
+	if err := d.bus.command(OpSetRx, byte(timeout>>16), byte(timeout>>8), byte(timeout)); err != nil {
+		return spiError(err)
+	}
+	return nil
+}
+
+// pickUp retrieves the packet signalled by flags and clears the IRQ
+// flags so that the next one can be detected whilst staying in Rx.
+// The returned boolean is true if the packet is to be handed to the
+// caller, which includes those flagged under CrcPolicyFlag. Packets
+// addressed to other nodes are dropped without raising any errors.
+// The packet is read into buf unless it's nil.
+func (d *Dev) pickUp(flags uint16, buf []byte) (Packet, bool, error) {
+	d.core.Heard()
+	p, err := d.readPacket(flags, buf)
+	if err := d.clearIrqStatus(IrqAll); err != nil {
+		return Packet{}, false, err
+	}
+
+	if err != nil {
+		flagged := errors.Is(err, ErrCRC) && d.crcPolicy == CrcPolicyFlag
+		return p, flagged, err
+	}
+
+	if !d.accepts(p.Header) {
+		atomic.AddUint64(&d.stats.Filtered, 1)
+		d.log.debug("dropping a packet addressed to someone else", "header", p.Header)
+		return Packet{}, false, nil
+	}
+
+	atomic.AddUint64(&d.stats.RxPackets, 1)
+	return p, true, nil
+}
+
+// waitForRxDone blocks until the RxDone IRQ flag is set or ctx is
+// done, polling the flags every wait. It returns the IRQ flags at
+// the time the packet arrived. It gives up as soon as Timeout is
+// set. Headers received with a wrong CRC are accounted for and
+// dropped, as they're signalled without RxDone.
+func (d *Dev) waitForRxDone(ctx context.Context, wait time.Duration) (uint16, error) {
+	for {
+		flags, err := d.irqStatus()
+		if err != nil {
+			return 0, err
+		}
+		if flags&IrqRxDone != 0 {
+			return flags, nil
+		}
+		if flags&IrqTimeout != 0 {
+			return 0, fmt.Errorf("%w: no packet within the reception window", ErrRxTimeout)
+		}
+		if flags&IrqHeaderErr != 0 {
+			atomic.AddUint64(&d.stats.HeaderErrors, 1)
+			d.log.warn("received a header with a wrong CRC")
+			if err := d.clearIrqStatus(IrqHeaderErr); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		d.log.debug("waiting for RxDone", "wait", wait)
+		if err := d.core.WaitForIrq(ctx, wait); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrRxTimeout, err)
+		}
+	}
+}
+
+// readPacket retrieves the packet the radio has just
+// received along with its metadata. The IRQ flags read
+// when the reception was detected are provided on flags.
+// The packet is read into buf or into a freshly allocated
+// slice if buf is nil.
+func (d *Dev) readPacket(flags uint16, buf []byte) (Packet, error) {
+	p := Packet{Time: time.Now()}
+
+	var crcErr error
+	if flags&IrqCrcErr != 0 {
+		atomic.AddUint64(&d.stats.CrcErrors, 1)
+		d.log.warn("received a packet with a wrong CRC")
+		crcErr = fmt.Errorf("%w: the payload CRC doesn't match", ErrCRC)
+		if d.crcPolicy == CrcPolicyReject {
+			return Packet{}, crcErr
+		}
+	}
+
+	if err := d.readPacketMeta(&p); err != nil {
+		return Packet{}, err
+	}
+
+	var rx_status [2]byte
+	if _, err := d.bus.query(OpGetRxBufferStatus, nil, rx_status[:]); err != nil {
+		return Packet{}, spiError(err)
+	}
+	length, start := int(rx_status[0]), rx_status[1]
+
+	switch {
+	case length == 0:
+		return Packet{}, ErrEmptyPacket
+	case buf != nil && length > len(buf):
+		return Packet{}, fmt.Errorf("%w: packet doesn't fit into a %d bytes buffer", io.ErrShortBuffer, len(buf))
+	}
+
+	var pkt []byte
+	if buf != nil {
+		pkt = buf[:length]
+	} else {
+		pkt = make([]byte, length)
+	}
+	if err := d.bus.readBuffer(start, pkt); err != nil {
+		return Packet{}, spiError(err)
+	}
+
+	// Boxing the arguments allocates even when nothing's logged.
+	if d.log.enabled(LogLevelDebug) {
+		d.log.debug("read the buffer", "packet", pkt, "length", len(pkt), "rssi_dbm", p.RssiDBm, "snr_db", p.SnrDB)
+	}
+
+	var err error
+	if p.Header, p.Payload, err = parseHeader(pkt); err != nil {
+		return Packet{}, err
+	}
+
+	return p, crcErr
+}
+
+// irqStatus returns the IRQ flags that are currently set.
+// Errors raised by the underlying SPI transaction match ErrSPI.
+func (d *Dev) irqStatus() (uint16, error) {
+	var irq [2]byte
+	if _, err := d.bus.query(OpGetIrqStatus, nil, irq[:]); err != nil {
+		return 0, spiError(err)
+	}
+	return uint16(irq[0])<<8 | uint16(irq[1]), nil
+}
+
+// clearIrqStatus clears the IRQ flags in mask. Errors
+// raised by the underlying SPI transaction match ErrSPI.
+func (d *Dev) clearIrqStatus(mask uint16) error {
+	if err := d.bus.command(OpClearIrqStatus, byte(mask>>8), byte(mask)); err != nil {
+		return spiError(err)
+	}
+	return nil
+}
+
+// standby returns the radio to STDBY_RC and clears every IRQ flag.
+// It's meant to be deferred so that the radio is left in a known
+// state no matter how a transmission or reception ends.
+func (d *Dev) standby() {
+	if err := d.bus.command(OpSetStandby, StandbyRc); err != nil {
+		d.log.warn("couldn't return the radio to Standby", "err", err)
+	}
+	if err := d.clearIrqStatus(IrqAll); err != nil {
+		d.log.warn("couldn't clear the IRQ flags", "err", err)
+	}
+}
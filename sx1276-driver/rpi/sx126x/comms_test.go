@@ -0,0 +1,46 @@
+package sx126x
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx126x/sx126xsim"
+)
+
+// newSimDev opens a device with options o over a fresh simulated
+// chip, waiting on its DIO1 pin if dio1 is set. Transmissions are
+// instant so that tests don't wait for their time on air.
+func newSimDev(t *testing.T, o Opts, dio1 bool) (*Dev, *sx126xsim.Chip) {
+	t.Helper()
+
+	chip := sx126xsim.New()
+	chip.Instant = true
+	o.ResetPin, o.BusyPin = chip.ResetPin(), chip.Busy()
+	if dio1 {
+		o.DIO1Pin = chip.DIO1()
+	}
+	d, err := New(chip, &o)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return d, chip
+}
+
+func TestReceiveSingleTimeout(t *testing.T) {
+	d, chip := newSimDev(t, DefaultOpts, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		for !chip.InjectTimeout() && ctx.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if _, err := d.ReceiveSingle(ctx); !errors.Is(err, ErrRxTimeout) {
+		t.Fatalf("ReceiveSingle() = %v, want %v", err, ErrRxTimeout)
+	}
+}
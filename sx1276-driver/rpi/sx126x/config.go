@@ -0,0 +1,251 @@
+package sx126x
+
+import (
+	"fmt"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Config gathers every LoRa modem parameter of the radio. It's
+// shared with rfm9x so that both kinds of radios can be configured
+// identically from a single place, but its fields are validated
+// against what the SX1261/2 supports: check Validate.
+type Config = rfm9x.Config
+
+// DefaultConfig holds the modem parameters New configures
+// unless told otherwise. They match those of rfm9x.
+var DefaultConfig = rfm9x.DefaultConfig
+
+// Validate checks whether c describes a configuration the SX1261/2
+// supports, which differs from what the SX1276 does in a few ways:
+//   - The carrier frequency must lie between 150 and 960 MHz.
+//   - The spreading factor goes from 5 to 12 and neither SF5
+//     nor SF6 require implicit header mode.
+//   - HighPower selects the SX1262's PA, whose output power goes up
+//     to 22 dBm. Otherwise, the SX1261's PA is used, going up to 14.
+//
+// Agc isn't taken into account, as the SX1261/2 always manages the
+// gain on its own. It returns an error describing the first problem
+// found.
+func Validate(c Config) error {
+	if c.FrequencyHz < MinFrequencyHz || c.FrequencyHz > MaxFrequencyHz {
+		return fmt.Errorf("frequency must belong to the [150, 960] MHz interval: %d Hz", c.FrequencyHz)
+	}
+
+	if c.PreambleLength < 1 {
+		return fmt.Errorf("preamble must be at least 1 symbol long: %d", c.PreambleLength)
+	}
+
+	if _, ok := bwHzToCode[c.BandwidthHz]; !ok {
+		return fmt.Errorf("unsupported bandwidth: %d Hz", c.BandwidthHz)
+	}
+
+	if c.CodingRate < 5 || c.CodingRate > 8 {
+		return fmt.Errorf("incorrect coding rate id: %d", c.CodingRate)
+	}
+
+	if c.SpreadingFactor < 5 || c.SpreadingFactor > 12 {
+		return fmt.Errorf("incorrect spreading factor: %d", c.SpreadingFactor)
+	}
+
+	if c.ImplicitHeader && c.PayloadLength == 0 {
+		return fmt.Errorf("implicit header mode requires a fixed payload length")
+	}
+
+	if c.SymbolTimeout < 1 || c.SymbolTimeout > sx1276.MaxSymbolTimeout {
+		return fmt.Errorf("symbol timeout must belong to the [1, 1023] interval: %d", c.SymbolTimeout)
+	}
+
+	if c.HighPower && c.TxPowerDbm > MaxHpPowerDbm {
+		return fmt.Errorf("incorrect tx power (should be at most %d): %d", MaxHpPowerDbm, c.TxPowerDbm)
+	}
+	if !c.HighPower && c.TxPowerDbm > MaxLpPowerDbm {
+		return fmt.Errorf("incorrect tx power (should be at most %d): %d", MaxLpPowerDbm, c.TxPowerDbm)
+	}
+
+	return nil
+}
+
+// ApplyConfig validates and then configures every modem parameter
+// in c. If c isn't valid nothing is configured at all. The radio is
+// left in STDBY_RC. In implicit header mode the fixed payload length
+// must leave room for the RadioHead header: the data sent through Send
+// must then be exactly PayloadLength - HeaderLength bytes long. It
+// fails with ErrListening whilst listening.
+// It returns any errors raised by the validation or the underlying
+// SPI transactions, the latter matching ErrSPI.
+func (d *Dev) ApplyConfig(c Config) error {
+	if err := Validate(c); err != nil {
+		return err
+	}
+	if c.ImplicitHeader && int(c.PayloadLength) < HeaderLength {
+		return fmt.Errorf("the payload length must make room for the %d bytes RadioHead header: %d", HeaderLength, c.PayloadLength)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.core.Listening() {
+		return ErrListening
+	}
+
+	if err := d.applyConfig(c); err != nil {
+		return spiError(err)
+	}
+	return nil
+}
+
+// applyConfig implements ApplyConfig, including the workarounds
+// in section 15 of the datasheet, and records c as the configuration
+// last applied. It returns any errors raised by the underlying SPI
+// transactions.
+func (d *Dev) applyConfig(c Config) error {
+	if err := d.bus.command(OpSetStandby, StandbyRc); err != nil {
+		return err
+	}
+
+	frf := uint32((uint64(c.FrequencyHz) << 25) / OscFreqHz)
+	if err := d.bus.command(OpSetRfFrequency, byte(frf>>24), byte(frf>>16), byte(frf>>8), byte(frf)); err != nil {
+		return err
+	}
+	// The image is calibrated over the 4 MHz steps around the carrier.
+	// Check section 9.2.1 on the datasheet.
+	f1, f2 := (c.FrequencyHz-4000000)/4000000, (c.FrequencyHz+4000000+3999999)/4000000
+	if err := d.bus.command(OpCalibrateImage, byte(f1), byte(f2)); err != nil {
+		return err
+	}
+
+	// Check section 13.1.14 on the datasheet for the
+	// optimal settings of each power amplifier.
+	pa := []byte{0x04, 0x07, 0x00, 0x01}
+	if !c.HighPower {
+		pa = []byte{0x04, 0x00, 0x01, 0x01}
+	}
+	if err := d.bus.command(OpSetPaConfig, pa...); err != nil {
+		return err
+	}
+	// The output power is ramped up over 200 us.
+	if err := d.bus.command(OpSetTxParams, byte(int8(c.TxPowerDbm)), 0x04); err != nil {
+		return err
+	}
+	if c.HighPower {
+		// Workaround 15.2: better resistance to antenna mismatch.
+		if err := d.setRegisterBits(RegTxClampConfig, 0x1E, 0x1E); err != nil {
+			return err
+		}
+	}
+
+	var ldro byte
+	if sx1276.NeedsLdro(c) {
+		ldro = 0x01
+	}
+	if err := d.bus.command(OpSetModulationParams, c.SpreadingFactor, bwHzToCode[c.BandwidthHz], c.CodingRate-4, ldro); err != nil {
+		return err
+	}
+	// Workaround 15.1: modulation quality at 500 kHz.
+	tx_mod := byte(0x04)
+	if c.BandwidthHz == 500000 {
+		tx_mod = 0x00
+	}
+	if err := d.setRegisterBits(RegTxModulation, 0x04, tx_mod); err != nil {
+		return err
+	}
+
+	d.conf = c
+	if err := d.setPacketParams(d.rxLength()); err != nil {
+		return err
+	}
+	// Workaround 15.4: optimised inverted IQ operation. We
+	// always use the standard IQ setup.
+	if err := d.setRegisterBits(RegIqPolarity, 0x04, 0x04); err != nil {
+		return err
+	}
+
+	// The sync word's nibbles are spread across both registers
+	// so that 0x12 becomes 0x1424, just like Semtech does.
+	sw_msb, sw_lsb := c.SyncWord&0xF0|0x04, c.SyncWord<<4|0x04
+	if err := d.bus.writeRegister(RegLoRaSyncWordMsb, sw_msb, sw_lsb); err != nil {
+		return err
+	}
+
+	// A CAD lasting for 2 symbols with the detection thresholds
+	// recommended by Semtech's application note AN1200.48.
+	return d.bus.command(OpSetCadParams, 0x01, c.SpreadingFactor+13, 10, 0x00, 0x00, 0x00, 0x00)
+}
+
+// setPacketParams configures the packet parameters in d.conf
+// for packets carrying length bytes of payload. The lock must be
+// held. It returns any errors raised by the underlying SPI
+// transaction.
+func (d *Dev) setPacketParams(length byte) error {
+	var implicit, crc byte
+	if d.conf.ImplicitHeader {
+		implicit = 0x01
+	}
+	if d.conf.Crc {
+		crc = 0x01
+	}
+	pre := d.conf.PreambleLength
+	return d.bus.command(OpSetPacketParams, byte(pre>>8), byte(pre), implicit, length, crc, 0x00)
+}
+
+// rxLength returns the payload length to configure on reception:
+// the fixed one in implicit header mode and the largest one (which
+// the chip ignores) otherwise. The lock must be held.
+func (d *Dev) rxLength() byte {
+	if d.conf.ImplicitHeader {
+		return d.conf.PayloadLength
+	}
+	return 0xFF
+}
+
+// setRegisterBits replaces the bits of the register at addr
+// selected by mask with those in data. It returns any errors
+// raised by the underlying SPI transactions.
+func (d *Dev) setRegisterBits(addr uint16, mask, data byte) error {
+	var reg [1]byte
+	if err := d.bus.readRegister(addr, reg[:]); err != nil {
+		return err
+	}
+	return d.bus.writeRegister(addr, reg[0]&^mask|data&mask)
+}
+
+// ReadConfig returns the live configuration. The SX1261/2 can't report
+// most modem parameters back, so those are the ones last applied, but
+// the sync word is read back from the chip and ErrModem is returned if
+// it isn't set up for LoRa anymore, which is what happens when it's
+// reset behind our back.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) ReadConfig() (Config, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.readConfig()
+}
+
+// readConfig implements ReadConfig. The device's lock must be held.
+func (d *Dev) readConfig() (Config, error) {
+	var pkt_type [1]byte
+	if _, err := d.bus.query(OpGetPacketType, nil, pkt_type[:]); err != nil {
+		return Config{}, spiError(err)
+	}
+	if pkt_type[0] != PacketTypeLoRa {
+		return Config{}, fmt.Errorf("%w: the chip's packet type is %#02x", ErrModem, pkt_type[0])
+	}
+
+	var sw [2]byte
+	if err := d.bus.readRegister(RegLoRaSyncWordMsb, sw[:]); err != nil {
+		return Config{}, spiError(err)
+	}
+
+	c := d.conf
+	c.SyncWord = sw[0]&0xF0 | sw[1]>>4
+	return c, nil
+}
+
+// The LoRa sync words, just like those of rfm9x.
+const (
+	SyncWordPrivate = rfm9x.SyncWordPrivate
+	SyncWordPublic  = rfm9x.SyncWordPublic
+)
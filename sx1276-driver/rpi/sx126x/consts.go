@@ -0,0 +1,162 @@
+package sx126x
+
+import "time"
+
+type opcode byte
+
+const (
+	// Command opcodes. Check section 13 on the datasheet
+	// for the parameters each of them takes.
+	OpSetSleep              opcode = 0x84
+	OpSetStandby            opcode = 0x80
+	OpSetFs                 opcode = 0xC1
+	OpSetTx                 opcode = 0x83
+	OpSetRx                 opcode = 0x82
+	OpStopTimerOnPreamble   opcode = 0x9F
+	OpSetCad                opcode = 0xC5
+	OpSetRegulatorMode      opcode = 0x96
+	OpCalibrate             opcode = 0x89
+	OpCalibrateImage        opcode = 0x98
+	OpSetPaConfig           opcode = 0x95
+	OpSetRxTxFallbackMode   opcode = 0x93
+	OpWriteRegister         opcode = 0x0D
+	OpReadRegister          opcode = 0x1D
+	OpWriteBuffer           opcode = 0x0E
+	OpReadBuffer            opcode = 0x1E
+	OpSetDioIrqParams       opcode = 0x08
+	OpGetIrqStatus          opcode = 0x12
+	OpClearIrqStatus        opcode = 0x02
+	OpSetDio2AsRfSwitchCtrl opcode = 0x9D
+	OpSetDio3AsTcxoCtrl     opcode = 0x97
+	OpSetRfFrequency        opcode = 0x86
+	OpSetPacketType         opcode = 0x8A
+	OpGetPacketType         opcode = 0x11
+	OpSetTxParams           opcode = 0x8E
+	OpSetModulationParams   opcode = 0x8B
+	OpSetPacketParams       opcode = 0x8C
+	OpSetCadParams          opcode = 0x88
+	OpSetBufferBaseAddress  opcode = 0x8F
+	OpSetLoRaSymbNumTimeout opcode = 0xA0
+	OpGetStatus             opcode = 0xC0
+	OpGetRssiInst           opcode = 0x15
+	OpGetRxBufferStatus     opcode = 0x13
+	OpGetPacketStatus       opcode = 0x14
+	OpGetDeviceErrors       opcode = 0x17
+	OpClearDeviceErrors     opcode = 0x07
+	OpGetStats              opcode = 0x10
+	OpResetStats            opcode = 0x00
+	OpSetTxContinuousWave   opcode = 0xD1
+	OpSetTxInfinitePreamble opcode = 0xD2
+	OpSetRxDutyCycle        opcode = 0x94
+)
+
+const (
+	// Register addresses. Check section 12 on the datasheet.
+	RegLoRaSyncWordMsb uint16 = 0x0740
+	RegLoRaSyncWordLsb uint16 = 0x0741
+	RegIqPolarity      uint16 = 0x0736
+	RegTxModulation    uint16 = 0x0889
+	RegTxClampConfig   uint16 = 0x08D8
+
+	// Masks for the IRQ flags. Check table 13-29 on the datasheet.
+	IrqTxDone           uint16 = 1 << 0
+	IrqRxDone           uint16 = 1 << 1
+	IrqPreambleDetected uint16 = 1 << 2
+	IrqSyncWordValid    uint16 = 1 << 3
+	IrqHeaderValid      uint16 = 1 << 4
+	IrqHeaderErr        uint16 = 1 << 5
+	IrqCrcErr           uint16 = 1 << 6
+	IrqCadDone          uint16 = 1 << 7
+	IrqCadDetected      uint16 = 1 << 8
+	IrqTimeout          uint16 = 1 << 9
+	IrqAll              uint16 = 0x03FF
+
+	// Packet types taken by SetPacketType.
+	PacketTypeGfsk byte = 0x00
+	PacketTypeLoRa byte = 0x01
+
+	// Standby modes taken by SetStandby.
+	StandbyRc   byte = 0x00
+	StandbyXosc byte = 0x01
+
+	// Chip modes reported on bits 6:4 of the status byte.
+	// Check table 13-76 on the datasheet.
+	ChipModeStandbyRc   byte = 0x2
+	ChipModeStandbyXosc byte = 0x3
+	ChipModeFs          byte = 0x4
+	ChipModeRx          byte = 0x5
+	ChipModeTx          byte = 0x6
+
+	// Command statuses reported on bits 3:1 of the status byte.
+	CmdStatusDataAvailable byte = 0x2
+	CmdStatusTimeout       byte = 0x3
+	CmdStatusError         byte = 0x4
+	CmdStatusFailure       byte = 0x5
+	CmdStatusTxDone        byte = 0x6
+
+	// Timeouts taken by SetRx to listen continuously or until a
+	// packet arrives. Other values are in steps of RtcStep.
+	RxContinuous uint32 = 0xFFFFFF
+	RxSingle     uint32 = 0x000000
+
+	// Period of the RTC timing Tx and Rx timeouts.
+	RtcStep = 15625 * time.Nanosecond
+
+	// Frequency of the crystal oscillator. Check section 3 on the datasheet
+	OscFreqHz uint64 = 32000000
+
+	// Range of carrier frequencies the SX1261/2 can be tuned to.
+	// Check table 3-2 on the datasheet.
+	MinFrequencyHz uint = 150000000
+	MaxFrequencyHz uint = 960000000
+
+	// Largest output power of each power amplifier.
+	MaxHpPowerDbm uint = 22
+	MaxLpPowerDbm uint = 14
+
+	// Size of the data buffer, which bounds the length of packets.
+	BufferSize int = 256
+
+	// Interval between consecutive IRQ flag checks when polling over SPI.
+	pollInterval = 10 * time.Millisecond
+
+	// Interval between consecutive checks of the BUSY line.
+	busyPollInterval = 50 * time.Microsecond
+
+	// Longest the chip may stay busy after a command, which
+	// is bounded by the calibration and the TCXO start up.
+	busyTimeout = 100 * time.Millisecond
+
+	// Time given to the TCXO to settle in steps of RtcStep (5 ms).
+	tcxoDelay uint32 = 320
+)
+
+var (
+	// bwHzToCode maps the bandwidths the LoRa modem
+	// supports to their SetModulationParams codes.
+	bwHzToCode = map[uint]byte{
+		7800:   0x00,
+		10400:  0x08,
+		15600:  0x01,
+		20800:  0x09,
+		31250:  0x02,
+		41700:  0x0A,
+		62500:  0x03,
+		125000: 0x04,
+		250000: 0x05,
+		500000: 0x06,
+	}
+
+	// tcxoMillivoltsToCode maps the voltages DIO3 can supply
+	// the TCXO with to their SetDIO3AsTCXOCtrl codes.
+	tcxoMillivoltsToCode = map[uint]byte{
+		1600: 0x0,
+		1700: 0x1,
+		1800: 0x2,
+		2200: 0x3,
+		2400: 0x4,
+		2700: 0x5,
+		3000: 0x6,
+		3300: 0x7,
+	}
+)
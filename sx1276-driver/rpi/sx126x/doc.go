@@ -0,0 +1,14 @@
+/*
+Package sx126x implements a driver for radios based on Semtech's
+SX1261/2 transceivers, such as Waveshare's SX1262 HATs or Ebyte's
+E22 modules. It exposes the same API as rfm9x and sends RadioHead
+packets just like it does, so both kinds of radios can share a
+network. Only the LoRa modem is supported: there's no FSK/OOK
+modem nor frequency hopping.
+
+Useful resources:
+
+	Datasheet: https://www.semtech.com/products/wireless-rf/lora-connect/sx1262
+	Reference C implementation: https://github.com/Lora-net/sx126x_driver
+*/
+package sx126x
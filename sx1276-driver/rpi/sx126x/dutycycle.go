@@ -0,0 +1,60 @@
+package sx126x
+
+import (
+	"math"
+	"time"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// DutyCyclePolicy bounds the fraction of time the device spends
+// transmitting just like it does for rfm9x.
+type DutyCyclePolicy = rfm9x.DutyCyclePolicy
+
+// Crc_policy controls how packets failing the payload CRC are handled.
+type Crc_policy = rfm9x.Crc_policy
+
+const (
+	CrcPolicyReject = rfm9x.CrcPolicyReject
+	CrcPolicyFlag   = rfm9x.CrcPolicyFlag
+)
+
+// TimeOnAir returns how long it takes to send payloadLen bytes of
+// data with the modem parameters in c on an SX1261/2. The RadioHead
+// header is accounted for, so payloadLen is just the length of the
+// data handed to Send. It matches rfm9x.TimeOnAir except for SF5 and
+// SF6, whose packets are laid out differently as per section 6.1.4
+// on the datasheet.
+func TimeOnAir(c Config, payloadLen int) time.Duration {
+	n := HeaderLength + payloadLen
+	if c.SpreadingFactor >= 7 {
+		return sx1276.TimeOnAir(c, n)
+	}
+	if c.BandwidthHz == 0 || c.SpreadingFactor == 0 || c.CodingRate < 5 {
+		return 0
+	}
+
+	sf := float64(c.SpreadingFactor)
+	t_sym := math.Exp2(sf) / float64(c.BandwidthHz)
+
+	var crc, h float64
+	if c.Crc {
+		crc = 16
+	}
+	if !c.ImplicitHeader {
+		h = 20
+	}
+
+	n_payload := math.Ceil(math.Max(8*float64(n)+crc-4*sf+h, 0)/(4*sf)) * float64(c.CodingRate)
+	n_symbols := float64(c.PreambleLength) + 6.25 + 8 + n_payload
+
+	return time.Duration(n_symbols * t_sym * float64(time.Second))
+}
+
+// Airtime returns how long the device has spent transmitting
+// over the duty cycle's window, which is an hour by default.
+// It's safe to call it concurrently with Send and Receive.
+func (d *Dev) Airtime() time.Duration {
+	return d.core.Airtime()
+}
@@ -0,0 +1,61 @@
+package sx126x
+
+import (
+	"testing"
+	"time"
+)
+
+// The expected values follow section 6.1.4 on the datasheet. The
+// RadioHead header adds HeaderLength bytes to every payload.
+func TestTimeOnAir(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Config
+		n    int
+		want time.Duration
+	}{
+		{
+			name: "SF5 125 kHz CR 4/5",
+			c:    Config{SpreadingFactor: 5, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    6,
+			want: 12096 * time.Microsecond,
+		},
+		{
+			name: "SF5 250 kHz CR 4/6 with a long payload",
+			c:    Config{SpreadingFactor: 5, BandwidthHz: 250000, CodingRate: 6, PreambleLength: 8, Crc: true},
+			n:    60,
+			want: 23584 * time.Microsecond,
+		},
+		{
+			name: "SF6 125 kHz CR 4/5",
+			c:    Config{SpreadingFactor: 6, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    6,
+			want: 21632 * time.Microsecond,
+		},
+		{
+			name: "SF6 500 kHz CR 4/8 implicit header without CRC",
+			c:    Config{SpreadingFactor: 6, BandwidthHz: 500000, CodingRate: 8, PreambleLength: 12, ImplicitHeader: true},
+			n:    6,
+			want: 6432 * time.Microsecond,
+		},
+		{
+			name: "SF7 125 kHz CR 4/5 as on the SX1276",
+			c:    Config{SpreadingFactor: 7, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    6,
+			want: 41216 * time.Microsecond,
+		},
+		{
+			name: "unconfigured",
+			c:    Config{},
+			n:    6,
+			want: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TimeOnAir(tc.c, tc.n)
+			if diff := got - tc.want; diff > time.Microsecond || diff < -time.Microsecond {
+				t.Errorf("TimeOnAir() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
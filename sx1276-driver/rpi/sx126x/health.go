@@ -0,0 +1,104 @@
+package sx126x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+)
+
+// HealthPolicy configures the watchdog started through Watch.
+// Check rfm9x.HealthPolicy for the details.
+type HealthPolicy = rfm9x.HealthPolicy
+
+// DefaultHealthPolicy checks the radio's health every minute.
+var DefaultHealthPolicy = rfm9x.DefaultHealthPolicy
+
+// HealthEvent reports a problem found by the watchdog
+// along with the outcome of the ensuing recovery.
+type HealthEvent = rfm9x.HealthEvent
+
+// CheckHealth checks whether the radio still is as we left it, which
+// stops being the case if it browns out and comes back in STDBY_RC with
+// its default configuration. To that end, the chip mode must be RX whilst
+// listening and either STDBY_RC or STDBY_XOSC otherwise, the LoRa packet
+// type must be selected and the sync word must match the one last applied.
+// The chip can't report the other modem parameters back. Checks wait for
+// any ongoing transmission or reception to finish.
+// It returns an error matching ErrUnhealthy describing the first
+// mismatch found or one matching ErrSPI if the underlying SPI
+// transactions fail.
+func (d *Dev) CheckHealth() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.checkHealth()
+}
+
+// checkHealth implements CheckHealth. The device's lock must be held.
+func (d *Dev) checkHealth() error {
+	status, err := d.bus.query(OpGetStatus, nil, nil)
+	if err != nil {
+		return spiError(err)
+	}
+	switch mode := (status >> 4) & 0x7; {
+	case d.core.Listening() && mode != ChipModeRx:
+		return fmt.Errorf("%w: the radio stopped listening and is in chip mode %#x", ErrUnhealthy, mode)
+	case !d.core.Listening() && mode != ChipModeStandbyRc && mode != ChipModeStandbyXosc:
+		return fmt.Errorf("%w: the idle radio is in chip mode %#x", ErrUnhealthy, mode)
+	}
+
+	c, err := d.readConfig()
+	switch {
+	case errors.Is(err, ErrModem):
+		return fmt.Errorf("%w: %v", ErrUnhealthy, err)
+	case err != nil:
+		return err
+	case c.SyncWord != d.conf.SyncWord:
+		return fmt.Errorf("%w: the radio uses sync word %#02x rather than %#02x", ErrUnhealthy, c.SyncWord, d.conf.SyncWord)
+	}
+	return nil
+}
+
+// Recover pulses the radio's reset pin, sets it up all over again and
+// applies the modem parameters last applied. If the device is listening
+// the radio is put back in RX, so listeners carry on as if nothing
+// happened save for the packets lost.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) Recover() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.recover()
+}
+
+// recover implements Recover. The device's lock must be held.
+func (d *Dev) recover() error {
+	d.log.warn("recovering the radio")
+
+	if err := d.bus.reset(); err != nil {
+		return spiError(err)
+	}
+	if err := d.setup(); err != nil {
+		return spiError(err)
+	}
+	if err := d.applyConfig(d.conf); err != nil {
+		return spiError(err)
+	}
+
+	if d.core.Listening() {
+		return d.startRx(RxContinuous)
+	}
+	return nil
+}
+
+// Watch checks the radio's health every p.Interval until ctx is done,
+// at which point the returned channel is closed. Whenever CheckHealth
+// finds a problem, or no packet has been received for longer than
+// p.RxSilence, the radio is recovered through Recover and a HealthEvent
+// is delivered on the returned channel. Events are dropped if the
+// channel's buffer is full.
+func (d *Dev) Watch(ctx context.Context, p HealthPolicy) <-chan HealthEvent {
+	return d.core.Watch(ctx, p)
+}
@@ -0,0 +1,12 @@
+package sx126x
+
+import "context"
+
+// Listen keeps the radio in continuous Rx and delivers every packet
+// addressed to us on the returned packet channel until ctx is done,
+// at which point the radio is returned to STDBY_RC and both channels
+// are closed. It behaves just like rfm9x.Dev's Listen: check it for
+// how errors and transmissions issued whilst listening are handled.
+func (d *Dev) Listen(ctx context.Context) (<-chan Packet, <-chan error) {
+	return d.core.Listen(ctx)
+}
@@ -0,0 +1,65 @@
+package sx126x
+
+import (
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"github.com/ulbios/lora/sx1276-driver/sx1276"
+)
+
+// Log_level controls how 'verbosy' a device is. It's
+// shared with rfm9x so that both drivers are set up alike.
+type Log_level = rfm9x.Log_level
+
+const (
+	LogLevelRegIO = rfm9x.LogLevelRegIO
+	LogLevelDebug = rfm9x.LogLevelDebug
+	LogLevelInfo  = rfm9x.LogLevelInfo
+	LogLevelWarn  = rfm9x.LogLevelWarn
+	LogLevelErr   = rfm9x.LogLevelErr
+)
+
+// Logger receives the messages devices log along with
+// structured fields, just like rfm9x's.
+type Logger = rfm9x.Logger
+
+// dev_logger hands the messages a device logs at or above
+// level over to out. Each device has its own.
+type dev_logger struct {
+	out   Logger
+	level Log_level
+}
+
+// newLogger returns the logger of a device named name logging
+// through out, which defaults to rfm9x.NopLogger if nil.
+func newLogger(out Logger, level Log_level, name string) *dev_logger {
+	if out == nil {
+		out = rfm9x.NopLogger
+	}
+	if name != "" {
+		out = sx1276.With(out, "device", name)
+	}
+	return &dev_logger{out: out, level: level}
+}
+
+// enabled checks whether messages at level are logged at all,
+// which lets callers skip gathering their fields otherwise.
+func (l *dev_logger) enabled(level Log_level) bool {
+	return level >= l.level && l.out != rfm9x.NopLogger
+}
+
+func (l *dev_logger) reg_io(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelRegIO) {
+		l.out.Log(LogLevelRegIO, msg, keyvals...)
+	}
+}
+
+func (l *dev_logger) debug(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelDebug) {
+		l.out.Log(LogLevelDebug, msg, keyvals...)
+	}
+}
+
+func (l *dev_logger) warn(msg string, keyvals ...interface{}) {
+	if l.enabled(LogLevelWarn) {
+		l.out.Log(LogLevelWarn, msg, keyvals...)
+	}
+}
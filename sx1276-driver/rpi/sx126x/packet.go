@@ -0,0 +1,41 @@
+package sx126x
+
+import (
+	"context"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+)
+
+// Packet represents a received packet along with the link metadata
+// the radio reported for it. It's shared with rfm9x, but FreqErrorHz
+// is always 0, as the SX1261/2 doesn't estimate it.
+type Packet = rfm9x.Packet
+
+// ReceivePacket listens for an incoming packet just like ReceiveContext
+// does, but returns it along with its link metadata.
+func (d *Dev) ReceivePacket(ctx context.Context) (Packet, error) {
+	return d.receive(ctx, pollInterval, nil)
+}
+
+// ReceivePacketInto works just like ReceivePacket, but the packet is
+// read into buf instead of a freshly allocated slice, so the returned
+// Packet's Payload aliases buf. The buffer must be able to hold the
+// whole packet, header included: MaxPayloadLength + HeaderLength bytes
+// always suffice. Packets that don't fit fail with io.ErrShortBuffer.
+func (d *Dev) ReceivePacketInto(ctx context.Context, buf []byte) (Packet, error) {
+	return d.receive(ctx, pollInterval, buf)
+}
+
+// readPacketMeta fills in the link metadata of p as reported by
+// GetPacketStatus for the last received packet. Check section
+// 13.5.3 on the datasheet. Errors raised by the underlying SPI
+// transaction match ErrSPI.
+func (d *Dev) readPacketMeta(p *Packet) error {
+	var status [3]byte
+	if _, err := d.bus.query(OpGetPacketStatus, nil, status[:]); err != nil {
+		return spiError(err)
+	}
+	p.RssiDBm = -int(status[0]) / 2
+	p.SnrDB = float64(int8(status[1])) / 4
+	return nil
+}
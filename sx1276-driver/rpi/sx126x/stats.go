@@ -0,0 +1,23 @@
+package sx126x
+
+import (
+	"sync/atomic"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+)
+
+// Stats holds per-device reception counters, just like those of
+// rfm9x. MissingCrc is always 0, as the SX1261/2 doesn't report
+// whether a packet carried a CRC.
+type Stats = rfm9x.Stats
+
+// Stats returns a snapshot of the device's reception counters.
+// It's safe to call it concurrently with Send and Receive.
+func (d *Dev) Stats() Stats {
+	return Stats{
+		RxPackets:    atomic.LoadUint64(&d.stats.RxPackets),
+		CrcErrors:    atomic.LoadUint64(&d.stats.CrcErrors),
+		HeaderErrors: atomic.LoadUint64(&d.stats.HeaderErrors),
+		Filtered:     atomic.LoadUint64(&d.stats.Filtered),
+	}
+}
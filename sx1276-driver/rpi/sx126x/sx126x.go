@@ -0,0 +1,319 @@
+package sx126x
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	rfm9x "github.com/ulbios/lora/sx1276-driver/rpi"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+	"periph.io/x/host/v3/rpi"
+)
+
+// Opts defines configurable options for the device.
+type Opts struct {
+	// BaudRateMHZ specifies the baudrate at which the SPI
+	// 'dialog' happens. This value is assumed to be provided
+	// in MegaHertz (i.e. MHz).
+	BaudrateMHz uint
+
+	// ResetPin specifies the physical GPIO pin the
+	// chip's NRESET input is connected to.
+	ResetPin gpio.PinIO
+
+	// BusyPin specifies the physical GPIO pin the chip's BUSY
+	// output is connected to. It's mandatory, as the chip
+	// can't take commands whilst it's busy.
+	BusyPin gpio.PinIO
+
+	// DIO1Pin specifies the physical GPIO pin the chip's DIO1
+	// output is connected to. When provided, the driver waits
+	// for TxDone, RxDone, CadDone and Timeout through edge
+	// detection on this pin instead of polling the IRQ flags
+	// over SPI. Leave it as nil to fall back to polling.
+	DIO1Pin gpio.PinIO
+
+	// TcxoMillivolts is the voltage DIO3 supplies the module's
+	// TCXO with, which must be one of 1600, 1700, 1800, 2200,
+	// 2400, 2700, 3000 or 3300. Leave it as 0 for modules
+	// clocked by a crystal instead.
+	TcxoMillivolts uint
+
+	// Dio2RfSwitch specifies whether DIO2 drives the
+	// module's RF switch, as it does on most modules.
+	Dio2RfSwitch bool
+
+	// Ldo specifies whether to power the chip through its LDO
+	// rather than its DC-DC converter, which is only needed on
+	// modules lacking the converter's inductor.
+	Ldo bool
+
+	// Config holds the modem parameters to configure the
+	// radio with. It defaults to DefaultConfig.
+	Config *Config
+
+	// Lbt configures listen-before-talk for every transmission.
+	// It's disabled unless its MaxAttempts is set.
+	Lbt LbtPolicy
+
+	// DutyCycle bounds the airtime spent transmitting.
+	// It's disabled unless its Limit is set.
+	DutyCycle DutyCyclePolicy
+
+	// CrcPolicy controls what happens to received packets
+	// whose payload CRC is wrong.
+	CrcPolicy Crc_policy
+
+	// NodeAddress is the RadioHead address of this node. Packets
+	// addressed to other nodes are dropped unless it's set to
+	// BroadcastAddress, in which case every packet is received.
+	NodeAddress byte
+
+	// Destination is the RadioHead address Send delivers packets to.
+	Destination byte
+
+	// Promiscuous specifies whether to receive packets
+	// addressed to other nodes too.
+	Promiscuous bool
+
+	// Logger receives the messages the device logs, tagged with
+	// a "device" field holding Name if provided. Leave it as nil
+	// to discard them. Check rfm9x.NewStdLogger for logging
+	// through the standard logger.
+	Logger Logger
+
+	// Name tells the device apart from others in its log messages.
+	Name string
+
+	// LogLevel controls how 'verbosy' the instantiated device
+	// is: messages below it never reach Logger.
+	LogLevel Log_level
+}
+
+// DefaultOpts are the recommended options for the radio. The
+// pins and the TCXO voltage must match the wiring of the module.
+var DefaultOpts = Opts{
+	BaudrateMHz:    8,
+	ResetPin:       rpi.P1_22,
+	BusyPin:        rpi.P1_18,
+	TcxoMillivolts: 1800,
+	Dio2RfSwitch:   true,
+	CrcPolicy:      rfm9x.CrcPolicyReject,
+	NodeAddress:    BroadcastAddress,
+	Destination:    BroadcastAddress,
+	LogLevel:       LogLevelInfo,
+}
+
+// Dev represents an SX1261/2 radio. It sends and receives
+// RadioHead packets just like rfm9x.Dev does, so that both
+// kinds of radios can talk to each other.
+type Dev struct {
+	// mu serialises access to the radio between Listen's
+	// goroutine and transmissions issued whilst listening.
+	mu sync.Mutex
+
+	// core listens, senses the channel, accounts for the
+	// airtime and watches the radio's health through mu.
+	core *rfm9x.Core
+
+	// bus issues commands to the chip over SPI.
+	bus *cmdBus
+
+	// log is the device's own logger.
+	log *dev_logger
+
+	// dio1Pin specifies the GPIO pin physically connected
+	// to the chip's DIO1 output. It's nil when we are to
+	// poll the IRQ flags instead.
+	dio1Pin gpio.PinIO
+
+	// tcxoMillivolts, rfSwitch and ldo describe the
+	// module as per the homonymous fields of Opts.
+	tcxoMillivolts uint
+	rfSwitch       bool
+	ldo            bool
+
+	// conf holds the modem parameters last applied, as
+	// the chip can't report most of them back.
+	conf Config
+
+	// crcPolicy specifies how packets failing the CRC are handled.
+	crcPolicy Crc_policy
+
+	// address is the device's RadioHead node address.
+	address byte
+
+	// destination is the address Send delivers packets to.
+	destination byte
+
+	// promiscuous specifies whether to receive every packet.
+	promiscuous bool
+
+	// seq is the ID of the last packet we sent.
+	seq byte
+
+	// stats holds the reception counters exposed through Stats.
+	stats Stats
+}
+
+// New initialises and returns a reference to a new SX1261/2 radio.
+//
+// Configuration options are provided through o and the SPI
+// port on which to communicate with the radio is provided on p.
+//
+// If errors are encountered during initialisation, an empty
+// reference along with an error is returned.
+func New(p spi.Port, o *Opts) (*Dev, error) {
+	if o.BusyPin == nil {
+		return nil, errors.New("the BUSY pin is mandatory")
+	}
+	if _, ok := tcxoMillivoltsToCode[o.TcxoMillivolts]; o.TcxoMillivolts != 0 && !ok {
+		return nil, fmt.Errorf("unsupported TCXO voltage: %d mV", o.TcxoMillivolts)
+	}
+
+	c, err := p.Connect(physic.Frequency(o.BaudrateMHz)*physic.MegaHertz, spi.Mode0, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	log := newLogger(o.Logger, o.LogLevel, o.Name)
+	log.debug("connected to the radio", "duplex", c.Duplex())
+
+	dev := &Dev{
+		bus:            &cmdBus{cnx: c, resetPin: o.ResetPin, busyPin: o.BusyPin, log: log},
+		log:            log,
+		dio1Pin:        o.DIO1Pin,
+		tcxoMillivolts: o.TcxoMillivolts,
+		rfSwitch:       o.Dio2RfSwitch,
+		ldo:            o.Ldo,
+		crcPolicy:      o.CrcPolicy,
+		address:        o.NodeAddress,
+		destination:    o.Destination,
+		promiscuous:    o.Promiscuous,
+	}
+	dev.core = rfm9x.NewCore(chip{dev}, &dev.mu, rfm9x.CoreOpts{
+		Lbt:       o.Lbt,
+		DutyCycle: o.DutyCycle,
+		Logger:    o.Logger,
+		LogLevel:  o.LogLevel,
+		Name:      o.Name,
+	})
+
+	if dev.dio1Pin != nil {
+		if err := dev.dio1Pin.In(gpio.PullNoChange, gpio.RisingEdge); err != nil {
+			return nil, fmt.Errorf("couldn't configure edge detection on DIO1: %v", err)
+		}
+		log.debug("waiting for IRQs on DIO1", "pin", dev.dio1Pin)
+	}
+
+	if err := dev.Reset(); err != nil {
+		return nil, err
+	}
+	if status, err := dev.Status(); err != nil || (status>>4)&0x7 != ChipModeStandbyRc {
+		log.warn("wrong radio state detected", "status", status, "err", err)
+	}
+
+	conf := DefaultConfig
+	if o.Config != nil {
+		conf = *o.Config
+	}
+	if err := dev.ApplyConfig(conf); err != nil {
+		return nil, err
+	}
+	log.debug("configured the radio", "config", conf)
+
+	return dev, nil
+}
+
+// Reset drives the radio's reset pin to return it to a known state
+// and then sets it up as per the module's wiring (i.e. its TCXO,
+// regulator and RF switch) for LoRa. The modem parameters go back to
+// their defaults, so ApplyConfig must be called again afterwards.
+// Errors raised by the underlying SPI transactions match ErrSPI.
+func (d *Dev) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.log.debug("resetting the radio")
+
+	if err := d.bus.reset(); err != nil {
+		return spiError(err)
+	}
+	if err := d.setup(); err != nil {
+		return spiError(err)
+	}
+
+	d.log.debug("the reset looks good")
+	return nil
+}
+
+// setup configures a freshly reset chip as per the module's wiring,
+// selects the LoRa packet type and routes the IRQs we wait on to
+// DIO1. It returns any errors raised by the underlying SPI
+// transactions.
+func (d *Dev) setup() error {
+	if err := d.bus.command(OpSetStandby, StandbyRc); err != nil {
+		return err
+	}
+
+	if d.tcxoMillivolts != 0 {
+		code, delay := tcxoMillivoltsToCode[d.tcxoMillivolts], tcxoDelay
+		if err := d.bus.command(OpSetDio3AsTcxoCtrl, code, byte(delay>>16), byte(delay>>8), byte(delay)); err != nil {
+			return err
+		}
+		// Every block must be calibrated again once the TCXO is
+		// up, which also clears the XOSC start error raised
+		// before it was, as per section 13.3.6 on the datasheet.
+		if err := d.bus.command(OpCalibrate, 0x7F); err != nil {
+			return err
+		}
+		if err := d.bus.command(OpClearDeviceErrors, 0x00, 0x00); err != nil {
+			return err
+		}
+	}
+
+	regulator := byte(0x01)
+	if d.ldo {
+		regulator = 0x00
+	}
+	if err := d.bus.command(OpSetRegulatorMode, regulator); err != nil {
+		return err
+	}
+	if d.rfSwitch {
+		if err := d.bus.command(OpSetDio2AsRfSwitchCtrl, 0x01); err != nil {
+			return err
+		}
+	}
+
+	if err := d.bus.command(OpSetPacketType, PacketTypeLoRa); err != nil {
+		return err
+	}
+	if err := d.bus.command(OpSetBufferBaseAddress, 0x00, 0x00); err != nil {
+		return err
+	}
+
+	// The flags we wait on are routed to DIO1. HeaderErr is too, as
+	// it's raised on its own and would otherwise keep DIO1 high.
+	irq, dio1 := IrqAll, IrqTxDone|IrqRxDone|IrqHeaderErr|IrqCadDone|IrqTimeout
+	return d.bus.command(OpSetDioIrqParams,
+		byte(irq>>8), byte(irq),
+		byte(dio1>>8), byte(dio1),
+		0x00, 0x00, 0x00, 0x00)
+}
+
+// Status returns the status byte of the chip, whose bits 6:4 hold
+// the chip mode and bits 3:1 the status of the last command. Check
+// the ChipMode* and CmdStatus* constants.
+// It returns any errors raised by the underlying SPI transaction.
+func (d *Dev) Status() (byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, err := d.bus.query(OpGetStatus, nil, nil)
+	if err != nil {
+		return 0, spiError(err)
+	}
+	return status, nil
+}
@@ -0,0 +1,99 @@
+package sx126xsim
+
+import "time"
+
+// opcode represents one of the commands the chip understands.
+type opcode byte
+
+// Commands the simulator knows about. Check section 13 on the
+// datasheet for the complete command set. Names mirror the ones
+// used by the sx126x driver. Any other command is accepted and
+// then ignored.
+const (
+	opSetSleep            opcode = 0x84
+	opSetStandby          opcode = 0x80
+	opSetFs               opcode = 0xC1
+	opSetTx               opcode = 0x83
+	opSetRx               opcode = 0x82
+	opSetCad              opcode = 0xC5
+	opWriteRegister       opcode = 0x0D
+	opReadRegister        opcode = 0x1D
+	opWriteBuffer         opcode = 0x0E
+	opReadBuffer          opcode = 0x1E
+	opSetDioIrqParams     opcode = 0x08
+	opGetIrqStatus        opcode = 0x12
+	opClearIrqStatus      opcode = 0x02
+	opSetRfFrequency      opcode = 0x86
+	opSetPacketType       opcode = 0x8A
+	opGetPacketType       opcode = 0x11
+	opSetTxParams         opcode = 0x8E
+	opSetModulationParams opcode = 0x8B
+	opSetPacketParams     opcode = 0x8C
+	opSetBufferBaseAddr   opcode = 0x8F
+	opGetStatus           opcode = 0xC0
+	opGetRssiInst         opcode = 0x15
+	opGetRxBufferStatus   opcode = 0x13
+	opGetPacketStatus     opcode = 0x14
+)
+
+// Registers the simulator knows about. Every other register
+// reads back whatever was last written to it.
+const (
+	regLoRaSyncWordMsb uint16 = 0x0740
+	regLoRaSyncWordLsb uint16 = 0x0741
+)
+
+// resetRegs holds the reset values of the registers that have one.
+var resetRegs = map[uint16]byte{
+	regLoRaSyncWordMsb: 0x14,
+	regLoRaSyncWordLsb: 0x24,
+}
+
+// Chip modes as reported on bits 6:4 of the status byte. Sleep
+// isn't one, as the chip can't be queried whilst sleeping.
+const (
+	modeSleep       byte = 0x0
+	modeStandbyRc   byte = 0x2
+	modeStandbyXosc byte = 0x3
+	modeFs          byte = 0x4
+	modeRx          byte = 0x5
+	modeTx          byte = 0x6
+)
+
+// Command statuses as reported on bits 3:1 of the status byte.
+const (
+	cmdStatusOk    byte = 0x0
+	cmdStatusError byte = 0x4
+)
+
+// IRQ flags as per table 13-29 on the datasheet.
+const (
+	irqTxDone           uint16 = 1 << 0
+	irqRxDone           uint16 = 1 << 1
+	irqPreambleDetected uint16 = 1 << 2
+	irqHeaderValid      uint16 = 1 << 4
+	irqCrcErr           uint16 = 1 << 6
+	irqCadDone          uint16 = 1 << 7
+	irqCadDetected      uint16 = 1 << 8
+	irqTimeout          uint16 = 1 << 9
+)
+
+const (
+	// OscFreqHz is the frequency of the chip's crystal oscillator.
+	OscFreqHz = 32000000
+
+	// packetTypeLoRa selects the LoRa modem on SetPacketType.
+	packetTypeLoRa byte = 0x01
+
+	// rxContinuous is the Rx timeout that keeps the chip listening.
+	rxContinuous uint32 = 0xFFFFFF
+
+	// rtcStep is the resolution of the Rx timeout.
+	rtcStep = 15625 * time.Nanosecond
+)
+
+// bwCodeToHz maps the bandwidth codes of SetModulationParams to Hz.
+var bwCodeToHz = map[byte]uint{
+	0x00: 7800, 0x08: 10400, 0x01: 15600, 0x09: 20800, 0x02: 31250,
+	0x0A: 41700, 0x03: 62500, 0x04: 125000, 0x05: 250000, 0x06: 500000,
+}
@@ -0,0 +1,22 @@
+package sx126xsim
+
+import "github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+
+// Open returns a new chip attached to the medium described by uri,
+// which is just like the ones sx1276sim.Open understands:
+//
+//	sim://[group]?x=0&y=0&loss=0&exp=2.7
+//
+// Chips opened through either package on the same medium can talk to
+// each other. It returns any errors raised when parsing uri or joining
+// the group.
+func Open(uri string) (*Chip, error) {
+	m, pos, err := sx1276sim.OpenMedium(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New()
+	c.Attach(m, pos)
+	return c, nil
+}
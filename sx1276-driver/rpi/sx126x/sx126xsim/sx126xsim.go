@@ -0,0 +1,678 @@
+/*
+Package sx126xsim implements an in-memory simulation of Semtech's SX1261/2
+LoRa transceivers at the command level. It emulates the 256-byte data
+buffer along with its base addresses, chip mode transitions, IRQ flags
+and the commands reporting on received packets. Only the LoRa packet type
+is simulated: there's no FSK modem.
+
+A Chip implements both spi.Port and spi.Conn and exposes fake reset, BUSY
+and DIO1 pins, so that it can be handed to sx126x.New in place of real
+hardware:
+
+	chip := sx126xsim.New()
+	opts := sx126x.DefaultOpts
+	opts.ResetPin, opts.BusyPin = chip.ResetPin(), chip.Busy()
+	opts.DIO1Pin = chip.DIO1()
+	dev, err := sx126x.New(chip, &opts)
+
+Commands complete right away, so BUSY is always low. Frames are the ones
+of sx1276sim, which lets chips of both families share a sx1276sim.Medium
+through Attach and talk to each other. Frames sent by the driver are
+handed to OnTransmit as they go on the air, and received frames, CRC
+errors, reception timeouts and half-received frames can be injected with
+Inject, InjectTimeout and InjectPreamble just like with sx1276sim.
+
+Useful resources:
+
+	Datasheet: https://www.semtech.com/products/wireless-rf/lora-connect/sx1262
+*/
+package sx126xsim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ulbios/lora/sx1276-driver/rpi/sx1276sim"
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Chip is a simulated SX1261/2. Its exported fields
+// should be set before the chip is used.
+type Chip struct {
+	// Instant makes transmissions complete right away
+	// instead of lasting for their time on air.
+	Instant bool
+
+	// NoiseFloorDBm is the RSSI reported by GetRssiInst.
+	NoiseFloorDBm int
+
+	// OnTransmit is called with every frame the chip starts
+	// transmitting. The transmission ends after the frame's
+	// TimeOnAir unless Instant is set. It runs on its own
+	// goroutine without holding any of the chip's locks,
+	// so it's free to Inject the frame into other chips.
+	OnTransmit func(sx1276sim.Frame)
+
+	// ChannelBusy reports whether there's LoRa activity a chip
+	// listening with the modem parameters in the given frame can
+	// detect. It's consulted at the end of every Channel Activity
+	// Detection and Rx window and, just like OnTransmit, it's
+	// called without holding any of the chip's locks. A nil
+	// ChannelBusy means the channel is always clear.
+	ChannelBusy func(sx1276sim.Frame) bool
+
+	mu     sync.Mutex
+	regs   map[uint16]byte
+	buffer [256]byte
+
+	// mode is the chip mode reported on the status byte.
+	mode byte
+
+	// status is the status of the last command.
+	status byte
+
+	// continuous specifies whether the chip stays in Rx after
+	// receiving a packet.
+	continuous bool
+
+	// cad is set whilst performing a Channel Activity Detection,
+	// which the chip reports as being in Rx.
+	cad bool
+
+	packetType byte
+	frf        uint32
+
+	// Modulation parameters.
+	sf, bwCode, cr byte
+	ldro           bool
+
+	// Packet parameters.
+	preamble      uint16
+	implicit      bool
+	payloadLength byte
+	crc           bool
+
+	power          int8
+	txBase, rxBase byte
+
+	// rxStart and rxLength locate the last received packet.
+	rxStart, rxLength byte
+
+	// pktRssi and pktSnr are reported by GetPacketStatus.
+	pktRssi, pktSnr byte
+
+	irq, irqMask, dio1Mask uint16
+
+	// gen is bumped on every chip mode change so that
+	// pending transmissions can be cancelled.
+	gen uint
+
+	// inReset is set while the reset pin is held low.
+	inReset bool
+
+	// detach removes the chip from the medium it's attached to.
+	detach func()
+
+	resetPin *sx1276sim.Pin
+	busyPin  *sx1276sim.Pin
+	dio1Pin  *sx1276sim.Pin
+}
+
+// New returns a simulated chip in STDBY_RC whose settings hold
+// their reset values.
+func New() *Chip {
+	c := &Chip{NoiseFloorDBm: -120}
+	c.resetPin = sx1276sim.NewPin("SIM_RESET", gpio.High, c.resetLevel)
+	c.busyPin = sx1276sim.NewPin("SIM_BUSY", gpio.Low, nil)
+	c.dio1Pin = sx1276sim.NewPin("SIM_DIO1", gpio.Low, nil)
+	c.reset()
+	return c
+}
+
+// ResetPin returns the fake pin wired to the chip's NRESET line.
+// Driving it low and then high resets the chip.
+func (c *Chip) ResetPin() *sx1276sim.Pin {
+	return c.resetPin
+}
+
+// Busy returns the fake pin wired to the chip's BUSY line.
+func (c *Chip) Busy() *sx1276sim.Pin {
+	return c.busyPin
+}
+
+// DIO1 returns the fake pin wired to the chip's DIO1 line.
+func (c *Chip) DIO1() *sx1276sim.Pin {
+	return c.dio1Pin
+}
+
+// Attach places the chip at pos on m and hooks its transmissions
+// into it, overriding OnTransmit and ChannelBusy. Closing the chip
+// detaches it.
+func (c *Chip) Attach(m *sx1276sim.Medium, pos sx1276sim.Position) {
+	l := m.Connect(c, pos)
+
+	c.mu.Lock()
+	c.OnTransmit = func(f sx1276sim.Frame) {
+		l.Transmit(f, time.Now())
+	}
+	c.ChannelBusy = l.ChannelBusy
+	c.detach = l.Close
+	c.mu.Unlock()
+}
+
+// String implements spi.Port and spi.Conn.
+func (c *Chip) String() string {
+	return "sx126xsim"
+}
+
+// Connect implements spi.Port. The SX1261/2 only supports
+// SPI mode 0 with 8-bit words.
+func (c *Chip) Connect(f physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	if mode&(spi.Mode1|spi.Mode2|spi.Mode3) != spi.Mode0 {
+		return nil, fmt.Errorf("sx126xsim: unsupported SPI mode %v", mode)
+	}
+	if bits != 8 {
+		return nil, fmt.Errorf("sx126xsim: unsupported word size: %d bits", bits)
+	}
+	return c, nil
+}
+
+// LimitSpeed implements spi.PortCloser. It does nothing.
+func (c *Chip) LimitSpeed(f physic.Frequency) error {
+	return nil
+}
+
+// Close implements spi.PortCloser. It cancels any ongoing transmission
+// and detaches the chip from the medium it's attached to, if any.
+func (c *Chip) Close() error {
+	c.mu.Lock()
+	c.gen++
+	detach := c.detach
+	c.detach = nil
+	c.mu.Unlock()
+
+	if detach != nil {
+		detach()
+	}
+	return nil
+}
+
+// Duplex implements spi.Conn.
+func (c *Chip) Duplex() conn.Duplex {
+	return conn.Full
+}
+
+// Tx implements spi.Conn. Every transaction carries a single command:
+// its opcode comes first, followed by its parameters. The chip answers
+// with its status byte wherever it has no data to send back, as per
+// section 8.3 on the datasheet.
+func (c *Chip) Tx(w, r []byte) error {
+	if len(w) == 0 {
+		return nil
+	}
+	if len(r) != 0 && len(r) != len(w) {
+		return errors.New("sx126xsim: w and r must have the same length")
+	}
+
+	// The driver may use the same slice for both directions.
+	cmd := append([]byte(nil), w...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.statusByte()
+	for i := range r {
+		r[i] = status
+	}
+
+	out := c.command(opcode(cmd[0]), cmd[1:])
+	if len(r) != 0 {
+		// Data follows the NOP byte the status is clocked out on.
+		copy(r[len(r)-len(out):], out)
+	}
+	return nil
+}
+
+// TxPackets implements spi.Conn. Every packet is
+// processed as an independent transaction.
+func (c *Chip) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command runs the command op with the bytes following its opcode on
+// args, which include the NOPs clocked in to read data out. It returns
+// the data to send back, which makes up the end of the transaction.
+func (c *Chip) command(op opcode, args []byte) []byte {
+	c.status = cmdStatusOk
+
+	// query returns the data a getter sends back, which follows
+	// the n bytes of parameters and the status byte.
+	query := func(n int, data ...byte) []byte {
+		if len(args) < n+1 {
+			return nil
+		}
+		out := args[n+1:]
+		for i := range out {
+			out[i] = 0
+			if i < len(data) {
+				out[i] = data[i]
+			}
+		}
+		return out
+	}
+
+	switch op {
+	case opSetSleep:
+		c.setMode(modeSleep)
+	case opSetStandby:
+		if arg(args, 0) == 0x01 {
+			c.setMode(modeStandbyXosc)
+		} else {
+			c.setMode(modeStandbyRc)
+		}
+	case opSetFs:
+		c.setMode(modeFs)
+	case opSetTx:
+		c.setMode(modeTx)
+		c.startTx()
+	case opSetRx:
+		c.setMode(modeRx)
+		c.startRx(uint32(arg(args, 0))<<16 | uint32(arg(args, 1))<<8 | uint32(arg(args, 2)))
+	case opSetCad:
+		c.setMode(modeRx)
+		c.cad = true
+		c.startCad()
+
+	case opSetPacketType:
+		c.packetType = arg(args, 0)
+	case opGetPacketType:
+		return query(0, c.packetType)
+	case opSetRfFrequency:
+		c.frf = uint32(arg(args, 0))<<24 | uint32(arg(args, 1))<<16 | uint32(arg(args, 2))<<8 | uint32(arg(args, 3))
+	case opSetModulationParams:
+		c.sf, c.bwCode, c.cr, c.ldro = arg(args, 0), arg(args, 1), arg(args, 2), arg(args, 3) != 0
+	case opSetPacketParams:
+		c.preamble = uint16(arg(args, 0))<<8 | uint16(arg(args, 1))
+		c.implicit, c.payloadLength, c.crc = arg(args, 2) != 0, arg(args, 3), arg(args, 4) != 0
+	case opSetTxParams:
+		c.power = int8(arg(args, 0))
+	case opSetBufferBaseAddr:
+		c.txBase, c.rxBase = arg(args, 0), arg(args, 1)
+
+	case opWriteRegister:
+		addr := uint16(arg(args, 0))<<8 | uint16(arg(args, 1))
+		for i := 2; i < len(args); i++ {
+			c.regs[addr] = args[i]
+			addr++
+		}
+	case opReadRegister:
+		addr := uint16(arg(args, 0))<<8 | uint16(arg(args, 1))
+		out := query(2)
+		for i := range out {
+			out[i] = c.regs[addr+uint16(i)]
+		}
+		return out
+	case opWriteBuffer:
+		offset := arg(args, 0)
+		for i := 1; i < len(args); i++ {
+			c.buffer[offset] = args[i]
+			offset++
+		}
+	case opReadBuffer:
+		offset := arg(args, 0)
+		out := query(1)
+		for i := range out {
+			out[i] = c.buffer[offset+byte(i)]
+		}
+		return out
+
+	case opSetDioIrqParams:
+		c.irqMask = uint16(arg(args, 0))<<8 | uint16(arg(args, 1))
+		c.dio1Mask = uint16(arg(args, 2))<<8 | uint16(arg(args, 3))
+		c.updateDio()
+	case opGetIrqStatus:
+		return query(0, byte(c.irq>>8), byte(c.irq))
+	case opClearIrqStatus:
+		c.irq &^= uint16(arg(args, 0))<<8 | uint16(arg(args, 1))
+		c.updateDio()
+
+	case opGetStatus:
+		return nil
+	case opGetRssiInst:
+		return query(0, byte(clamp(-2*c.NoiseFloorDBm, 0, 0xFF)))
+	case opGetRxBufferStatus:
+		return query(0, c.rxLength, c.rxStart)
+	case opGetPacketStatus:
+		return query(0, c.pktRssi, c.pktSnr, c.pktRssi)
+
+	default:
+		if _, ok := knownOps[op]; !ok {
+			c.status = cmdStatusError
+		}
+	}
+	return nil
+}
+
+// knownOps holds the commands the chip accepts without simulating
+// them, as they only affect its analog front end.
+var knownOps = map[opcode]struct{}{
+	0x9F: {}, // SetStopRxTimerOnPreambleDetect
+	0x96: {}, // SetRegulatorMode
+	0x89: {}, // Calibrate
+	0x98: {}, // CalibrateImage
+	0x95: {}, // SetPaConfig
+	0x93: {}, // SetRxTxFallbackMode
+	0x9D: {}, // SetDIO2AsRfSwitchCtrl
+	0x97: {}, // SetDIO3AsTCXOCtrl
+	0x88: {}, // SetCadParams
+	0xA0: {}, // SetLoRaSymbNumTimeout
+	0x17: {}, // GetDeviceErrors
+	0x07: {}, // ClearDeviceErrors
+	0x10: {}, // GetStats
+	0x00: {}, // ResetStats
+	0xD1: {}, // SetTxContinuousWave
+	0xD2: {}, // SetTxInfinitePreamble
+	0x94: {}, // SetRxDutyCycle
+}
+
+// arg returns the i-th byte in args or 0 if there's none.
+func arg(args []byte, i int) byte {
+	if i >= len(args) {
+		return 0
+	}
+	return args[i]
+}
+
+// statusByte returns the status byte as per section 13.5.1 on the
+// datasheet: the chip mode goes on bits 6:4 and the status of the
+// last command on bits 3:1.
+func (c *Chip) statusByte() byte {
+	return c.mode<<4 | c.status<<1
+}
+
+// Inject delivers f as if it had just been received over the air.
+// The frame is only received if the chip is in Rx with the LoRa
+// packet type: Inject returns whether that was the case. Payload
+// CRC errors can be simulated through f.CrcError. FSK/OOK frames
+// are never received.
+func (c *Chip) Inject(f sx1276sim.Frame) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.Fsk || !c.receiving() {
+		return false
+	}
+
+	payload := f.Payload
+	if c.implicit {
+		payload = make([]byte, c.payloadLength)
+		copy(payload, f.Payload)
+	}
+	if len(payload) > 0xFF {
+		payload = payload[:0xFF]
+	}
+
+	for i, b := range payload {
+		c.buffer[c.rxBase+byte(i)] = b
+	}
+	c.rxStart, c.rxLength = c.rxBase, byte(len(payload))
+
+	// Check section 13.5.3 on the datasheet.
+	c.pktRssi = byte(clamp(-2*f.RssiDBm, 0, 0xFF))
+	c.pktSnr = byte(int8(math.Max(math.Min(math.Round(f.SnrDB*4), math.MaxInt8), math.MinInt8)))
+
+	flags := irqRxDone
+	if !c.implicit {
+		flags |= irqHeaderValid
+	}
+	if f.CrcError {
+		flags |= irqCrcErr
+	}
+
+	if !c.continuous {
+		c.setMode(modeStandbyRc)
+	}
+	c.raise(flags)
+	return true
+}
+
+// InjectPreamble makes a chip in Rx behave as if a frame had begun
+// to arrive, raising PreambleDetected and, in explicit header mode,
+// HeaderValid too. The frame is then completed through Inject. It
+// returns whether the chip was in Rx with the LoRa packet type.
+func (c *Chip) InjectPreamble() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.receiving() {
+		return false
+	}
+
+	flags := irqPreambleDetected
+	if !c.implicit {
+		flags |= irqHeaderValid
+	}
+	c.raise(flags)
+	return true
+}
+
+// InjectTimeout makes a chip in Rx with a timeout give up on waiting
+// for a packet, flagging Timeout. It returns whether the chip was in
+// Rx with a timeout.
+func (c *Chip) InjectTimeout() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.receiving() || c.continuous {
+		return false
+	}
+	c.setMode(modeStandbyRc)
+	c.raise(irqTimeout)
+	return true
+}
+
+// Receiving returns the modem parameters the chip is listening
+// with and whether it's listening at all. It implements
+// sx1276sim.Node.
+func (c *Chip) Receiving() (sx1276sim.Frame, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.receiving() {
+		return sx1276sim.Frame{}, false
+	}
+	return c.frame(), true
+}
+
+// receiving checks whether the chip is in Rx with the LoRa packet
+// type. The lock must be held.
+func (c *Chip) receiving() bool {
+	return c.mode == modeRx && !c.cad && c.packetType == packetTypeLoRa
+}
+
+// reset brings the chip back to STDBY_RC with every setting holding
+// its reset value.
+func (c *Chip) reset() {
+	c.gen++
+	c.mode, c.status = modeStandbyRc, cmdStatusOk
+	c.buffer = [256]byte{}
+	c.regs = map[uint16]byte{}
+	for addr, data := range resetRegs {
+		c.regs[addr] = data
+	}
+	c.packetType, c.frf = 0, 0
+	c.sf, c.bwCode, c.cr, c.ldro = 0, 0, 0, false
+	c.preamble, c.implicit, c.payloadLength, c.crc = 0, false, 0, false
+	c.power, c.txBase, c.rxBase = 0, 0, 0
+	c.rxStart, c.rxLength, c.pktRssi, c.pktSnr = 0, 0, 0, 0
+	c.irq, c.irqMask, c.dio1Mask = 0, 0, 0
+	c.updateDio()
+}
+
+// resetLevel tracks the level of the reset pin, resetting
+// the chip once it's released after being held low.
+func (c *Chip) resetLevel(l gpio.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if l == gpio.Low {
+		c.inReset = true
+		return
+	}
+	if c.inReset {
+		c.inReset = false
+		c.reset()
+	}
+}
+
+// setMode switches the chip mode to mode, cancelling whatever
+// the chip was doing.
+func (c *Chip) setMode(mode byte) {
+	c.mode, c.cad = mode, false
+	c.gen++
+}
+
+// startTx begins transmitting the PayloadLength bytes in the
+// buffer starting at its Tx base address. The chip then raises
+// TxDone and returns to STDBY_RC.
+func (c *Chip) startTx() {
+	f := c.frame()
+	f.Payload = make([]byte, c.payloadLength)
+	for i := range f.Payload {
+		f.Payload[i] = c.buffer[c.txBase+byte(i)]
+	}
+
+	t_air := time.Duration(0)
+	if !c.Instant {
+		t_air = f.TimeOnAir()
+	}
+
+	if c.OnTransmit != nil {
+		go c.OnTransmit(f)
+	}
+
+	gen := c.gen
+	time.AfterFunc(t_air, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen {
+			// The transmission was interrupted.
+			return
+		}
+		c.setMode(modeStandbyRc)
+		c.raise(irqTxDone)
+	})
+}
+
+// startRx begins listening for packets. A timeout of rxContinuous
+// keeps the chip in Rx, whilst any other makes it return to STDBY_RC
+// after the first packet. Unless it's 0, the chip gives up once
+// timeout RTC steps elapse, raising Timeout and returning to STDBY_RC,
+// unless a preamble is on the air by then, in which case it keeps
+// waiting for the packet. Instant chips only time out through
+// InjectTimeout.
+func (c *Chip) startRx(timeout uint32) {
+	c.continuous = timeout == rxContinuous
+	if c.continuous || timeout == 0 || c.Instant {
+		return
+	}
+
+	f := c.frame()
+	busy := c.ChannelBusy
+	gen := c.gen
+	time.AfterFunc(time.Duration(timeout)*rtcStep, func() {
+		detected := busy != nil && busy(f)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen || detected {
+			return
+		}
+		c.setMode(modeStandbyRc)
+		c.raise(irqTimeout)
+	})
+}
+
+// startCad performs a Channel Activity Detection lasting for two
+// symbols, as configured by the sx126x driver. The chip then raises
+// CadDone, along with CadDetected if the channel is busy, and returns
+// to STDBY_RC.
+func (c *Chip) startCad() {
+	f := c.frame()
+
+	t_cad := time.Duration(0)
+	if !c.Instant && f.BandwidthHz != 0 {
+		t_cad = 2 * time.Duration(math.Exp2(float64(f.SpreadingFactor))/float64(f.BandwidthHz)*float64(time.Second))
+	}
+
+	busy := c.ChannelBusy
+	gen := c.gen
+	time.AfterFunc(t_cad, func() {
+		detected := busy != nil && busy(f)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen {
+			// The detection was interrupted.
+			return
+		}
+		c.setMode(modeStandbyRc)
+		if detected {
+			c.raise(irqCadDone | irqCadDetected)
+		} else {
+			c.raise(irqCadDone)
+		}
+	})
+}
+
+// frame returns an empty frame carrying the current modem parameters.
+func (c *Chip) frame() sx1276sim.Frame {
+	return sx1276sim.Frame{
+		FrequencyHz:         uint((uint64(c.frf) * OscFreqHz) >> 25),
+		BandwidthHz:         bwCodeToHz[c.bwCode],
+		SpreadingFactor:     c.sf,
+		CodingRate:          c.cr + 4,
+		PreambleLength:      c.preamble,
+		SyncWord:            c.regs[regLoRaSyncWordMsb]&0xF0 | c.regs[regLoRaSyncWordLsb]>>4,
+		ImplicitHeader:      c.implicit,
+		LowDataRateOptimize: c.ldro,
+		Crc:                 c.crc,
+		TxPowerDbm:          int(c.power),
+	}
+}
+
+// raise sets the IRQ flags in flags enabled through SetDioIrqParams.
+func (c *Chip) raise(flags uint16) {
+	c.irq |= flags & c.irqMask
+	c.updateDio()
+}
+
+// updateDio drives DIO1 high whilst any of the IRQ
+// flags routed to it through SetDioIrqParams is set.
+func (c *Chip) updateDio() {
+	c.dio1Pin.Drive(c.irq&c.dio1Mask != 0)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,177 @@
+package sx1276sim
+
+import (
+	"bytes"
+	"math"
+	"time"
+)
+
+// Frame is a LoRa or FSK/OOK packet as it travels over the air.
+// Transmitted frames carry the modem parameters the sending chip
+// was configured with. Frames handed to Inject carry the reception
+// metrics the receiving chip should report as well.
+type Frame struct {
+	// Payload holds the bytes sent over the air, RadioHead
+	// header included if the driver prepends one.
+	Payload []byte
+
+	// FrequencyHz is the carrier frequency in Hz.
+	FrequencyHz uint
+
+	// BandwidthHz is the signal bandwidth in Hz.
+	BandwidthHz uint
+
+	// SpreadingFactor is the spreading factor, from 5 to 12.
+	SpreadingFactor byte
+
+	// CodingRate is the denominator of the 4/x coding rate.
+	CodingRate byte
+
+	// PreambleLength is the length of the preamble in symbols.
+	PreambleLength uint16
+
+	// SyncWord is the LoRa sync word the frame was sent with.
+	SyncWord byte
+
+	// ImplicitHeader specifies whether the LoRa header was left out.
+	ImplicitHeader bool
+
+	// LowDataRateOptimize specifies whether the low data
+	// rate optimisation was enabled on the sender.
+	LowDataRateOptimize bool
+
+	// TxPowerDbm is the output power the frame was sent with.
+	TxPowerDbm int
+
+	// HopPeriod is how many symbols the sender stayed on
+	// each channel, or 0 if it didn't hop.
+	HopPeriod byte
+
+	// HopsHz lists the carrier frequency of each of the frame's
+	// hops, the first one being FrequencyHz, when hopping.
+	HopsHz []uint
+
+	// Fsk specifies whether the frame was sent by the FSK/OOK
+	// modem, in which case the LoRa modem parameters are unset and
+	// BandwidthHz is the bandwidth the signal occupies.
+	Fsk bool
+
+	// Ook specifies whether the frame was sent with On-Off
+	// Keying rather than Frequency Shift Keying.
+	Ook bool
+
+	// BitrateBps is the bit rate of FSK/OOK frames.
+	BitrateBps uint
+
+	// FdevHz is the frequency deviation of FSK frames.
+	FdevHz uint
+
+	// FskSyncWord is the sync word of FSK/OOK frames.
+	FskSyncWord []byte
+
+	// FixedLength specifies whether an FSK/OOK frame
+	// went without a length byte.
+	FixedLength bool
+
+	// Whitening specifies whether an FSK/OOK frame was whitened.
+	Whitening bool
+
+	// Crc specifies whether the payload is followed by a CRC.
+	// The rfm9x driver rejects frames without one by default.
+	Crc bool
+
+	// CrcError makes the receiving chip flag a payload CRC error.
+	CrcError bool
+
+	// RssiDBm is the signal strength the receiving chip reports.
+	RssiDBm int
+
+	// SnrDB is the signal to noise ratio the receiving chip reports.
+	SnrDB float64
+
+	// FreqErrorHz is the frequency error the receiving chip reports.
+	FreqErrorHz int
+}
+
+// TimeOnAir returns how long it takes to transmit the frame with
+// its current modem parameters. Refer to section 4.1.1.7 in the
+// datasheet for the expressions involved.
+func (f Frame) TimeOnAir() time.Duration {
+	if f.Fsk {
+		return f.fskTimeOnAir()
+	}
+	if f.BandwidthHz == 0 || f.SpreadingFactor == 0 || f.CodingRate < 5 {
+		return 0
+	}
+
+	sf := float64(f.SpreadingFactor)
+	t_sym := math.Exp2(sf) / float64(f.BandwidthHz)
+	t_preamble := (float64(f.PreambleLength) + 4.25) * t_sym
+
+	var crc, ih, de float64
+	if f.Crc {
+		crc = 1
+	}
+	if f.ImplicitHeader {
+		ih = 1
+	}
+	if f.LowDataRateOptimize {
+		de = 1
+	}
+
+	n_payload := math.Ceil((8*float64(len(f.Payload))-4*sf+28+16*crc-20*ih)/(4*(sf-2*de))) * float64(f.CodingRate)
+	n_payload = 8 + math.Max(n_payload, 0)
+
+	return time.Duration((t_preamble + n_payload*t_sym) * float64(time.Second))
+}
+
+// hopTime returns how long the frame stays on each channel
+// when hopping, or 0 if it doesn't hop.
+func (f Frame) hopTime() time.Duration {
+	if f.HopPeriod == 0 || f.BandwidthHz == 0 {
+		return 0
+	}
+	t_sym := math.Exp2(float64(f.SpreadingFactor)) / float64(f.BandwidthHz)
+	return time.Duration(float64(f.HopPeriod) * t_sym * float64(time.Second))
+}
+
+// fskTimeOnAir returns how long it takes to transmit an FSK/OOK frame:
+// its preamble, sync word, length byte, payload and CRC go out at the
+// configured bit rate.
+func (f Frame) fskTimeOnAir() time.Duration {
+	if f.BitrateBps == 0 {
+		return 0
+	}
+
+	n := int(f.PreambleLength) + len(f.FskSyncWord) + len(f.Payload)
+	if !f.FixedLength {
+		n++
+	}
+	if f.Crc {
+		n += 2
+	}
+	return time.Duration(n*8) * time.Second / time.Duration(f.BitrateBps)
+}
+
+// hears checks whether a chip listening with the modem parameters in
+// f is able to demodulate g, leaving the signal's strength aside.
+func (f Frame) hears(g Frame) bool {
+	if f.Fsk != g.Fsk || !sameChannel(f.FrequencyHz, g.FrequencyHz, f.BandwidthHz) {
+		return false
+	}
+	if f.Fsk {
+		return f.Ook == g.Ook && f.BitrateBps == g.BitrateBps && bytes.Equal(f.FskSyncWord, g.FskSyncWord) &&
+			f.FixedLength == g.FixedLength && f.Whitening == g.Whitening
+	}
+	return f.SpreadingFactor == g.SpreadingFactor && f.BandwidthHz == g.BandwidthHz && f.SyncWord == g.SyncWord &&
+		f.ImplicitHeader == g.ImplicitHeader && f.HopPeriod == g.HopPeriod
+}
+
+// snrLimitDB returns the minimum SNR a chip listening
+// with the modem parameters in f can demodulate.
+func (f Frame) snrLimitDB() float64 {
+	if f.Fsk {
+		return fskSnrLimitDB
+	}
+	return snrLimitDB[f.SpreadingFactor]
+}
@@ -0,0 +1,322 @@
+package sx1276sim
+
+import "time"
+
+// fskStream is an FSK/OOK packet going through the FIFO, byte by
+// byte, at the configured bit rate.
+type fskStream struct {
+	// frame is the packet being sent or received.
+	frame Frame
+
+	// data holds the bytes following the sync word, length byte
+	// included. Whilst transmitting it's filled from the FIFO.
+	data []byte
+
+	// n is how many bytes make up data.
+	n int
+
+	// moved is how many bytes have gone through the FIFO.
+	moved int
+
+	// start is the instant the first byte begins going through.
+	start time.Time
+
+	// t_byte is how long each byte takes, which is 0 for Instant chips.
+	t_byte time.Duration
+
+	// tx specifies whether the packet is being transmitted.
+	tx bool
+
+	// broken is set once the FIFO runs out of data whilst transmitting.
+	broken bool
+}
+
+// fsk checks whether the FSK/OOK modem is selected.
+func (c *Chip) fsk() bool {
+	return c.regs[regOpMode]&longRangeBit == 0
+}
+
+// readFsk returns the contents of the FSK/OOK modem's register at
+// addr, which must be either the FIFO or one of the banked ones.
+func (c *Chip) readFsk(addr reg_addr) byte {
+	switch addr {
+	case regFifo:
+		if len(c.fskFifo) == 0 {
+			return 0
+		}
+		data := c.fskFifo[0]
+		c.fskFifo = c.fskFifo[1:]
+		if len(c.fskFifo) == 0 {
+			// PayloadReady goes away once the packet has been read.
+			c.fskFlags &^= fskPayloadReady | fskCrcOk
+		}
+		return data
+	case fskRegIrqFlags1:
+		return fskModeReady
+	case fskRegIrqFlags2:
+		return c.fskIrqFlags()
+	case fskRegRssiValue:
+		return byte(clamp(-2*c.fskRssi, 0, 0xFF))
+	}
+	return c.fskRegs[addr]
+}
+
+// writeFsk stores data on the FSK/OOK modem's register at addr,
+// which must be either the FIFO or one of the banked ones.
+func (c *Chip) writeFsk(addr reg_addr, data byte) {
+	switch addr {
+	case regFifo:
+		if len(c.fskFifo) >= fskFifoSize {
+			c.fskFlags |= fskFifoOverrun
+			return
+		}
+		c.fskFifo = append(c.fskFifo, data)
+	case fskRegIrqFlags2:
+		// Clearing FifoOverrun empties the FIFO as well.
+		if data&fskFifoOverrun != 0 {
+			c.fskFifo = nil
+			c.fskFlags &^= fskFifoOverrun | fskPayloadReady | fskCrcOk
+		}
+	case fskRegIrqFlags1, fskRegRssiValue:
+	default:
+		c.fskRegs[addr] = data
+	}
+}
+
+// fskIrqFlags returns the contents of RegIrqFlags2, whose
+// FIFO flags reflect the FIFO's current level.
+func (c *Chip) fskIrqFlags() byte {
+	flags := c.fskFlags
+	switch n := len(c.fskFifo); {
+	case n == 0:
+		flags |= fskFifoEmpty
+	case n >= fskFifoSize:
+		flags |= fskFifoFull
+	}
+	if len(c.fskFifo) > int(c.fskRegs[fskRegFifoThresh]&0x3F) {
+		flags |= fskFifoLevel
+	}
+	return flags
+}
+
+// setFskMode carries out the side effects of switching the FSK/OOK
+// modem to mode, which aborts any packet going through the FIFO.
+func (c *Chip) setFskMode(mode byte) {
+	c.stream = nil
+	c.fskFlags &^= fskPacketSent
+
+	switch mode {
+	case modeSleep:
+		// The FIFO is cleared when entering Sleep mode.
+		c.fskFifo = nil
+		c.fskFlags = 0
+	case modeTx:
+		c.startFskTx()
+	case modeRxCont:
+		c.fskFlags &^= fskPayloadReady | fskCrcOk
+		c.fskRssi = c.NoiseFloorDBm
+	}
+}
+
+// byteTime returns how long each byte takes at the configured
+// bit rate, which is 0 for Instant chips.
+func (c *Chip) byteTime(f Frame) time.Duration {
+	if c.Instant || f.BitrateBps == 0 {
+		return 0
+	}
+	return 8 * time.Second / time.Duration(f.BitrateBps)
+}
+
+// startFskTx begins transmitting the packet in the FIFO, which the
+// driver is to keep topping up as it drains. Its length is taken from
+// the first byte in the FIFO unless packets have a fixed length. Once
+// the packet is over PacketSent is raised and the frame is handed to
+// OnTransmit, flagging a CRC error if the FIFO ran out of data.
+func (c *Chip) startFskTx() {
+	f := c.fskFrame()
+	n := int(c.fskRegs[fskRegPayloadLength])
+	if !f.FixedLength {
+		if len(c.fskFifo) == 0 {
+			return
+		}
+		n = 1 + int(c.fskFifo[0])
+	}
+
+	t_byte := c.byteTime(f)
+	s := &fskStream{
+		frame:  f,
+		n:      n,
+		start:  time.Now().Add(time.Duration(int(f.PreambleLength)+len(f.FskSyncWord)) * t_byte),
+		t_byte: t_byte,
+		tx:     true,
+	}
+	c.stream = s
+
+	end := s.start.Add(time.Duration(n) * t_byte)
+	if f.Crc {
+		end = end.Add(2 * t_byte)
+	}
+
+	on_transmit := c.OnTransmit
+	gen := c.gen
+	time.AfterFunc(time.Until(end), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.advance(time.Now())
+		if gen != c.gen {
+			// The transmission was interrupted.
+			return
+		}
+		c.stream = nil
+		c.fskFlags |= fskPacketSent
+
+		f.Payload = s.data
+		if !f.FixedLength && len(s.data) > 0 {
+			f.Payload = s.data[1:]
+		}
+		f.CrcError = s.broken || s.moved < s.n
+		if on_transmit != nil {
+			go on_transmit(f)
+		}
+	})
+}
+
+// injectFsk starts streaming f into the FIFO if the FSK/OOK modem is
+// listening and it isn't busy with another packet. Frames longer than
+// the configured payload length are dropped, just like real chips do.
+func (c *Chip) injectFsk(f Frame) bool {
+	if !c.fsk() || c.regs[regOpMode]&modeMask != modeRxCont {
+		return false
+	}
+	if c.stream != nil || c.fskFlags&fskPayloadReady != 0 {
+		return true
+	}
+
+	max_len := int(c.fskRegs[fskRegPayloadLength])
+	data := f.Payload
+	if c.fskRegs[fskRegPacketConfig1]&0x80 == 0 {
+		data = make([]byte, max_len)
+		copy(data, f.Payload)
+	} else {
+		if len(data) > max_len {
+			return true
+		}
+		data = append([]byte{byte(len(data))}, data...)
+	}
+
+	c.fskRssi = f.RssiDBm
+	c.stream = &fskStream{
+		frame:  f,
+		data:   data,
+		n:      len(data),
+		start:  time.Now(),
+		t_byte: c.byteTime(c.fskFrame()),
+	}
+	c.advance(time.Now())
+	return true
+}
+
+// advance moves the bytes of the packet going through the FIFO that
+// are due by now. Whilst transmitting, running out of data breaks the
+// packet. Whilst receiving, a full FIFO drops it and raises FifoOverrun,
+// whereas getting every byte in raises PayloadReady, along with CrcOk
+// unless the frame carries a CRC error.
+func (c *Chip) advance(now time.Time) {
+	s := c.stream
+	if s == nil || s.broken {
+		return
+	}
+
+	due := s.n
+	if s.t_byte > 0 {
+		if k := int(now.Sub(s.start) / s.t_byte); k < due {
+			due = k
+		}
+	}
+
+	for ; s.moved < due; s.moved++ {
+		if s.tx {
+			if len(c.fskFifo) == 0 {
+				s.broken = true
+				return
+			}
+			s.data = append(s.data, c.fskFifo[0])
+			c.fskFifo = c.fskFifo[1:]
+			continue
+		}
+		if len(c.fskFifo) >= fskFifoSize {
+			c.fskFlags |= fskFifoOverrun
+			c.stream = nil
+			return
+		}
+		c.fskFifo = append(c.fskFifo, s.data[s.moved])
+	}
+
+	if !s.tx && s.moved == s.n {
+		c.stream = nil
+		c.fskFlags |= fskPayloadReady
+		if !s.frame.CrcError {
+			c.fskFlags |= fskCrcOk
+		}
+	}
+}
+
+// fskFrame returns an empty frame carrying the
+// current parameters of the FSK/OOK modem.
+func (c *Chip) fskFrame() Frame {
+	pkt_conf := c.fskRegs[fskRegPacketConfig1]
+	f := Frame{
+		Fsk:            true,
+		FrequencyHz:    c.frequencyHz(),
+		Ook:            (c.regs[regOpMode]>>5)&0x3 == 0x1,
+		BitrateBps:     c.bitrateBps(),
+		FdevHz:         c.fdevHz(),
+		PreambleLength: uint16(c.fskRegs[fskRegPreambleMsb])<<8 | uint16(c.fskRegs[fskRegPreambleLsb]),
+		FixedLength:    pkt_conf&0x80 == 0,
+		Whitening:      (pkt_conf>>5)&0x3 == 0b10,
+		Crc:            pkt_conf&0x10 != 0,
+		TxPowerDbm:     c.txPowerDbm(),
+	}
+
+	if sync_conf := c.fskRegs[fskRegSyncConfig]; sync_conf&0x10 != 0 {
+		n := reg_addr(sync_conf&0x7) + 1
+		f.FskSyncWord = append([]byte(nil), c.fskRegs[fskRegSyncValue1:fskRegSyncValue1+n]...)
+	}
+
+	// Carson's rule gives the bandwidth the signal occupies.
+	f.BandwidthHz = 2*f.FdevHz + f.BitrateBps
+	if f.Ook {
+		f.BandwidthHz = 2 * f.BitrateBps
+	}
+	return f
+}
+
+// bitrateBps returns the bit rate as per section 4.2.3 of the
+// datasheet, or 0 if it's invalid.
+func (c *Chip) bitrateBps() uint {
+	br := uint64(c.regs[fskRegBitrateMsb])<<12 | uint64(c.regs[fskRegBitrateLsb])<<4 | uint64(c.regs[fskRegBitrateFrac]&0xF)
+	if br == 0 {
+		return 0
+	}
+	return uint((OscFreqHz*16 + br/2) / br)
+}
+
+// fdevHz returns the frequency deviation as per
+// section 4.2.4 of the datasheet.
+func (c *Chip) fdevHz() uint {
+	fdev := uint64(c.regs[fskRegFdevMsb]&0x3F)<<8 | uint64(c.regs[fskRegFdevLsb])
+	return uint((fdev*OscFreqHz + 1<<18) >> 19)
+}
+
+// rxBwHz returns the single side bandwidth of the receiver
+// as per section 4.2.6 of the datasheet.
+func (c *Chip) rxBwHz() uint {
+	rx_bw := c.fskRegs[fskRegRxBw]
+	mant := [4]uint64{16, 20, 24, 24}[(rx_bw>>3)&0x3]
+	exp := rx_bw&0x7 + 2
+	if (c.regs[regOpMode]>>5)&0x3 == 0x1 {
+		exp++
+	}
+	return uint(OscFreqHz / (mant << exp))
+}
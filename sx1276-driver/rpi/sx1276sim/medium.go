@@ -0,0 +1,370 @@
+package sx1276sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPathLossExponent models an urban environment with some
+	// obstacles. Free space has an exponent of 2.
+	DefaultPathLossExponent = 2.7
+
+	// CaptureThresholdDB is how much stronger than every overlapping
+	// frame a frame must be to survive a collision.
+	CaptureThresholdDB = 6
+
+	// noiseFigureDB is the receiver's noise figure.
+	noiseFigureDB = 6
+
+	// airHistory is how long finished transmissions
+	// are kept around to detect collisions.
+	airHistory = time.Minute
+
+	// maxDatagramSize bounds the size of the frames
+	// exchanged with other processes.
+	maxDatagramSize = 2048
+)
+
+// snrLimitDB holds the minimum SNR each spreading factor can
+// demodulate as per table 13 on the datasheet.
+var snrLimitDB = map[byte]float64{
+	5: -2.5, 6: -5, 7: -7.5, 8: -10, 9: -12.5, 10: -15, 11: -17.5, 12: -20,
+}
+
+// Node is a simulated transceiver that can be attached to a Medium
+// through Connect. Chip is one, but other chip families can join the
+// medium too by implementing it.
+type Node interface {
+	// Receiving returns the modem parameters the node is
+	// listening with and whether it's listening at all.
+	Receiving() (Frame, bool)
+
+	// Inject delivers f as if it had just been received over the
+	// air, returning whether the node was listening for it.
+	Inject(f Frame) bool
+}
+
+// Position locates a chip on a plane. Coordinates are in metres.
+type Position struct {
+	X, Y float64
+}
+
+// distance returns the distance between p and q in metres,
+// which is never less than 1 metre.
+func (p Position) distance(q Position) float64 {
+	return math.Max(math.Hypot(p.X-q.X, p.Y-q.Y), 1)
+}
+
+// Medium is a simulated radio channel. Frames sent by a chip attached
+// to it are delivered to those others listening with the same frequency,
+// spreading factor, bandwidth, sync word and hop period, or with the same
+// FSK/OOK modulation, bit rate and packet format, once their time on air
+// elapses. The RSSI and SNR of each frame are derived from a log-distance
+// path loss model. Frames overlapping in time on the same channel collide,
+// with only the strongest one surviving if it's at least CaptureThresholdDB
+// above the rest. Its exported fields should be set before attaching chips.
+type Medium struct {
+	// LossRate is the probability of a receiver missing a frame.
+	LossRate float64
+
+	// PathLossExponent is the exponent of the path loss model.
+	PathLossExponent float64
+
+	id uint64
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	nodes map[Node]Position
+	onAir []transmission
+
+	// cnx is the multicast group joined by Join, if any.
+	cnx *net.UDPConn
+	out *net.UDPConn
+}
+
+// transmission is a frame travelling over the medium.
+type transmission struct {
+	// Medium identifies the medium the frame comes from, so that
+	// a medium can ignore its own frames when they come back from
+	// the multicast group.
+	Medium uint64
+
+	Frame Frame
+	From  Position
+	Start time.Time
+
+	// sender is the node that sent the frame if it's a local one.
+	sender Node
+}
+
+// end returns the instant the transmission is over.
+func (t transmission) end() time.Time {
+	return t.Start.Add(t.Frame.TimeOnAir())
+}
+
+// overlaps checks whether t and u share the channel at the same time.
+// FSK/OOK frames only collide with each other.
+func (t transmission) overlaps(u transmission) bool {
+	return t.Frame.Fsk == u.Frame.Fsk &&
+		t.Frame.SpreadingFactor == u.Frame.SpreadingFactor &&
+		(t.Frame.Fsk || t.Frame.BandwidthHz == u.Frame.BandwidthHz) &&
+		sameChannel(t.Frame.FrequencyHz, u.Frame.FrequencyHz, t.Frame.BandwidthHz) &&
+		t.Start.Before(u.end()) && u.Start.Before(t.end())
+}
+
+// NewMedium returns an empty medium with no losses.
+func NewMedium() *Medium {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &Medium{
+		PathLossExponent: DefaultPathLossExponent,
+		id:               rnd.Uint64(),
+		rnd:              rnd,
+		nodes:            map[Node]Position{},
+	}
+}
+
+// Attach places c at pos and hooks its transmissions into the
+// medium, overriding c.OnTransmit and c.ChannelBusy. Closing c
+// detaches it.
+func (m *Medium) Attach(c *Chip, pos Position) {
+	l := m.Connect(c, pos)
+
+	c.mu.Lock()
+	c.OnTransmit = func(f Frame) {
+		start := time.Now()
+		if f.HopPeriod != 0 || f.Fsk {
+			// Hopping and FSK/OOK frames are handed over once they're over.
+			start = start.Add(-f.TimeOnAir())
+		}
+		l.Transmit(f, start)
+	}
+	c.ChannelBusy = l.ChannelBusy
+	c.detach = l.Close
+	c.mu.Unlock()
+}
+
+// Link is the connection of a Node to a Medium.
+type Link struct {
+	m   *Medium
+	n   Node
+	pos Position
+}
+
+// Connect places n at pos, returning the link through which its
+// transmissions reach the medium. Frames are delivered to n through
+// Inject whenever Receiving says it's listening for them. Note the
+// medium's lock is held whilst calling n's methods: n mustn't call
+// into the link whilst holding locks those methods take.
+func (m *Medium) Connect(n Node, pos Position) *Link {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nodes[n] = pos
+	return &Link{m: m, n: n, pos: pos}
+}
+
+// Transmit puts f on the air as sent by the link's node at start,
+// which may lie in the past for frames handed over once they're over.
+func (l *Link) Transmit(f Frame, start time.Time) {
+	l.m.transmit(transmission{Medium: l.m.id, Frame: f, From: l.pos, Start: start, sender: l.n})
+}
+
+// ChannelBusy reports whether the link's node can detect LoRa
+// activity when listening with the modem parameters in f. Check
+// Chip's ChannelBusy for the details.
+func (l *Link) ChannelBusy(f Frame) bool {
+	return l.m.channelBusy(l.n, l.pos, f)
+}
+
+// Close detaches the link's node from the medium.
+func (l *Link) Close() {
+	l.m.mu.Lock()
+	defer l.m.mu.Unlock()
+	delete(l.m.nodes, l.n)
+}
+
+// Join connects the medium to the UDP multicast group at addr (e.g.
+// 239.76.82.65:1276), exchanging frames with the media of every other
+// process on the same host that joins it. This makes it possible to
+// run several programs driving simulated chips against each other.
+// It returns any errors raised when joining the group.
+func (m *Medium) Join(addr string) error {
+	g_addr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return fmt.Errorf("sx1276sim: resolving group %s: %v", addr, err)
+	}
+
+	cnx, err := net.ListenMulticastUDP("udp4", nil, g_addr)
+	if err != nil {
+		return fmt.Errorf("sx1276sim: joining group %s: %v", addr, err)
+	}
+
+	out, err := net.DialUDP("udp4", nil, g_addr)
+	if err != nil {
+		cnx.Close()
+		return fmt.Errorf("sx1276sim: dialing group %s: %v", addr, err)
+	}
+
+	m.mu.Lock()
+	m.cnx, m.out = cnx, out
+	m.mu.Unlock()
+
+	go m.recv(cnx)
+
+	return nil
+}
+
+// Close leaves the multicast group joined through Join, if any.
+func (m *Medium) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cnx == nil {
+		return nil
+	}
+	m.out.Close()
+	err := m.cnx.Close()
+	m.cnx, m.out = nil, nil
+	return err
+}
+
+// recv feeds the frames received from the multicast group into the medium.
+func (m *Medium) recv(cnx *net.UDPConn) {
+	buff := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := cnx.ReadFromUDP(buff)
+		if err != nil {
+			return
+		}
+
+		var t transmission
+		if err := json.Unmarshal(buff[:n], &t); err != nil || t.Medium == m.id {
+			continue
+		}
+		m.transmit(t)
+	}
+}
+
+// transmit puts t on the air and schedules its delivery
+// for when its time on air elapses.
+func (m *Medium) transmit(t transmission) {
+	m.mu.Lock()
+	now := time.Now()
+	kept := m.onAir[:0]
+	for _, u := range m.onAir {
+		if now.Sub(u.end()) < airHistory {
+			kept = append(kept, u)
+		}
+	}
+	m.onAir = append(kept, t)
+	out := m.out
+	m.mu.Unlock()
+
+	if out != nil && t.sender != nil {
+		if enc, err := json.Marshal(t); err == nil {
+			out.Write(enc)
+		}
+	}
+
+	time.AfterFunc(time.Until(t.end()), func() { m.deliver(t) })
+}
+
+// deliver hands t over to every chip able to receive it.
+func (m *Medium) deliver(t transmission) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for n, pos := range m.nodes {
+		if n == t.sender {
+			continue
+		}
+
+		rx, ok := n.Receiving()
+		if !ok || !rx.hears(t.Frame) {
+			continue
+		}
+
+		rssi := m.rssiDBm(t, pos)
+		snr := rssi - noiseDBm(rx.BandwidthHz)
+		if snr < rx.snrLimitDB() || m.collided(t, pos, rssi) {
+			continue
+		}
+
+		if m.LossRate > 0 && m.rnd.Float64() < m.LossRate {
+			continue
+		}
+
+		f := t.Frame
+		f.RssiDBm = int(math.Round(rssi))
+		// Real chips don't report SNRs much higher than 10 dB.
+		f.SnrDB = math.Min(snr, 10)
+		f.FreqErrorHz = int(f.FrequencyHz) - int(rx.FrequencyHz)
+		n.Inject(f)
+	}
+}
+
+// channelBusy checks whether n, placed at pos and performing a
+// Channel Activity Detection with the modem parameters in f, can
+// detect any transmission that's currently on the air. Only the
+// preamble's spreading factor, bandwidth and frequency matter.
+func (m *Medium) channelBusy(n Node, pos Position, f Frame) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range m.onAir {
+		if t.sender == n || now.Before(t.Start) || !now.Before(t.end()) {
+			continue
+		}
+		if t.Frame.SpreadingFactor != f.SpreadingFactor || t.Frame.BandwidthHz != f.BandwidthHz ||
+			!sameChannel(t.Frame.FrequencyHz, f.FrequencyHz, f.BandwidthHz) {
+			continue
+		}
+		if m.rssiDBm(t, pos)-noiseDBm(f.BandwidthHz) >= snrLimitDB[f.SpreadingFactor] {
+			return true
+		}
+	}
+	return false
+}
+
+// collided checks whether t, received with the given rssi at pos,
+// is drowned by an overlapping transmission.
+func (m *Medium) collided(t transmission, pos Position, rssi float64) bool {
+	for _, u := range m.onAir {
+		if u.Medium == t.Medium && u.Start.Equal(t.Start) && u.From == t.From {
+			continue
+		}
+		if t.overlaps(u) && rssi-m.rssiDBm(u, pos) < CaptureThresholdDB {
+			return true
+		}
+	}
+	return false
+}
+
+// rssiDBm returns the strength t is received with at pos.
+func (m *Medium) rssiDBm(t transmission, pos Position) float64 {
+	// Free space path loss at 1 metre.
+	ref_loss := 20*math.Log10(float64(t.Frame.FrequencyHz)) + 20*math.Log10(4*math.Pi/299792458)
+	return float64(t.Frame.TxPowerDbm) - ref_loss - 10*m.PathLossExponent*math.Log10(t.From.distance(pos))
+}
+
+// noiseDBm returns the receiver's noise floor over bandwidth bw.
+func noiseDBm(bw uint) float64 {
+	return -174 + 10*math.Log10(float64(bw)) + noiseFigureDB
+}
+
+// sameChannel checks whether two carrier frequencies
+// are close enough to be demodulated with bandwidth bw.
+func sameChannel(f1, f2, bw uint) bool {
+	diff := int64(f1) - int64(f2)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= int64(bw)/4
+}
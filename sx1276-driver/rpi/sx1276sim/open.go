@@ -0,0 +1,113 @@
+package sx1276sim
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Scheme is the URI scheme Open understands.
+const Scheme = "sim"
+
+var (
+	localMedium     *Medium
+	localMediumOnce sync.Once
+
+	// groupMedia holds the media joined to each multicast group so
+	// that every chip in a process shares the one for its group.
+	groupMedia   = map[string]*Medium{}
+	groupMediaMu sync.Mutex
+)
+
+// Open returns a new chip attached to the medium described by uri,
+// which looks like:
+//
+//	sim://[group]?x=0&y=0&loss=0&exp=2.7
+//
+// When a multicast group such as 239.76.82.65:1276 is given the chip is
+// attached to a medium joined to it, so that it can reach chips in other
+// processes. Otherwise, it's attached to a medium shared by every chip in
+// the calling process. Parameters x and y place the chip on the plane (in
+// metres), whilst loss and exp configure the medium's LossRate and
+// PathLossExponent when it's first created.
+// It returns any errors raised when parsing uri or joining the group.
+func Open(uri string) (*Chip, error) {
+	m, pos, err := OpenMedium(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New()
+	m.Attach(c, pos)
+	return c, nil
+}
+
+// OpenMedium returns the medium described by uri along with the
+// position it places a chip at, just like Open does, but leaves it
+// to the caller to attach a node. That lets simulators of other chip
+// families share media with Chips. Parameters other than those Open
+// understands are ignored.
+// It returns any errors raised when parsing uri or joining the group.
+func OpenMedium(uri string) (*Medium, Position, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, Position{}, fmt.Errorf("sx1276sim: malformed URI %q: %v", uri, err)
+	}
+	if u.Scheme != Scheme {
+		return nil, Position{}, fmt.Errorf("sx1276sim: unsupported scheme %q (should be %q)", u.Scheme, Scheme)
+	}
+
+	q := u.Query()
+
+	var (
+		pos  Position
+		loss float64
+		exp  = DefaultPathLossExponent
+	)
+	params := map[string]*float64{"x": &pos.X, "y": &pos.Y, "loss": &loss, "exp": &exp}
+	for name, val := range params {
+		if q.Get(name) == "" {
+			continue
+		}
+		if *val, err = strconv.ParseFloat(q.Get(name), 64); err != nil {
+			return nil, Position{}, fmt.Errorf("sx1276sim: malformed parameter %s=%q: %v", name, q.Get(name), err)
+		}
+	}
+	if loss < 0 || loss > 1 {
+		return nil, Position{}, fmt.Errorf("sx1276sim: loss must belong to the [0, 1] interval: %v", loss)
+	}
+
+	m, err := medium(u.Host, loss, exp)
+	if err != nil {
+		return nil, Position{}, err
+	}
+	return m, pos, nil
+}
+
+// medium returns the medium joined to group, creating it if needed.
+// An empty group refers to the medium local to the calling process.
+func medium(group string, loss, exp float64) (*Medium, error) {
+	if group == "" {
+		localMediumOnce.Do(func() {
+			localMedium = NewMedium()
+			localMedium.LossRate, localMedium.PathLossExponent = loss, exp
+		})
+		return localMedium, nil
+	}
+
+	groupMediaMu.Lock()
+	defer groupMediaMu.Unlock()
+
+	if m, ok := groupMedia[group]; ok {
+		return m, nil
+	}
+
+	m := NewMedium()
+	m.LossRate, m.PathLossExponent = loss, exp
+	if err := m.Join(group); err != nil {
+		return nil, err
+	}
+	groupMedia[group] = m
+	return m, nil
+}
@@ -0,0 +1,175 @@
+package sx1276sim
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+)
+
+// Pin is a fake gpio.PinIO wired to a simulated chip. The chip
+// drives the level of its DIO pins, whilst the level the driver
+// sets on the reset pin is forwarded to the chip.
+type Pin struct {
+	name  string
+	onOut func(gpio.Level)
+
+	mu    sync.Mutex
+	level gpio.Level
+	pull  gpio.Pull
+	edge  gpio.Edge
+
+	// edges holds a pending edge as WaitForEdge
+	// returns immediately if one has occurred.
+	edges chan struct{}
+
+	// halts wakes a blocked WaitForEdge up.
+	halts chan struct{}
+}
+
+// NewPin returns a pin called name starting at level l. The levels
+// the driver sets through Out are forwarded to onOut unless it's nil.
+// It's meant for simulated chips, which drive the pin through Drive.
+func NewPin(name string, l gpio.Level, onOut func(gpio.Level)) *Pin {
+	return &Pin{
+		name:  name,
+		onOut: onOut,
+		level: l,
+		pull:  gpio.Float,
+		edges: make(chan struct{}, 1),
+		halts: make(chan struct{}, 1),
+	}
+}
+
+// String returns the pin's name.
+func (p *Pin) String() string {
+	return p.name
+}
+
+// Halt makes a WaitForEdge call blocked on the pin return false.
+func (p *Pin) Halt() error {
+	select {
+	case p.halts <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Name returns the pin's name.
+func (p *Pin) Name() string {
+	return p.name
+}
+
+// Number returns -1 as the pin isn't a real GPIO.
+func (p *Pin) Number() int {
+	return -1
+}
+
+// Function returns a textual description of the pin's direction.
+func (p *Pin) Function() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.edge != gpio.NoEdge {
+		return "In"
+	}
+	return "Out"
+}
+
+// In configures the edges WaitForEdge waits for and
+// discards any pending one.
+func (p *Pin) In(pull gpio.Pull, edge gpio.Edge) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pull != gpio.PullNoChange {
+		p.pull = pull
+	}
+	p.edge = edge
+
+	select {
+	case <-p.edges:
+	default:
+	}
+	return nil
+}
+
+// Read returns the pin's current level.
+func (p *Pin) Read() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.level
+}
+
+// WaitForEdge waits for the next edge configured through In or
+// returns right away if one has occurred since the last call.
+// A negative timeout waits forever. It returns false if it times
+// out or Halt is called in the meantime.
+func (p *Pin) WaitForEdge(timeout time.Duration) bool {
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	select {
+	case <-p.edges:
+		return true
+	case <-p.halts:
+		return false
+	case <-expired:
+		return false
+	}
+}
+
+// Pull returns the pull configured through In.
+func (p *Pin) Pull() gpio.Pull {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pull
+}
+
+// DefaultPull returns gpio.Float.
+func (p *Pin) DefaultPull() gpio.Pull {
+	return gpio.Float
+}
+
+// Out sets the pin's level and forwards it to the chip if needed.
+func (p *Pin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	p.level = l
+	p.mu.Unlock()
+
+	if p.onOut != nil {
+		p.onOut(l)
+	}
+	return nil
+}
+
+// PWM isn't supported by simulated pins.
+func (p *Pin) PWM(duty gpio.Duty, f physic.Frequency) error {
+	return errors.New("sx1276sim: PWM isn't supported")
+}
+
+// Drive sets the level of the pin as seen by the driver, signalling
+// an edge to WaitForEdge if appropriate. It's meant for the simulated
+// chip the pin is wired to.
+func (p *Pin) Drive(l gpio.Level) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if l == p.level {
+		return
+	}
+	p.level = l
+
+	if (l == gpio.High && (p.edge == gpio.RisingEdge || p.edge == gpio.BothEdges)) ||
+		(l == gpio.Low && (p.edge == gpio.FallingEdge || p.edge == gpio.BothEdges)) {
+		select {
+		case p.edges <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package sx1276sim
+
+// reg_addr represents the address of one of the chip's registers.
+type reg_addr byte
+
+// Registers the simulator knows about. Check section 6 on the
+// datasheet for the complete register map in LoRa mode. Names
+// mirror the ones used by the rfm9x driver.
+const (
+	regFifo               reg_addr = 0x00
+	regOpMode             reg_addr = 0x01
+	regFrfMsb             reg_addr = 0x06
+	regFrfMid             reg_addr = 0x07
+	regFrfLsb             reg_addr = 0x08
+	regPaConfig           reg_addr = 0x09
+	regPaRamp             reg_addr = 0x0A
+	regOcp                reg_addr = 0x0B
+	regLna                reg_addr = 0x0C
+	regFifoAddrPtr        reg_addr = 0x0D
+	regFifoTxBaseAddr     reg_addr = 0x0E
+	regFifoRxBaseAddr     reg_addr = 0x0F
+	regFifoRxCurrentAddr  reg_addr = 0x10
+	regIrqFlagsMask       reg_addr = 0x11
+	regIrqFlags           reg_addr = 0x12
+	regRxNbBytes          reg_addr = 0x13
+	regRxHeaderCntMsb     reg_addr = 0x14
+	regRxHeaderCntLsb     reg_addr = 0x15
+	regRxPacketCntMsb     reg_addr = 0x16
+	regRxPacketCntLsb     reg_addr = 0x17
+	regModemStat          reg_addr = 0x18
+	regPktSnrValue        reg_addr = 0x19
+	regPktRssiValue       reg_addr = 0x1A
+	regRssiValue          reg_addr = 0x1B
+	regHopChannel         reg_addr = 0x1C
+	regModemConfigA       reg_addr = 0x1D
+	regModemConfigB       reg_addr = 0x1E
+	regSymbTimeoutLsb     reg_addr = 0x1F
+	regPreambleMsb        reg_addr = 0x20
+	regPreambleLsb        reg_addr = 0x21
+	regPayloadLength      reg_addr = 0x22
+	regMaxPayloadLength   reg_addr = 0x23
+	regHopPeriod          reg_addr = 0x24
+	regFifoRxByteAddr     reg_addr = 0x25
+	regModemConfigC       reg_addr = 0x26
+	regFeiMsb             reg_addr = 0x28
+	regFeiMid             reg_addr = 0x29
+	regFeiLsb             reg_addr = 0x2A
+	regRssiWideband       reg_addr = 0x2C
+	regDetectionOptimize  reg_addr = 0x31
+	regInvertIQ           reg_addr = 0x33
+	regDetectionThreshold reg_addr = 0x37
+	regSyncWord           reg_addr = 0x39
+	regDioMappingA        reg_addr = 0x40
+	regDioMappingB        reg_addr = 0x41
+	regVersion            reg_addr = 0x42
+	regPaDac              reg_addr = 0x4D
+)
+
+// Registers of the FSK/OOK modem. Those from 0x0D to 0x3F share
+// their addresses with the LoRa ones and are only reachable whilst
+// the FSK/OOK modem is selected. Check table 41 on the datasheet.
+const (
+	fskRegBitrateMsb    reg_addr = 0x02
+	fskRegBitrateLsb    reg_addr = 0x03
+	fskRegFdevMsb       reg_addr = 0x04
+	fskRegFdevLsb       reg_addr = 0x05
+	fskRegRxConfig      reg_addr = 0x0D
+	fskRegRssiConfig    reg_addr = 0x0E
+	fskRegRssiValue     reg_addr = 0x11
+	fskRegRxBw          reg_addr = 0x12
+	fskRegAfcBw         reg_addr = 0x13
+	fskRegPreambleDet   reg_addr = 0x1F
+	fskRegPreambleMsb   reg_addr = 0x25
+	fskRegPreambleLsb   reg_addr = 0x26
+	fskRegSyncConfig    reg_addr = 0x27
+	fskRegSyncValue1    reg_addr = 0x28
+	fskRegPacketConfig1 reg_addr = 0x30
+	fskRegPacketConfig2 reg_addr = 0x31
+	fskRegPayloadLength reg_addr = 0x32
+	fskRegFifoThresh    reg_addr = 0x35
+	fskRegIrqFlags1     reg_addr = 0x3E
+	fskRegIrqFlags2     reg_addr = 0x3F
+	fskRegBitrateFrac   reg_addr = 0x5D
+
+	// Bounds of the addresses whose registers depend on the modem.
+	bankedStart reg_addr = 0x0D
+	bankedEnd   reg_addr = 0x3F
+)
+
+// Operating modes as encoded on the 3 LSBs of RegOpMode.
+const (
+	modeSleep    byte = 0b000
+	modeStandby  byte = 0b001
+	modeFsTx     byte = 0b010
+	modeTx       byte = 0b011
+	modeFsRx     byte = 0b100
+	modeRxCont   byte = 0b101
+	modeRxSingle byte = 0b110
+	modeCad      byte = 0b111
+
+	modeMask     byte = 0b111
+	lowFreqMode  byte = 1 << 3
+	longRangeBit byte = 1 << 7
+)
+
+// Flags of the FSK/OOK modem as laid out on RegIrqFlags1 and 2.
+const (
+	fskModeReady    byte = 1 << 7
+	fskCrcOk        byte = 1 << 1
+	fskPayloadReady byte = 1 << 2
+	fskPacketSent   byte = 1 << 3
+	fskFifoOverrun  byte = 1 << 4
+	fskFifoLevel    byte = 1 << 5
+	fskFifoEmpty    byte = 1 << 6
+	fskFifoFull     byte = 1 << 7
+)
+
+// IRQ flags as laid out on RegIrqFlags.
+const (
+	irqCadDetected       byte = 1 << 0
+	irqFhssChangeChannel byte = 1 << 1
+	irqCadDone           byte = 1 << 2
+	irqTxDone            byte = 1 << 3
+	irqValidHeader       byte = 1 << 4
+	irqPayloadCrcError   byte = 1 << 5
+	irqRxDone            byte = 1 << 6
+	irqRxTimeout         byte = 1 << 7
+)
+
+// Modem status flags as laid out on RegModemStat.
+const (
+	modemStatSignalDetected     byte = 1 << 0
+	modemStatSignalSynchronized byte = 1 << 1
+	modemStatRxOngoing          byte = 1 << 2
+	modemStatHeaderInfoValid    byte = 1 << 3
+	modemStatClear              byte = 1 << 4
+)
+
+const (
+	// Version is the silicon revision reported on RegVersion.
+	Version byte = 0x12
+
+	// OscFreqHz is the frequency of the simulated crystal oscillator.
+	OscFreqHz = 32000000
+
+	// hopCrcOnPayload flags the reception of a payload CRC on RegHopChannel.
+	hopCrcOnPayload byte = 1 << 6
+
+	// fskFifoSize is the size of the FSK/OOK modem's FIFO.
+	fskFifoSize = 64
+
+	// fskSnrLimitDB is the minimum SNR the FSK/OOK modem can demodulate.
+	fskSnrLimitDB = 10
+
+	// hopPresentChannel masks the number of hops
+	// since the current packet began on RegHopChannel.
+	hopPresentChannel byte = 0x3F
+
+	// RSSI offsets for the high and low frequency ports as per
+	// section 5.5.5 on the datasheet.
+	rssiOffsetHF = -157
+	rssiOffsetLF = -164
+)
+
+var (
+	// bwID2Hz translates bandwidth IDs into actual bandwidths in Hz.
+	bwID2Hz = [10]uint{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000, 500000}
+
+	// resetValues holds the contents of the registers after a reset.
+	// Those not listed are reset to 0. Banked registers take the
+	// values of the LoRa modem: check fskResetValues for the rest.
+	resetValues = map[reg_addr]byte{
+		fskRegBitrateMsb:      0x1A,
+		fskRegBitrateLsb:      0x0B,
+		fskRegFdevLsb:         0x52,
+		regOpMode:             lowFreqMode | modeStandby,
+		regFrfMsb:             0x6C,
+		regFrfMid:             0x80,
+		regFrfLsb:             0x00,
+		regPaConfig:           0x4F,
+		regPaRamp:             0x09,
+		regOcp:                0x2B,
+		regLna:                0x20,
+		regFifoTxBaseAddr:     0x80,
+		regModemConfigA:       0x72,
+		regModemConfigB:       0x70,
+		regModemStat:          modemStatClear,
+		regSymbTimeoutLsb:     0x64,
+		regPreambleLsb:        0x08,
+		regPayloadLength:      0x01,
+		regMaxPayloadLength:   0xFF,
+		regDetectionOptimize:  0xC3,
+		regInvertIQ:           0x27,
+		regDetectionThreshold: 0x0A,
+		regSyncWord:           0x12,
+		regVersion:            Version,
+		regPaDac:              0x84,
+	}
+
+	// fskResetValues holds the contents of the FSK/OOK modem's
+	// banked registers after a reset, just like resetValues.
+	fskResetValues = map[reg_addr]byte{
+		fskRegRxConfig:       0x0E,
+		fskRegRssiConfig:     0x02,
+		fskRegRxBw:           0x15,
+		fskRegAfcBw:          0x0B,
+		fskRegPreambleDet:    0xAA,
+		fskRegPreambleLsb:    0x03,
+		fskRegSyncConfig:     0x93,
+		fskRegSyncValue1:     0x01,
+		fskRegSyncValue1 + 1: 0x01,
+		fskRegSyncValue1 + 2: 0x01,
+		fskRegSyncValue1 + 3: 0x01,
+		fskRegPacketConfig1:  0x90,
+		fskRegPacketConfig2:  0x40,
+		fskRegPayloadLength:  0x40,
+		fskRegFifoThresh:     0x8F,
+	}
+
+	// readOnlyRegs lists those registers whose writes are ignored.
+	// RegIrqFlags is handled separately as its bits are cleared
+	// by writing a 1 to them.
+	readOnlyRegs = map[reg_addr]bool{
+		regFifoRxCurrentAddr: true,
+		regRxNbBytes:         true,
+		regRxHeaderCntMsb:    true,
+		regRxHeaderCntLsb:    true,
+		regRxPacketCntMsb:    true,
+		regRxPacketCntLsb:    true,
+		regModemStat:         true,
+		regPktSnrValue:       true,
+		regPktRssiValue:      true,
+		regRssiValue:         true,
+		regHopChannel:        true,
+		regFifoRxByteAddr:    true,
+		regFeiMsb:            true,
+		regFeiMid:            true,
+		regFeiLsb:            true,
+		regRssiWideband:      true,
+		regVersion:           true,
+	}
+)
@@ -0,0 +1,769 @@
+/*
+Package sx1276sim implements an in-memory simulation of Semtech's SX1276
+LoRa transceiver. It emulates the register file, the 256-byte FIFO along
+with its base and pointer registers, operating mode transitions, IRQ flags
+and the reception registers (i.e. RxNbBytes, packet RSSI and SNR).
+
+A Chip implements both spi.Port and spi.Conn and exposes fake reset and
+DIO0 pins, so that it can be handed to rfm9x.New in place of real hardware:
+
+	chip := sx1276sim.New()
+	opts := rfm9x.DefaultOpts
+	opts.ResetPin = chip.ResetPin()
+	opts.DIO0Pin = chip.DIO0()
+	dev, err := rfm9x.New(chip, &opts)
+
+Frames sent by the driver are handed to OnTransmit as they go on the air,
+and received frames, CRC errors and reception timeouts can be injected with
+Inject and InjectTimeout. InjectPreamble leaves a frame half-received as if
+it were still on the air. Both Channel Activity Detection and the end of Rx
+single windows ask ChannelBusy whether there's a preamble on the air. Chips
+can also be attached to a Medium, which delivers the frames each of them
+sends to the rest. Simulators of other chip families (e.g. sx126xsim) join
+a Medium as a Node, so that they can talk to Chips too.
+
+Frequency hopping is emulated too: chips raise FhssChangeChannel on every
+hop and keep track of the channel they're tuned to by the end of each one,
+so that hopping frames only get through if the driver retunes both ends in
+step. Hopping frames reach OnTransmit once they're over, and receivers then
+follow their hops for as long again before flagging RxDone.
+
+So is the FSK/OOK modem, along with its own registers behind the banked
+addresses. Packets are streamed through its 64-byte FIFO at the configured
+bit rate, so that drivers must keep up with it: running out of data whilst
+transmitting corrupts the frame and letting the FIFO overflow whilst
+receiving drops it. FSK/OOK frames reach OnTransmit once they're over too,
+and receivers then take as long again to fill their FIFO. Instant chips
+move every byte at once, which limits them to packets fitting in the FIFO.
+
+Useful resources:
+
+	Datasheet: https://cdn-shop.adafruit.com/product-files/3179/sx1276_77_78_79.pdf
+*/
+package sx1276sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3"
+	"periph.io/x/conn/v3/gpio"
+	"periph.io/x/conn/v3/physic"
+	"periph.io/x/conn/v3/spi"
+)
+
+// Chip is a simulated SX1276. Its exported fields
+// should be set before the chip is used.
+type Chip struct {
+	// Instant makes transmissions complete right away
+	// instead of lasting for their time on air.
+	Instant bool
+
+	// NoiseFloorDBm is the RSSI reported on RegRssiValue.
+	NoiseFloorDBm int
+
+	// OnTransmit is called with every frame the chip starts
+	// transmitting. The transmission ends after the frame's
+	// TimeOnAir unless Instant is set. It runs on its own
+	// goroutine without holding any of the chip's locks,
+	// so it's free to Inject the frame into other chips.
+	OnTransmit func(Frame)
+
+	// ChannelBusy reports whether there's LoRa activity a chip
+	// listening with the modem parameters in the given frame can
+	// detect. It's consulted at the end of every Channel Activity
+	// Detection and Rx single window and, just like OnTransmit,
+	// it's called without holding any of the chip's locks. A nil
+	// ChannelBusy means the channel is always clear.
+	ChannelBusy func(Frame) bool
+
+	mu   sync.Mutex
+	regs [0x80]byte
+	fifo [256]byte
+
+	// fskRegs holds the FSK/OOK modem's banked registers.
+	fskRegs [0x80]byte
+
+	// fskFifo holds the contents of the FSK/OOK modem's FIFO.
+	fskFifo []byte
+
+	// fskFlags holds the sticky flags of RegIrqFlags2.
+	fskFlags byte
+
+	// fskRssi is the RSSI of the FSK/OOK packet last received.
+	fskRssi int
+
+	// stream is the FSK/OOK packet going through the FIFO, if any.
+	stream *fskStream
+
+	// rxAddr is the FIFO address the next received packet is written to.
+	rxAddr byte
+
+	// gen is bumped on every operating mode change so
+	// that pending transmissions can be cancelled.
+	gen uint
+
+	// inReset is set while the reset pin is held low.
+	inReset bool
+
+	// detach removes the chip from the medium it's attached to.
+	detach func()
+
+	resetPin *Pin
+	dio0Pin  *Pin
+}
+
+// New returns a simulated chip whose registers hold their reset values.
+func New() *Chip {
+	c := &Chip{NoiseFloorDBm: -120}
+	c.resetPin = NewPin("SIM_RESET", gpio.High, c.resetLevel)
+	c.dio0Pin = NewPin("SIM_DIO0", gpio.Low, nil)
+	c.reset()
+	return c
+}
+
+// ResetPin returns the fake pin wired to the chip's NRESET line.
+// Driving it low and then high resets the chip.
+func (c *Chip) ResetPin() *Pin {
+	return c.resetPin
+}
+
+// DIO0 returns the fake pin wired to the chip's DIO0 line.
+func (c *Chip) DIO0() *Pin {
+	return c.dio0Pin
+}
+
+// String implements spi.Port and spi.Conn.
+func (c *Chip) String() string {
+	return "sx1276sim"
+}
+
+// Connect implements spi.Port. The SX1276 only supports
+// SPI mode 0 with 8-bit words.
+func (c *Chip) Connect(f physic.Frequency, mode spi.Mode, bits int) (spi.Conn, error) {
+	if mode&(spi.Mode1|spi.Mode2|spi.Mode3) != spi.Mode0 {
+		return nil, fmt.Errorf("sx1276sim: unsupported SPI mode %v", mode)
+	}
+	if bits != 8 {
+		return nil, fmt.Errorf("sx1276sim: unsupported word size: %d bits", bits)
+	}
+	return c, nil
+}
+
+// LimitSpeed implements spi.PortCloser. It does nothing.
+func (c *Chip) LimitSpeed(f physic.Frequency) error {
+	return nil
+}
+
+// Close implements spi.PortCloser. It cancels any ongoing transmission
+// and detaches the chip from the medium it's attached to, if any.
+func (c *Chip) Close() error {
+	c.mu.Lock()
+	c.gen++
+	detach := c.detach
+	c.detach = nil
+	c.mu.Unlock()
+
+	if detach != nil {
+		detach()
+	}
+	return nil
+}
+
+// Duplex implements spi.Conn.
+func (c *Chip) Duplex() conn.Duplex {
+	return conn.Full
+}
+
+// Tx implements spi.Conn. The first byte in w holds the register
+// address along with the write bit. Bursts access consecutive
+// registers except for RegFifo, where they access consecutive
+// FIFO locations instead as per section 4.3 on the datasheet.
+func (c *Chip) Tx(w, r []byte) error {
+	if len(w) == 0 {
+		return nil
+	}
+	if len(r) != 0 && len(r) != len(w) {
+		return errors.New("sx1276sim: w and r must have the same length")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.advance(time.Now())
+
+	addr := reg_addr(w[0] & 0x7F)
+	write := w[0]&0x80 != 0
+
+	if len(r) != 0 {
+		r[0] = 0
+	}
+
+	for i := 1; i < len(w); i++ {
+		if write {
+			c.write(addr, w[i])
+			if len(r) != 0 {
+				r[i] = 0
+			}
+		} else {
+			data := c.read(addr)
+			if len(r) != 0 {
+				r[i] = data
+			}
+		}
+		if addr != regFifo {
+			addr = (addr + 1) & 0x7F
+		}
+	}
+
+	return nil
+}
+
+// TxPackets implements spi.Conn. Every packet is
+// processed as an independent transaction.
+func (c *Chip) TxPackets(p []spi.Packet) error {
+	for _, pkt := range p {
+		if err := c.Tx(pkt.W, pkt.R); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inject delivers f as if it had just been received over the
+// air. The frame is only received if the chip is listening with
+// the frame's modem: Inject returns whether that was the case.
+// Payload CRC errors can be simulated through f.CrcError. Frames
+// carrying several HopsHz are only received once the chip has
+// followed each of their hops, which takes as long as their time
+// on air unless Instant is set. FSK/OOK frames take as long to
+// stream into the FIFO.
+func (c *Chip) Inject(f Frame) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.Fsk {
+		return c.injectFsk(f)
+	}
+
+	mode := c.regs[regOpMode]
+	if mode&longRangeBit == 0 || (mode&modeMask != modeRxCont && mode&modeMask != modeRxSingle) {
+		return false
+	}
+
+	if len(f.HopsHz) > 1 && !c.Instant {
+		// The frame is only received if we follow every hop.
+		c.hop(f, f.TimeOnAir(), func(hops []uint) {
+			for i, hop := range f.HopsHz {
+				if i >= len(hops) || !sameChannel(hops[i], hop, f.BandwidthHz) {
+					return
+				}
+			}
+			c.receive(f)
+		})
+		return true
+	}
+
+	c.receive(f)
+	return true
+}
+
+// InjectPreamble makes a chip in reception mode behave as if a
+// frame had begun to arrive: RegModemStat reports a signal and, in
+// explicit header mode, ValidHeader is raised as if its header had
+// been received too. The frame is then completed through Inject or
+// dropped on the next operating mode change. InjectPreamble returns
+// whether the chip was in reception mode with the LoRa modem.
+func (c *Chip) InjectPreamble() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mode := c.regs[regOpMode]
+	if mode&longRangeBit == 0 || (mode&modeMask != modeRxCont && mode&modeMask != modeRxSingle) {
+		return false
+	}
+
+	c.regs[regModemStat] = modemStatSignalDetected | modemStatSignalSynchronized | modemStatRxOngoing
+	if c.regs[regModemConfigA]&0x1 == 0 {
+		c.regs[regModemStat] |= modemStatHeaderInfoValid
+		c.raise(irqValidHeader)
+	}
+	return true
+}
+
+// receive completes the reception of f, storing it on the FIFO and
+// raising RxDone. The lock must be held.
+func (c *Chip) receive(f Frame) {
+	mode := c.regs[regOpMode]
+	implicit := c.regs[regModemConfigA]&0x1 != 0
+
+	payload := f.Payload
+	if implicit {
+		payload = make([]byte, c.regs[regPayloadLength])
+		copy(payload, f.Payload)
+	}
+	if len(payload) > 0xFF {
+		payload = payload[:0xFF]
+	}
+
+	start := c.rxAddr
+	for i, b := range payload {
+		c.fifo[start+byte(i)] = b
+	}
+	c.rxAddr = start + byte(len(payload))
+
+	c.regs[regFifoRxCurrentAddr] = start
+	c.regs[regFifoRxByteAddr] = c.rxAddr
+	c.regs[regRxNbBytes] = byte(len(payload))
+	c.regs[regModemStat] = modemStatClear
+
+	snr := int(math.Max(math.Min(math.Round(f.SnrDB*4), math.MaxInt8), math.MinInt8))
+	c.regs[regPktSnrValue] = byte(int8(snr))
+
+	// Invert the RSSI corrections in section 5.5.5 of the datasheet.
+	rssi := f.RssiDBm - c.rssiOffset()
+	if snr < 0 {
+		rssi -= snr / 4
+	} else {
+		rssi = (rssi*15 + 15) / 16
+	}
+	c.regs[regPktRssiValue] = byte(clamp(rssi, 0, 0xFF))
+
+	// Invert the expression in section 4.1.5 of the datasheet.
+	fei := int64(0)
+	if bw := c.bandwidthHz(); bw != 0 {
+		fei = int64(f.FreqErrorHz) * OscFreqHz * 500000 / ((1 << 24) * int64(bw))
+	}
+	c.regs[regFeiMsb] = byte(fei>>16) & 0x0F
+	c.regs[regFeiMid] = byte(fei >> 8)
+	c.regs[regFeiLsb] = byte(fei)
+
+	crc := f.Crc
+	if implicit {
+		crc = c.regs[regModemConfigB]&0x4 != 0
+	}
+	c.regs[regHopChannel] &^= hopCrcOnPayload
+	if crc {
+		c.regs[regHopChannel] |= hopCrcOnPayload
+	}
+
+	cnt := uint16(c.regs[regRxPacketCntMsb])<<8 | uint16(c.regs[regRxPacketCntLsb]) + 1
+	c.regs[regRxPacketCntMsb], c.regs[regRxPacketCntLsb] = byte(cnt>>8), byte(cnt)
+
+	flags := irqRxDone
+	if !implicit {
+		flags |= irqValidHeader
+	}
+	if f.CrcError {
+		flags |= irqPayloadCrcError
+	}
+
+	if mode&modeMask == modeRxSingle {
+		c.setMode(modeStandby)
+	}
+	c.raise(flags)
+}
+
+// InjectTimeout makes a chip in single reception mode give up
+// on waiting for a packet, flagging a reception timeout. It
+// returns whether the chip was in single reception mode.
+func (c *Chip) InjectTimeout() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.regs[regOpMode]&modeMask != modeRxSingle {
+		return false
+	}
+	c.setMode(modeStandby)
+	c.raise(irqRxTimeout)
+	return true
+}
+
+// reset brings every register and the FIFO back to their reset values.
+func (c *Chip) reset() {
+	c.gen++
+	c.regs = [0x80]byte{}
+	c.fifo = [256]byte{}
+	c.rxAddr = 0
+	for addr, data := range resetValues {
+		c.regs[addr] = data
+	}
+	c.fskRegs = [0x80]byte{}
+	for addr, data := range fskResetValues {
+		c.fskRegs[addr] = data
+	}
+	c.fskFifo, c.fskFlags, c.stream = nil, 0, nil
+	c.updateDio()
+}
+
+// resetLevel tracks the level of the reset pin, resetting
+// the chip once it's released after being held low.
+func (c *Chip) resetLevel(l gpio.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if l == gpio.Low {
+		c.inReset = true
+		return
+	}
+	if c.inReset {
+		c.inReset = false
+		c.reset()
+	}
+}
+
+// read returns the contents of the register at addr.
+func (c *Chip) read(addr reg_addr) byte {
+	if c.fsk() && (addr == regFifo || addr >= bankedStart && addr <= bankedEnd) {
+		return c.readFsk(addr)
+	}
+
+	switch addr {
+	case regFifo:
+		data := c.fifo[c.regs[regFifoAddrPtr]]
+		c.regs[regFifoAddrPtr]++
+		return data
+	case regRssiValue:
+		return byte(clamp(c.NoiseFloorDBm-c.rssiOffset(), 0, 0xFF))
+	}
+	return c.regs[addr]
+}
+
+// write stores data on the register at addr,
+// triggering any side effects it may have.
+func (c *Chip) write(addr reg_addr, data byte) {
+	if c.fsk() && (addr == regFifo || addr >= bankedStart && addr <= bankedEnd) {
+		c.writeFsk(addr, data)
+		return
+	}
+
+	switch {
+	case addr == regFifo:
+		c.fifo[c.regs[regFifoAddrPtr]] = data
+		c.regs[regFifoAddrPtr]++
+	case addr == regOpMode:
+		c.writeOpMode(data)
+	case addr == regIrqFlags:
+		c.regs[regIrqFlags] &^= data
+		c.updateDio()
+	case addr == regDioMappingA:
+		c.regs[addr] = data
+		c.updateDio()
+	case !readOnlyRegs[addr]:
+		c.regs[addr] = data
+	}
+}
+
+// writeOpMode handles writes to RegOpMode. Note the LoRa bit
+// can only be modified in Sleep mode as per section 6.2.
+func (c *Chip) writeOpMode(data byte) {
+	prev := c.regs[regOpMode]
+	if prev&modeMask != modeSleep {
+		data = data&^longRangeBit | prev&longRangeBit
+	}
+	c.regs[regOpMode] = data&^modeMask | prev&modeMask
+	c.setMode(data & modeMask)
+}
+
+// setMode switches the operating mode to mode.
+func (c *Chip) setMode(mode byte) {
+	prev := c.regs[regOpMode] & modeMask
+	c.regs[regOpMode] = c.regs[regOpMode]&^modeMask | mode
+	if mode == prev {
+		return
+	}
+	c.gen++
+	c.regs[regModemStat] = modemStatClear
+
+	if c.fsk() {
+		c.setFskMode(mode)
+		return
+	}
+
+	switch mode {
+	case modeSleep:
+		// The FIFO is cleared when entering Sleep mode.
+		c.fifo = [256]byte{}
+	case modeTx:
+		c.startTx()
+	case modeRxCont, modeRxSingle:
+		c.rxAddr = c.regs[regFifoRxBaseAddr]
+		c.regs[regFifoRxByteAddr] = c.rxAddr
+		if mode == modeRxSingle {
+			c.startRxTimeout()
+		}
+	case modeCad:
+		c.startCad()
+	}
+}
+
+// startCad performs a Channel Activity Detection, which lasts for
+// about two symbols as per section 4.1.6 on the datasheet. The chip
+// then raises CadDone, along with CadDetected if the channel is busy,
+// and returns to Standby.
+func (c *Chip) startCad() {
+	f := c.frame()
+
+	t_cad := time.Duration(0)
+	if !c.Instant && f.BandwidthHz != 0 {
+		t_cad = 2 * time.Duration(math.Exp2(float64(f.SpreadingFactor))/float64(f.BandwidthHz)*float64(time.Second))
+	}
+
+	busy := c.ChannelBusy
+	gen := c.gen
+	time.AfterFunc(t_cad, func() {
+		detected := busy != nil && busy(f)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen {
+			// The detection was interrupted.
+			return
+		}
+		c.setMode(modeStandby)
+		if detected {
+			c.raise(irqCadDone | irqCadDetected)
+		} else {
+			c.raise(irqCadDone)
+		}
+	})
+}
+
+// startRxTimeout closes the Rx single window once the symbol
+// timeout elapses, raising RxTimeout and returning to Standby
+// unless a preamble is on the air by then, in which case we keep
+// waiting for the packet. Instant chips only time out through
+// InjectTimeout.
+func (c *Chip) startRxTimeout() {
+	f := c.frame()
+	if c.Instant || f.BandwidthHz == 0 {
+		return
+	}
+
+	symbols := uint16(c.regs[regModemConfigB]&0x3)<<8 | uint16(c.regs[regSymbTimeoutLsb])
+	t_window := time.Duration(symbols) * time.Duration(math.Exp2(float64(f.SpreadingFactor))/float64(f.BandwidthHz)*float64(time.Second))
+
+	busy := c.ChannelBusy
+	gen := c.gen
+	time.AfterFunc(t_window, func() {
+		detected := busy != nil && busy(f)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen || detected {
+			return
+		}
+		c.setMode(modeStandby)
+		c.raise(irqRxTimeout)
+	})
+}
+
+// startTx begins transmitting the PayloadLength bytes
+// in the FIFO starting at FifoTxBaseAddr. Frames sent
+// whilst hopping are handed to OnTransmit once they're
+// over, along with the frequency of each hop.
+func (c *Chip) startTx() {
+	f := c.frame()
+	f.Payload = make([]byte, c.regs[regPayloadLength])
+	for i := range f.Payload {
+		f.Payload[i] = c.fifo[c.regs[regFifoTxBaseAddr]+byte(i)]
+	}
+
+	t_air := time.Duration(0)
+	if !c.Instant {
+		t_air = f.TimeOnAir()
+	}
+
+	if f.HopPeriod != 0 && t_air > 0 {
+		// The hops aren't known until the transmission is over.
+		on_transmit := c.OnTransmit
+		c.hop(f, t_air, func(hops []uint) {
+			c.setMode(modeStandby)
+			c.raise(irqTxDone)
+			if on_transmit != nil {
+				f.HopsHz = hops
+				go on_transmit(f)
+			}
+		})
+		return
+	}
+
+	if c.OnTransmit != nil {
+		go c.OnTransmit(f)
+	}
+
+	gen := c.gen
+	time.AfterFunc(t_air, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if gen != c.gen {
+			// The transmission was interrupted.
+			return
+		}
+		c.setMode(modeStandby)
+		c.raise(irqTxDone)
+	})
+}
+
+// hop makes the chip hop across the channels of a packet lasting
+// t_air that began on the current channel with f's hop period. On
+// every hop it raises FhssChangeChannel and bumps the present
+// channel on RegHopChannel, leaving it to the driver to retune the
+// carrier. The frequency the chip was tuned to by the end of each
+// hop is recorded and handed to done once the packet is over, which
+// is called holding the lock unless the operating mode changes first.
+// The lock must be held.
+func (c *Chip) hop(f Frame, t_air time.Duration, done func([]uint)) {
+	t_hop := f.hopTime()
+	if t_hop <= 0 {
+		return
+	}
+	c.regs[regHopChannel] &^= hopPresentChannel
+
+	var (
+		hops  []uint
+		start = time.Now()
+		gen   = c.gen
+		next  func(n time.Duration)
+	)
+	next = func(n time.Duration) {
+		at := n * t_hop
+		if at > t_air {
+			at = t_air
+		}
+		time.AfterFunc(time.Until(start.Add(at)), func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if gen != c.gen {
+				// The packet was interrupted.
+				return
+			}
+			hops = append(hops, c.frame().FrequencyHz)
+			if at == t_air {
+				done(hops)
+				return
+			}
+			c.regs[regHopChannel] = c.regs[regHopChannel]&^hopPresentChannel | byte(n)&hopPresentChannel
+			c.raise(irqFhssChangeChannel)
+			next(n + 1)
+		})
+	}
+	next(1)
+}
+
+// Receiving returns the modem parameters the chip is listening
+// with and whether it's listening at all. It implements Node.
+func (c *Chip) Receiving() (Frame, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mode := c.regs[regOpMode]
+	if c.fsk() && mode&modeMask == modeRxCont {
+		f := c.fskFrame()
+		f.BandwidthHz = 2 * c.rxBwHz()
+		return f, true
+	}
+	if mode&longRangeBit == 0 || (mode&modeMask != modeRxCont && mode&modeMask != modeRxSingle) {
+		return Frame{}, false
+	}
+	return c.frame(), true
+}
+
+// frame returns an empty frame carrying the current modem parameters.
+func (c *Chip) frame() Frame {
+	if c.fsk() {
+		return c.fskFrame()
+	}
+
+	return Frame{
+		FrequencyHz:         c.frequencyHz(),
+		BandwidthHz:         c.bandwidthHz(),
+		SpreadingFactor:     c.regs[regModemConfigB] >> 4,
+		CodingRate:          (c.regs[regModemConfigA]>>1)&0x7 + 4,
+		PreambleLength:      uint16(c.regs[regPreambleMsb])<<8 | uint16(c.regs[regPreambleLsb]),
+		SyncWord:            c.regs[regSyncWord],
+		ImplicitHeader:      c.regs[regModemConfigA]&0x1 != 0,
+		HopPeriod:           c.regs[regHopPeriod],
+		LowDataRateOptimize: c.regs[regModemConfigC]&0x8 != 0,
+		Crc:                 c.regs[regModemConfigB]&0x4 != 0,
+		TxPowerDbm:          c.txPowerDbm(),
+	}
+}
+
+// frequencyHz returns the carrier frequency in Hz.
+func (c *Chip) frequencyHz() uint {
+	frf := uint64(c.regs[regFrfMsb])<<16 | uint64(c.regs[regFrfMid])<<8 | uint64(c.regs[regFrfLsb])
+	return uint((frf * OscFreqHz) >> 19)
+}
+
+// txPowerDbm returns the output power as per the expressions
+// in section 6.4 of the datasheet.
+func (c *Chip) txPowerDbm() int {
+	pa_conf := c.regs[regPaConfig]
+	o_pow := int(pa_conf & 0xF)
+
+	if pa_conf&0x80 != 0 {
+		if c.regs[regPaDac]&0x7 == 0x7 {
+			return o_pow + 5
+		}
+		return o_pow + 2
+	}
+
+	max_pow := 10.8 + 0.6*float64((pa_conf>>4)&0x7)
+	return int(max_pow) - (15 - o_pow)
+}
+
+// bandwidthHz returns the configured bandwidth or 0 if it's invalid.
+func (c *Chip) bandwidthHz() uint {
+	bw_id := c.regs[regModemConfigA] >> 4
+	if int(bw_id) >= len(bwID2Hz) {
+		return 0
+	}
+	return bwID2Hz[bw_id]
+}
+
+// rssiOffset returns the RSSI offset of the port in use.
+func (c *Chip) rssiOffset() int {
+	if c.regs[regOpMode]&lowFreqMode != 0 {
+		return rssiOffsetLF
+	}
+	return rssiOffsetHF
+}
+
+// raise sets the unmasked IRQ flags in flags.
+func (c *Chip) raise(flags byte) {
+	c.regs[regIrqFlags] |= flags &^ c.regs[regIrqFlagsMask]
+	c.updateDio()
+}
+
+// updateDio drives DIO0 with the IRQ flag mapped to it
+// on RegDioMappingA as per table 18 on the datasheet.
+func (c *Chip) updateDio() {
+	var flag byte
+	switch c.regs[regDioMappingA] >> 6 {
+	case 0b00:
+		flag = irqRxDone
+	case 0b01:
+		flag = irqTxDone
+	case 0b10:
+		flag = irqCadDone
+	}
+	c.dio0Pin.Drive(c.regs[regIrqFlags]&flag != 0)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,24 @@
+package sx1276
+
+// RegisterBus grants access to the chip's registers. Each platform
+// implements it on top of its own SPI interface.
+type RegisterBus interface {
+	// Read returns the contents of the register at addr.
+	Read(addr byte) (byte, error)
+
+	// Write overwrites the register at addr with data.
+	Write(addr, data byte) error
+
+	// ReadBurst fills data with consecutive reads starting at addr
+	// in a single SPI transaction. Bursts on RegFifo read consecutive
+	// FIFO locations instead as per section 4.3 on the datasheet.
+	ReadBurst(addr byte, data []byte) error
+
+	// WriteBurst writes data to consecutive registers starting at
+	// addr in a single SPI transaction. Just like with ReadBurst,
+	// bursts on RegFifo fill consecutive FIFO locations.
+	WriteBurst(addr byte, data []byte) error
+
+	// Reset drives the chip's reset pin to return it to a known state.
+	Reset() error
+}
@@ -0,0 +1,606 @@
+package sx1276
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Mode returns the current operation mode of the radio.
+// External users can leverage the OpModeText function
+// to convert it to a readable string.
+func (r *Radio) Mode() op_mode {
+	m, err := r.ReadRegister(RegOpMode, 3, 0)
+	if err != nil {
+		return 0x7
+	}
+	return op_mode(m)
+}
+
+// SetMode transitions the chip to the provided operation mode.
+// It resturns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetMode(mode op_mode) error {
+	return r.WriteRegister(RegOpMode, 3, 0, byte(mode))
+}
+
+// LowFreqMode returns a boolean indicating whether the radio is
+// currently configured to use the low or high frequency registers.
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) LowFreqMode() bool {
+	lf_mode, err := r.ReadRegister(RegOpMode, 1, 3)
+	if err != nil {
+		return false
+	}
+	return lf_mode == 0x1
+}
+
+// SetLowFreqMode configures the chip to use either low of high
+// frequency registers according to the value of enable.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetLowFreqMode(enable bool) error {
+	return r.WriteRegister(RegOpMode, 1, 3, boolToByte[enable])
+}
+
+// LoRa returns a boolean indicating whether the radio is
+// configured to use LoRa for transmitting information.
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) LoRa() bool {
+	op_mode, err := r.ReadRegister(RegOpMode, 1, 7)
+	if err != nil {
+		return false
+	}
+	return op_mode == 0x1
+}
+
+// SetLora configures the chip to use LoRa for sending data
+// depending on the value of enable. The radio must be in Sleep.
+// Check SetModem, which takes care of that and of retuning.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetLoRa(enable bool) error {
+	if err := r.WriteRegister(RegOpMode, 1, 7, boolToByte[enable]); err != nil {
+		return err
+	}
+	r.modem = ModemFsk
+	if enable {
+		r.modem = ModemLoRa
+	}
+	return nil
+}
+
+// CarrierFrequencyHz returns the current carrier frequency in Hz.
+// Frequencies are configured in steps of FStepHz (about 61 Hz), so
+// it might differ slightly from the one passed to SetCarrierFrequencyHz.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) CarrierFrequencyHz() (uint, error) {
+	msb, err := r.ReadRegister(RegFrfMsb, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+	mid, err := r.ReadRegister(RegFrfMid, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+	lsb, err := r.ReadRegister(RegFrfLsb, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	frf := int64((uint(msb)<<16)|(uint(mid)<<8)|uint(lsb)) & 0xFFFFFF
+
+	// Refer to section 4.1.4 for a justification of the following expression.
+	// Adding half a step before shifting rounds to the nearest Hz.
+	return uint((frf*OscFreqHz + 1<<18) >> 19), nil
+}
+
+// SetCarrierFrequencyHz configures the carrier frequency provided on
+// carrier_f as the one used by the radio. It is assumed to be in Hz and
+// it must lie within [MinFrequencyHz, MaxFrequencyHz].
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetCarrierFrequencyHz(carrier_f uint) error {
+	if carrier_f < MinFrequencyHz || carrier_f > MaxFrequencyHz {
+		return errors.New("frequency must belong to the [137, 1020] MHz interval: " + strconv.FormatUint(uint64(carrier_f), 10) + " Hz")
+	}
+
+	// Refer to section 4.1.4 for a justification of the following expression.
+	// Adding half the oscillator frequency rounds to the nearest step.
+	var frf int64 = ((int64(carrier_f)<<19 + OscFreqHz/2) / OscFreqHz) & 0xFFFFFF
+
+	if err := r.WriteRegister(RegFrfMsb, 8, 0, byte(frf>>16)); err != nil {
+		return err
+	}
+
+	if err := r.WriteRegister(RegFrfMid, 8, 0, byte(frf>>8)); err != nil {
+		return err
+	}
+
+	if err := r.WriteRegister(RegFrfLsb, 8, 0, byte(frf)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CarrierFrequencyMHz returns an integer indicating the current
+// carrier frequency rounded to the nearest MegaHertz (i.e. MHz).
+// It also returns any errors raised by the underlying SPI transaction.
+//
+// Deprecated: use CarrierFrequencyHz, which doesn't lose precision.
+func (r *Radio) CarrierFrequencyMHz() (int, error) {
+	carrier_f, err := r.CarrierFrequencyHz()
+	if err != nil {
+		return -1, err
+	}
+	return int((carrier_f + 500000) / 1000000), nil
+}
+
+// SetCarrierFrequencyMHz configures the carrier frequency provided on
+// carrier_f as the one used by the radio. It is assumed to be in MHz.
+// It returns any errors raised by the underlying SPI transaction.
+//
+// Deprecated: use SetCarrierFrequencyHz, which accepts fractional MHz.
+func (r *Radio) SetCarrierFrequencyMHz(carrier_f int64) error {
+	if carrier_f < 0 {
+		return errors.New("frequency must belong to the [137, 1020] MHz interval: " + strconv.FormatInt(carrier_f, 10) + " MHz")
+	}
+	return r.SetCarrierFrequencyHz(uint(carrier_f) * 1000000)
+}
+
+// PreambleLength returns the current preamble length.
+// It also returns any errors raised by the
+// underlying SPI transaction.
+func (r *Radio) PreambleLength() (uint16, error) {
+	msb, err := r.ReadRegister(RegPreambleMsb, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	lsb, err := r.ReadRegister(RegPreambleLsb, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(msb)<<8 | uint16(lsb), nil
+}
+
+// SetPreambleLength configures the preamble length provided on
+// ln as the one used by the radio.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetPreambleLength(ln uint16) error {
+	if err := r.WriteRegister(RegPreambleMsb, 8, 0, byte(ln>>8)); err != nil {
+		return err
+	}
+
+	return r.WriteRegister(RegPreambleLsb, 8, 0, byte(ln))
+}
+
+// CodingRate returns the current coding rate.
+// It also returns any errors raised by the
+// underlying SPI transaction.
+func (r *Radio) CodingRate() (byte, error) {
+	cr_id, err := r.ReadRegister(RegModemConfigA, 3, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return cr_id + 4, nil
+}
+
+// SetCodingRate configures the coding rate provided on
+// cr as the one used by the radio.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetCodingRate(cr byte) error {
+	if cr < 5 || cr > 8 {
+		return errors.New("incorrect coding rate id: " + strconv.Itoa(int(cr)))
+	}
+	return r.WriteRegister(RegModemConfigA, 3, 1, cr-4)
+}
+
+// SpreadingFactor returns the current spreading factor.
+// It also returns any errors raised by the
+// underlying SPI transaction.
+func (r *Radio) SpreadingFactor() (byte, error) {
+	sf, err := r.ReadRegister(RegModemConfigB, 4, 4)
+	if err != nil {
+		return 0, err
+	}
+	return sf, nil
+}
+
+// SetSpreadingFactor configures the spreading factor provided on
+// sf as the one used by the radio. Spreading factor 6 requires
+// implicit header mode: check SetImplicitHeader. The Low Data Rate
+// Optimisation is updated to match it.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetSpreadingFactor(sf byte) error {
+	if sf < 6 || sf > 12 {
+		return errors.New("incorrect spreading factor: " + strconv.Itoa(int(sf)))
+	}
+	if sf == 6 {
+		if err := r.WriteRegister(RegDetectionOptimize, 3, 0, 0x5); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegDetectionThreshold, 8, 0, 0x0C); err != nil {
+			return err
+		}
+	} else {
+		if err := r.WriteRegister(RegDetectionOptimize, 3, 0, 0x3); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegDetectionThreshold, 8, 0, 0x0A); err != nil {
+			return err
+		}
+	}
+	if err := r.WriteRegister(RegModemConfigB, 4, 4, sf); err != nil {
+		return err
+	}
+	return r.updateLdro()
+}
+
+// LowDataRateOptimize returns a boolean indicating whether
+// the Low Data Rate Optimisation is enabled.
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) LowDataRateOptimize() bool {
+	ldro, err := r.ReadRegister(RegModemConfigC, 1, 3)
+	if err != nil {
+		return false
+	}
+	return ldro == 0x1
+}
+
+// SetLowDataRateOptimize enables or disables the Low Data Rate
+// Optimisation depending on the value of enable. Note it's managed
+// automatically whenever the spreading factor or bandwidth change.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetLowDataRateOptimize(enable bool) error {
+	return r.WriteRegister(RegModemConfigC, 1, 3, boolToByte[enable])
+}
+
+// updateLdro enables the Low Data Rate Optimisation if the current
+// spreading factor and bandwidth make for symbols longer than 16 ms,
+// as mandated by the datasheet, and disables it otherwise.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) updateLdro() error {
+	sf, err := r.SpreadingFactor()
+	if err != nil {
+		return err
+	}
+	bw, err := r.BwHz()
+	if err != nil {
+		return err
+	}
+	return r.SetLowDataRateOptimize(symbolTime(sf, bw) > ldroSymbolTime)
+}
+
+// SymbolTimeout returns how many symbols the radio waits for a
+// preamble in Rx single mode before raising IrqRxTimeout.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) SymbolTimeout() (uint16, error) {
+	msb, err := r.ReadRegister(RegModemConfigB, 2, 0)
+	if err != nil {
+		return 0, err
+	}
+	lsb, err := r.ReadRegister(RegSymbTimeoutLsb, 8, 0)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(msb)<<8 | uint16(lsb), nil
+}
+
+// SetSymbolTimeout configures how many symbols the radio waits for
+// a preamble in Rx single mode, which must lie in [1, 1023]. The
+// reception window is then symbols times SymbolTime long.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) SetSymbolTimeout(symbols uint16) error {
+	if symbols < 1 || symbols > MaxSymbolTimeout {
+		return errors.New("symbol timeout must belong to the [1, 1023] interval: " + strconv.Itoa(int(symbols)))
+	}
+	if err := r.WriteRegister(RegModemConfigB, 2, 0, byte(symbols>>8)); err != nil {
+		return err
+	}
+	return r.WriteRegister(RegSymbTimeoutLsb, 8, 0, byte(symbols))
+}
+
+// Crc returns a boolean indicating whether
+// CRC is enabled for incoming and outgoing packets.
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) Crc() bool {
+	crc, err := r.ReadRegister(RegModemConfigB, 1, 2)
+	if err != nil {
+		return false
+	}
+	return crc == 0x1
+}
+
+// SetCrc configures the chip to include a CRC on incoming
+// and outgoing packets depending on the value of enable.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetCrc(enable bool) error {
+	if err := r.WriteRegister(RegModemConfigB, 1, 2, boolToByte[enable]); err != nil {
+		return err
+	}
+	r.crc = enable
+	return nil
+}
+
+// ImplicitHeader returns a boolean indicating whether the
+// LoRa header is left out of packets (i.e. implicit header mode).
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) ImplicitHeader() bool {
+	implicit, err := r.ReadRegister(RegModemConfigA, 1, 0)
+	if err != nil {
+		return false
+	}
+	return implicit == 0x1
+}
+
+// SetImplicitHeader configures the chip to leave the LoRa header
+// out of packets depending on the value of enable. As there's no
+// header to carry their length, both ends must agree on a fixed one
+// through SetPayloadLength. Note spreading factor 6 only works in
+// implicit header mode.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetImplicitHeader(enable bool) error {
+	if err := r.WriteRegister(RegModemConfigA, 1, 0, boolToByte[enable]); err != nil {
+		return err
+	}
+	r.implicit = enable
+	return nil
+}
+
+// PayloadLength returns the fixed payload length used in implicit
+// header mode. In explicit header mode it's just the length of the
+// last packet loaded through WritePacket.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) PayloadLength() (byte, error) {
+	return r.ReadRegister(RegPayloadLength, 8, 0)
+}
+
+// SetPayloadLength configures the fixed length of every packet sent
+// and received in implicit header mode, which can't be 0.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetPayloadLength(ln byte) error {
+	if ln == 0 {
+		return errors.New("payload length must be at least 1 byte")
+	}
+	if err := r.WriteRegister(RegPayloadLength, 8, 0, ln); err != nil {
+		return err
+	}
+	r.payloadLength = ln
+	return nil
+}
+
+// SyncWord returns the current LoRa sync word.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SyncWord() (byte, error) {
+	return r.ReadRegister(RegSyncWord, 8, 0)
+}
+
+// SetSyncWord configures the LoRa sync word provided on sw.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetSyncWord(sw byte) error {
+	return r.WriteRegister(RegSyncWord, 8, 0, sw)
+}
+
+// Agc returns a boolean indicating whether
+// Automatic Gain Control is enabled.
+// If the underlying SPI transaction raises an error, false will
+// always be returned.
+func (r *Radio) Agc() bool {
+	agc, err := r.ReadRegister(RegModemConfigC, 1, 2)
+	if err != nil {
+		return false
+	}
+
+	return agc == 0x1
+}
+
+// SetAgc configures the chip to use Automatic Gain Control
+// depending on the value of enable.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) SetAgc(enable bool) error {
+	return r.WriteRegister(RegModemConfigC, 1, 2, boolToByte[enable])
+}
+
+// TxPower returns the current transmission power in dBm.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) TxPower() (byte, error) {
+	o_pow, err := r.ReadRegister(RegPaConfig, 4, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	// Check whether we're transmitting through PA_BOOST.
+	pa_select, err := r.ReadRegister(RegPaConfig, 1, 7)
+	if err != nil {
+		return 0, err
+	}
+
+	if pa_select == 0x1 {
+		pa_dac, err := r.ReadRegister(RegPaDac, 3, 0)
+		if err != nil {
+			return 0, err
+		}
+		if pa_dac == PaDacEnable {
+			return o_pow + 8, nil
+		}
+		return o_pow + 5, nil
+	}
+	return o_pow - 1, nil
+}
+
+// SetTxPower configures the transmission power provided through pow.
+// It returns any errors raised by the underlying SPI transaction as
+// well as those triggered by a malformed input parameter.
+func (r *Radio) SetTxPower(pow uint) error {
+	if r.highPower {
+		if pow < 5 || pow > 23 {
+			return errors.New("incorrect tx power (should be between 5 and 23): " + strconv.FormatUint(uint64(pow), 10))
+		}
+
+		pa_dac := PaDacDisable
+		if pow > 20 {
+			pa_dac = PaDacEnable
+			pow -= 3
+		}
+		if err := r.WriteRegister(RegPaDac, 3, 0, pa_dac); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegPaConfig, 1, 7, 0x1); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegPaConfig, 3, 4, 0x04); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegPaConfig, 4, 0, byte((pow-5)&0xF)); err != nil {
+			return err
+		}
+	} else {
+		if pow > 14 {
+			return errors.New("incorrect tx power (should be between 0 and 14): " + strconv.FormatUint(uint64(pow), 10))
+		}
+		if err := r.WriteRegister(RegPaConfig, 1, 7, 0x0); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegPaConfig, 3, 4, 0x7); err != nil {
+			return err
+		}
+		if err := r.WriteRegister(RegPaConfig, 4, 0, byte((pow+1)&0xF)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BwHz returns the current transmission bandwidth in Hz.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) BwHz() (uint, error) {
+	bw_id, err := r.ReadRegister(RegModemConfigA, 4, 4)
+	if err != nil {
+		return 0, err
+	}
+	if int(bw_id) >= len(BWID2Hz) {
+		return 500000, nil
+	}
+	return BWID2Hz[bw_id], nil
+}
+
+// SetBwHz configures the transmission bandwidth based on bw [Hz].
+// The Low Data Rate Optimisation is updated to match it.
+// It returns any errors raised by the underlying SPI transaction.
+// Values exceeding the maximum bandwidth will be truncated to the
+// largest one available (i.e. 500 kHz).
+func (r *Radio) SetBwHz(bw uint) error {
+	/*
+	 * Check the datasheet at:
+	 * https://www.digchip.com/datasheets/download_datasheet.php?id=8756311&part-number=SX1276RF1KAS
+	 * for information on the 'magic numbers' scattered throughout the function.
+	 */
+
+	var (
+		c_bw  uint
+		bw_id int
+	)
+
+	if bw > BWID2Hz[len(BWID2Hz)-1] {
+		c_bw, bw_id = 500000, 9
+	} else {
+		for bw_id, c_bw = range BWID2Hz {
+			if bw <= c_bw {
+				break
+			}
+		}
+	}
+
+	if err := r.WriteRegister(RegModemConfigA, 4, 4, byte(bw_id)); err != nil {
+		return err
+	}
+
+	if c_bw >= 500000 {
+		if err := r.WriteRegister(RegDetectionOptimize, 1, 7, 0x1); err != nil {
+			return err
+		}
+
+		if err := r.WriteRegister(RegHighBwOptimize1, 8, 0, 0x02); err != nil {
+			return err
+		}
+
+		l_freq_mode, err := r.ReadRegister(RegOpMode, 1, 3)
+		if err != nil {
+			return err
+		}
+
+		if l_freq_mode == 0x1 {
+			if err := r.WriteRegister(RegHighBwOptimize2, 8, 0, 0x7F); err != nil {
+				return err
+			}
+		} else {
+			if err := r.WriteRegister(RegHighBwOptimize2, 8, 0, 0x64); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := r.WriteRegister(RegDetectionOptimize, 1, 7, 0x0); err != nil {
+			return err
+		}
+
+		if err := r.WriteRegister(RegHighBwOptimize1, 8, 0, 0x03); err != nil {
+			return err
+		}
+		if c_bw == 7800 {
+			if err := r.WriteRegister(RegIfFreq2, 8, 0, 0x48); err != nil {
+				return err
+			}
+		} else if c_bw >= 62500 {
+			if err := r.WriteRegister(RegIfFreq2, 8, 0, 0x40); err != nil {
+				return err
+			}
+		} else {
+			if err := r.WriteRegister(RegIfFreq2, 8, 0, 0x44); err != nil {
+				return err
+			}
+		}
+		if err := r.WriteRegister(RegIfFreq1, 8, 0, 0x0); err != nil {
+			return err
+		}
+	}
+
+	return r.updateLdro()
+}
+
+// FifoBaseAddrs returns the value of the pointers indicating
+// where the transmission and reception hardware FIFOs start,
+// respectively. It also returns any errors raised by the
+// underlying SPI transactions.
+func (r *Radio) FifoBaseAddrs() (byte, byte, error) {
+	tx, err := r.ReadRegister(RegFifoTxBaseAddr, 8, 0)
+	if err != nil {
+		return 0xFF, 0xFF, err
+	}
+	rx, err := r.ReadRegister(RegFifoRxBaseAddr, 8, 0)
+	if err != nil {
+		return tx, 0xFF, err
+	}
+	return tx, rx, nil
+}
+
+// SetFifoBaseAddrs configures the hardware FIFOs to begin at the
+// provided addresses. It returns any errors triggered by the
+// underlying SPI transaction.
+func (r *Radio) SetFifoBaseAddrs(tx, rx byte) error {
+	// The chip has a single 256-bit long FIFO. We can take full advantage
+	// of it by setting both the Tx and Rx addresses to 0, but we'll just
+	// be multiplexing it back and forth. We could also, if needed, allocate
+	// half the FIFO for Tx and the rest for Rx so as to avoid cleaning it
+	// up when swapping between transceiver modes.
+	if err := r.WriteRegister(RegFifoTxBaseAddr, 8, 0, tx); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegFifoRxBaseAddr, 8, 0, rx); err != nil {
+		return err
+	}
+	return nil
+}
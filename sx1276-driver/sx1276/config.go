@@ -0,0 +1,294 @@
+package sx1276
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Config gathers every LoRa modem parameter of the radio so
+// that emitters and receivers can be configured identically
+// from a single place through ApplyConfig. The Low Data Rate
+// Optimisation is derived from the spreading factor and the
+// bandwidth: check NeedsLdro.
+type Config struct {
+	// FrequencyHz is the carrier frequency in Hz. Check
+	// the Plans for the channels allowed in each region.
+	FrequencyHz uint
+
+	// PreambleLength is the length of the preamble in symbols.
+	// Refer to section 4.1.1.6 in the datasheet for more information.
+	PreambleLength uint16
+
+	// BandwidthHz is the signal bandwidth in Hz. It must be
+	// one of the bandwidths listed in BWID2Hz or 500 kHz.
+	BandwidthHz uint
+
+	// CodingRate is the denominator of the 4/x coding rate.
+	CodingRate byte
+
+	// SpreadingFactor is the spreading factor, from 6 to 12.
+	SpreadingFactor byte
+
+	// HighPower specifies whether to transmit through the PA_BOOST
+	// pin, which is the one wired on Adafruit's RFM9x breakouts.
+	HighPower bool
+
+	// TxPowerDbm is the transmission power in dBm. It must lie in
+	// [5, 23] when HighPower is set and in [0, 14] otherwise.
+	TxPowerDbm uint
+
+	// SyncWord is the LoRa sync word telling apart different
+	// networks. Check SyncWordPrivate and SyncWordPublic.
+	SyncWord byte
+
+	// ImplicitHeader specifies whether to leave the LoRa
+	// header out of the packets we send and receive.
+	ImplicitHeader bool
+
+	// PayloadLength is the fixed length of every packet in
+	// implicit header mode, where there's no header to carry
+	// it. It's ignored in explicit header mode.
+	PayloadLength byte
+
+	// Crc specifies whether to append and check payload CRCs.
+	Crc bool
+
+	// Agc specifies whether Automatic Gain Control is enabled.
+	Agc bool
+
+	// SymbolTimeout is how many symbols the radio waits for a
+	// preamble in Rx single mode, from 1 to MaxSymbolTimeout.
+	SymbolTimeout uint16
+}
+
+// DefaultConfig holds the modem parameters the drivers
+// configure unless told otherwise.
+var DefaultConfig = Config{
+	FrequencyHz:     915000000,
+	PreambleLength:  8,
+	BandwidthHz:     125000,
+	CodingRate:      5,
+	SpreadingFactor: 7,
+	HighPower:       true,
+	TxPowerDbm:      13,
+	SyncWord:        SyncWordPrivate,
+	ImplicitHeader:  false,
+	Crc:             true,
+	Agc:             false,
+	SymbolTimeout:   100,
+}
+
+// SyncWords holds the named sync words
+// ParseSyncWord accepts indexed by name.
+var SyncWords = map[string]byte{
+	"private": SyncWordPrivate,
+	"public":  SyncWordPublic,
+}
+
+// ParseSyncWord parses either the name of a sync word in SyncWords,
+// such as public, or its value, such as 0x34. Names are case
+// insensitive and values can be given in decimal too.
+func ParseSyncWord(s string) (byte, error) {
+	if sw, ok := SyncWords[strings.ToLower(s)]; ok {
+		return sw, nil
+	}
+	sw, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, errors.New("invalid sync word: " + s)
+	}
+	return byte(sw), nil
+}
+
+// Validate checks whether c describes a configuration the radio
+// supports. It returns an error describing the first problem found.
+func (c Config) Validate() error {
+	if c.FrequencyHz < MinFrequencyHz || c.FrequencyHz > MaxFrequencyHz {
+		return errors.New("frequency must belong to the [137, 1020] MHz interval: " + strconv.FormatUint(uint64(c.FrequencyHz), 10) + " Hz")
+	}
+
+	if c.PreambleLength < 6 {
+		return errors.New("preamble must be at least 6 symbols long: " + strconv.Itoa(int(c.PreambleLength)))
+	}
+
+	if _, ok := bwHzToID(c.BandwidthHz); !ok {
+		return errors.New("unsupported bandwidth: " + strconv.FormatUint(uint64(c.BandwidthHz), 10) + " Hz")
+	}
+
+	if c.CodingRate < 5 || c.CodingRate > 8 {
+		return errors.New("incorrect coding rate id: " + strconv.Itoa(int(c.CodingRate)))
+	}
+
+	if c.SpreadingFactor < 6 || c.SpreadingFactor > 12 {
+		return errors.New("incorrect spreading factor: " + strconv.Itoa(int(c.SpreadingFactor)))
+	}
+
+	// Refer to section 4.1.1.2 in the datasheet.
+	if c.SpreadingFactor == 6 && !c.ImplicitHeader {
+		return errors.New("spreading factor 6 requires implicit header mode")
+	}
+
+	if c.ImplicitHeader && c.PayloadLength == 0 {
+		return errors.New("implicit header mode requires a fixed payload length")
+	}
+
+	if c.SymbolTimeout < 1 || c.SymbolTimeout > MaxSymbolTimeout {
+		return errors.New("symbol timeout must belong to the [1, 1023] interval: " + strconv.Itoa(int(c.SymbolTimeout)))
+	}
+
+	if c.HighPower && (c.TxPowerDbm < 5 || c.TxPowerDbm > 23) {
+		return errors.New("incorrect tx power (should be between 5 and 23): " + strconv.FormatUint(uint64(c.TxPowerDbm), 10))
+	}
+	if !c.HighPower && c.TxPowerDbm > 14 {
+		return errors.New("incorrect tx power (should be between 0 and 14): " + strconv.FormatUint(uint64(c.TxPowerDbm), 10))
+	}
+
+	return nil
+}
+
+// bwHzToID returns the bandwidth ID matching bw exactly,
+// if there's any.
+func bwHzToID(bw uint) (byte, bool) {
+	if bw == 500000 {
+		return byte(len(BWID2Hz)), true
+	}
+	for id, c_bw := range BWID2Hz {
+		if c_bw == bw {
+			return byte(id), true
+		}
+	}
+	return 0, false
+}
+
+// ApplyConfig validates and then configures every modem parameter
+// in c. If c isn't valid nothing is written at all. The radio should
+// be in Sleep or Standby. Platforms wanting to group the writes can
+// do so by buffering them on their RegisterBus. If a hopping sequence
+// is configured the radio ends up tuned to its first channel. The
+// LoRa modem must be selected, failing with ErrModem otherwise.
+// It returns any errors raised by the validation, the setters or
+// the underlying SPI transactions.
+func (r *Radio) ApplyConfig(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if r.modem != ModemLoRa {
+		return wrapError{ErrModem, "LoRa configuration with the " + r.modem.String() + " modem"}
+	}
+
+	if err := r.SetLowFreqMode(c.FrequencyHz <= lowFreqMaxHz); err != nil {
+		return err
+	}
+	if err := r.SetCarrierFrequencyHz(c.FrequencyHz); err != nil {
+		return err
+	}
+	if err := r.SetPreambleLength(c.PreambleLength); err != nil {
+		return err
+	}
+	if err := r.SetBwHz(c.BandwidthHz); err != nil {
+		return err
+	}
+	if err := r.SetCodingRate(c.CodingRate); err != nil {
+		return err
+	}
+	if err := r.SetSpreadingFactor(c.SpreadingFactor); err != nil {
+		return err
+	}
+	if err := r.SetImplicitHeader(c.ImplicitHeader); err != nil {
+		return err
+	}
+	if c.ImplicitHeader {
+		if err := r.SetPayloadLength(c.PayloadLength); err != nil {
+			return err
+		}
+	}
+	if err := r.SetSyncWord(c.SyncWord); err != nil {
+		return err
+	}
+	if err := r.SetCrc(c.Crc); err != nil {
+		return err
+	}
+	if err := r.SetAgc(c.Agc); err != nil {
+		return err
+	}
+	if err := r.SetSymbolTimeout(c.SymbolTimeout); err != nil {
+		return err
+	}
+	r.highPower = c.HighPower
+	if err := r.SetTxPower(c.TxPowerDbm); err != nil {
+		return err
+	}
+	if r.hopping.Period != 0 {
+		// The hopping sequence overrides the carrier frequency.
+		return r.SetHopping(r.hopping)
+	}
+	return nil
+}
+
+// ReadConfig reconstructs the live configuration from the radio's
+// registers, which makes it possible to detect drift with respect
+// to the configuration that was applied. The LoRa modem must be
+// selected, failing with ErrModem otherwise.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) ReadConfig() (Config, error) {
+	if r.modem != ModemLoRa {
+		return Config{}, wrapError{ErrModem, "LoRa configuration with the " + r.modem.String() + " modem"}
+	}
+
+	var (
+		c   Config
+		err error
+	)
+
+	if c.FrequencyHz, err = r.CarrierFrequencyHz(); err != nil {
+		return Config{}, err
+	}
+	if c.PreambleLength, err = r.PreambleLength(); err != nil {
+		return Config{}, err
+	}
+	if c.BandwidthHz, err = r.BwHz(); err != nil {
+		return Config{}, err
+	}
+	if c.CodingRate, err = r.CodingRate(); err != nil {
+		return Config{}, err
+	}
+	if c.SpreadingFactor, err = r.SpreadingFactor(); err != nil {
+		return Config{}, err
+	}
+
+	pa_select, err := r.ReadRegister(RegPaConfig, 1, 7)
+	if err != nil {
+		return Config{}, err
+	}
+	c.HighPower = pa_select == 0x1
+
+	tx_pow, err := r.TxPower()
+	if err != nil {
+		return Config{}, err
+	}
+	c.TxPowerDbm = uint(tx_pow)
+
+	if c.SyncWord, err = r.SyncWord(); err != nil {
+		return Config{}, err
+	}
+
+	implicit, err := r.ReadRegister(RegModemConfigA, 1, 0)
+	if err != nil {
+		return Config{}, err
+	}
+	c.ImplicitHeader = implicit == 0x1
+	if c.ImplicitHeader {
+		if c.PayloadLength, err = r.PayloadLength(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	c.Crc = r.Crc()
+	c.Agc = r.Agc()
+
+	if c.SymbolTimeout, err = r.SymbolTimeout(); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
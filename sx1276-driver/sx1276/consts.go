@@ -0,0 +1,218 @@
+package sx1276
+
+type op_mode byte
+type reg_addr byte
+
+const (
+	// Configuration register addresses.
+	// See `https://go.dev/src/net/http/status.go` for an example from the Go authors.
+	RegFifo                reg_addr = 0x00
+	RegOpMode              reg_addr = 0x01
+	RegFrfMsb              reg_addr = 0x06
+	RegFrfMid              reg_addr = 0x07
+	RegFrfLsb              reg_addr = 0x08
+	RegPaConfig            reg_addr = 0x09
+	RegPaRamp              reg_addr = 0x0A
+	RegOcp                 reg_addr = 0x0B
+	RegLna                 reg_addr = 0x0C
+	RegFifoAddrPtr         reg_addr = 0x0D
+	RegFifoTxBaseAddr      reg_addr = 0x0E
+	RegFifoRxBaseAddr      reg_addr = 0x0F
+	RegFifoRxCurrentAddr   reg_addr = 0x10
+	RegIrqFlagsMask        reg_addr = 0x11
+	RegIrqFlags            reg_addr = 0x12
+	RegRxNbBytes           reg_addr = 0x13
+	RegRxHeaderCntValueMsb reg_addr = 0x14
+	RegRxHeaderCntValueLsb reg_addr = 0x15
+	RegRxHacketCntValueMsb reg_addr = 0x16
+	RegRxHacketCntValueLsb reg_addr = 0x17
+	RegModemStat           reg_addr = 0x18
+	RegPktSnrValue         reg_addr = 0x19
+	RegPktRssiValue        reg_addr = 0x1A
+	RegRssiValue           reg_addr = 0x1B
+	RegHopChannel          reg_addr = 0x1C
+	RegModemConfigA        reg_addr = 0x1D
+	RegModemConfigB        reg_addr = 0x1E
+	RegSymbTimeoutLsb      reg_addr = 0x1F
+	RegPreambleMsb         reg_addr = 0x20
+	RegPreambleLsb         reg_addr = 0x21
+	RegPayloadLength       reg_addr = 0x22
+	RegMaxPayloadLength    reg_addr = 0x23
+	RegHopPeriod           reg_addr = 0x24
+	RegFifoRxByteAddr      reg_addr = 0x25
+	RegModemConfigC        reg_addr = 0x26
+	RegFeiMsb              reg_addr = 0x28
+	RegFeiMid              reg_addr = 0x29
+	RegFeiLsb              reg_addr = 0x2A
+	RegDioMappingA         reg_addr = 0x40
+	RegDioMappingB         reg_addr = 0x41
+	RegVersion             reg_addr = 0x42
+	RegTcxo                reg_addr = 0x4B
+	RegPaDac               reg_addr = 0x4D
+	RegFormerTemp          reg_addr = 0x5B
+	RegAgcRef              reg_addr = 0x61
+	RegAgcThreshA          reg_addr = 0x62
+	RegAgcThreshB          reg_addr = 0x63
+	RegAgcThreshC          reg_addr = 0x64
+	RegDetectionOptimize   reg_addr = 0x31
+	RegDetectionThreshold  reg_addr = 0x37
+	RegSyncWord            reg_addr = 0x39
+
+	// Undocumented registers tweaked as per sections 2.1 and 2.3
+	// of the errata to improve sensitivity and rejection.
+	RegIfFreq2         reg_addr = 0x2F
+	RegIfFreq1         reg_addr = 0x30
+	RegHighBwOptimize1 reg_addr = 0x36
+	RegHighBwOptimize2 reg_addr = 0x3A
+
+	// Registers of the FSK/OOK modem, which share their addresses
+	// with those of the LoRa modem from 0x0D to 0x3F. They're only
+	// reachable whilst the FSK/OOK modem is selected. Check table
+	// 41 on the datasheet.
+	RegBitrateMsb       reg_addr = 0x02
+	RegBitrateLsb       reg_addr = 0x03
+	RegFdevMsb          reg_addr = 0x04
+	RegFdevLsb          reg_addr = 0x05
+	RegRxConfig         reg_addr = 0x0D
+	RegRssiConfig       reg_addr = 0x0E
+	RegFskRssiValue     reg_addr = 0x11
+	RegRxBw             reg_addr = 0x12
+	RegAfcBw            reg_addr = 0x13
+	RegPreambleDetect   reg_addr = 0x1F
+	RegFskPreambleMsb   reg_addr = 0x25
+	RegFskPreambleLsb   reg_addr = 0x26
+	RegSyncConfig       reg_addr = 0x27
+	RegSyncValue1       reg_addr = 0x28
+	RegPacketConfig1    reg_addr = 0x30
+	RegPacketConfig2    reg_addr = 0x31
+	RegFskPayloadLength reg_addr = 0x32
+	RegFifoThresh       reg_addr = 0x35
+	RegIrqFlags1        reg_addr = 0x3E
+	RegIrqFlags2        reg_addr = 0x3F
+	RegBitrateFrac      reg_addr = 0x5D
+
+	// Check table 42 on the datasheet for information on
+	// the mapping of operating modes.
+	OpModeSleep    op_mode = 0b000
+	OpModeStandby  op_mode = 0b001
+	OpModeFsTx     op_mode = 0b010
+	OpModeTx       op_mode = 0b011
+	OpModeFsRx     op_mode = 0b100
+	OpModeRx       op_mode = 0b101
+	OpModeRxSingle op_mode = 0b110
+	OpModeCad      op_mode = 0b111
+
+	// Oscilator frequency. Check section 3 on the datasheet
+	OscFreqHz int64 = 32000000
+
+	// Conversion factor for carrier frequency configuration.
+	// Check section 4.1.4 on the datasheet for details.
+	FStepHz int64 = OscFreqHz / 524288 // 524288 = 2^19
+
+	// Range of carrier frequencies the SX1276 can be tuned to
+	// across all of its bands. Check table 7 on the datasheet.
+	MinFrequencyHz uint = 137000000
+	MaxFrequencyHz uint = 1020000000
+
+	// Highest carrier frequency served by the low frequency
+	// registers (i.e. bands 2 and 3).
+	lowFreqMaxHz uint = 525000000
+
+	// Values for enabling or disabling the Power Amplifier's features.
+	PaDacEnable  byte = 0x7
+	PaDacDisable byte = 0x4
+
+	// Signals mapped to the DIO0 pin through RegDioMappingA.
+	// Check table 18 on the datasheet for the complete mapping.
+	Dio0RxDone  byte = 0b00
+	Dio0TxDone  byte = 0b01
+	Dio0CadDone byte = 0b10
+
+	// Masks for the flags held in RegIrqFlags.
+	// Check table 17 on the datasheet for details.
+	IrqCadDetected       byte = 1 << 0
+	IrqFhssChangeChannel byte = 1 << 1
+	IrqCadDone           byte = 1 << 2
+	IrqTxDone            byte = 1 << 3
+	IrqValidHeader       byte = 1 << 4
+	IrqPayloadCrcError   byte = 1 << 5
+	IrqRxDone            byte = 1 << 6
+	IrqRxTimeout         byte = 1 << 7
+
+	// Masks for the flags held in RegModemStat.
+	// Check RegModemStat's description on the datasheet for details.
+	ModemStatSignalDetected     byte = 1 << 0
+	ModemStatSignalSynchronized byte = 1 << 1
+	ModemStatRxOngoing          byte = 1 << 2
+	ModemStatHeaderInfoValid    byte = 1 << 3
+	ModemStatModemClear         byte = 1 << 4
+
+	// Masks for the flags held in RegIrqFlags2 whilst the FSK/OOK
+	// modem is selected. Check table 41 on the datasheet for details.
+	IrqFskCrcOk        byte = 1 << 1
+	IrqFskPayloadReady byte = 1 << 2
+	IrqFskPacketSent   byte = 1 << 3
+	IrqFskFifoOverrun  byte = 1 << 4
+	IrqFskFifoLevel    byte = 1 << 5
+	IrqFskFifoEmpty    byte = 1 << 6
+	IrqFskFifoFull     byte = 1 << 7
+
+	// Size of the FIFO whilst the FSK/OOK modem is selected.
+	// Longer packets are streamed through it as they go.
+	FskFifoSize int = 64
+
+	// Bit of RegHopChannel signalling the received packet carried a CRC.
+	HopChannelCrcOnPayload byte = 1 << 6
+
+	// Offsets applied to raw RSSI readings depending on the RF port
+	// in use. Check section 5.5.5 on the datasheet for details.
+	RssiOffsetHF int = -157
+	RssiOffsetLF int = -164
+
+	// Size of the radio's FIFO, which bounds the length of packets.
+	FifoSize int = 256
+
+	// Largest packet the radio can send or receive.
+	MaxPacketLength int = FifoSize - 1
+
+	// Longest Rx single window in symbols, as the
+	// symbol timeout is a 10-bit value.
+	MaxSymbolTimeout uint16 = 0x3FF
+
+	// LoRa sync words. Radios drop the packets sent with a
+	// sync word other than theirs, which keeps networks sharing
+	// a channel apart. SyncWordPublic is reserved for LoRaWAN.
+	SyncWordPrivate byte = 0x12
+	SyncWordPublic  byte = 0x34
+)
+
+var (
+	// BWID2Hz allows us to translate bandwidth IDs to the appropriate frequencies in Hertzs (i.e. Hz).
+	BWID2Hz [9]uint = [9]uint{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000}
+
+	// opModeText allows us to translate numeric operation modes into
+	// user-friendly strings suitable for textual output.
+	opModeText = map[op_mode]string{
+		OpModeSleep:    "Sleep",
+		OpModeStandby:  "Standby",
+		OpModeFsTx:     "FsTx",
+		OpModeTx:       "Tx",
+		OpModeFsRx:     "FsRx",
+		OpModeRx:       "Rx",
+		OpModeRxSingle: "RxSingle",
+		OpModeCad:      "CAD",
+	}
+
+	// boolToByte maps boolean values to a byte so that we can make writes
+	// more succinct when configuring boolean properties of the chip.
+	boolToByte = map[bool]byte{
+		false: 0x0,
+		true:  0x1,
+	}
+)
+
+// OpModeText wraps the opModeText map so that it can be safely
+// leveraged from the 'outside world'.
+func OpModeText(m op_mode) string {
+	return opModeText[m]
+}
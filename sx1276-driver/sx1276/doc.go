@@ -0,0 +1,19 @@
+/*
+Package sx1276 implements the hardware-independent core shared by the
+drivers for Semtech's SX1276/77/78/79 radio transceivers. It holds the
+register map, the modem configuration logic, packet handling and
+time-on-air math.
+
+Every platform just needs to implement the tiny RegisterBus interface,
+be it on top of periph (Raspberry Pi, Orange Pi) or TinyGo's machine.SPI
+(Raspberry Pi Pico, Arduino). Only the standard library is used so that
+the package can be compiled with TinyGo too.
+
+Useful resources:
+
+	Datasheet: https://cdn-shop.adafruit.com/product-files/3179/sx1276_77_78_79.pdf
+	Errata: https://www.digchip.com/datasheets/download_datasheet.php?id=8756311&part-number=SX1276RF1KAS
+	Reference Python implementation: https://github.com/adafruit/Adafruit_CircuitPython_RFM9x/blob/main/adafruit_rfm9x.py
+	Reference C++ implementation: https://github.com/mirtcho/LoRa/blob/master/src/LoRa.cpp
+*/
+package sx1276
@@ -0,0 +1,596 @@
+package sx1276
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrModem is returned when trying to do something
+// the currently selected modem doesn't support.
+var ErrModem = errors.New("unsupported by the selected modem")
+
+// Modem identifies the modems the radio can switch between.
+type Modem byte
+
+const (
+	// ModemLoRa is the LoRa modem, which the drivers select by default.
+	ModemLoRa Modem = iota
+
+	// ModemFsk is the FSK/OOK modem. Check FskConfig.Ook for
+	// choosing between both modulations.
+	ModemFsk
+)
+
+// String returns the modem's name.
+func (m Modem) String() string {
+	switch m {
+	case ModemLoRa:
+		return "LoRa"
+	case ModemFsk:
+		return "FSK/OOK"
+	}
+	return "Modem(" + strconv.Itoa(int(m)) + ")"
+}
+
+// FskConfig gathers every parameter of the FSK/OOK modem so that
+// emitters and receivers can be configured identically from a single
+// place through ApplyFskConfig. Packets are sent in packet mode and
+// begin with a preamble of alternating bits followed by the sync
+// word. The transmission power is shared with the LoRa modem and set
+// through Config. Refer to section 4.2 in the datasheet for more
+// information.
+type FskConfig struct {
+	// FrequencyHz is the carrier frequency in Hz.
+	FrequencyHz uint
+
+	// Ook selects On-Off Keying rather than Frequency Shift Keying.
+	Ook bool
+
+	// BitrateBps is the bit rate in bits per second. It must lie in
+	// [1200, 300000] with FSK and in [1200, 32768] with OOK.
+	BitrateBps uint
+
+	// FdevHz is the frequency deviation in Hz, from 600 to 200000.
+	// It's ignored with OOK.
+	FdevHz uint
+
+	// RxBwHz is the single side bandwidth of the receiver in Hz.
+	// The narrowest bandwidth the radio supports that is at least
+	// as wide is used, which should exceed FdevHz plus half the
+	// bit rate with FSK.
+	RxBwHz uint
+
+	// Shaping selects the data shaping filter. With FSK 0 disables
+	// it and 1, 2 and 3 select a Gaussian filter with a BT of 1.0,
+	// 0.5 and 0.3 respectively (i.e. GFSK). With OOK 0 disables it
+	// and 1 and 2 cut off at the bit rate and twice the bit rate.
+	Shaping byte
+
+	// PreambleLength is the length of the preamble in bytes.
+	PreambleLength uint16
+
+	// SyncWord holds the 1 to 8 bytes of the sync word, none
+	// of which can be 0x00. Radios drop the packets sent with
+	// a sync word other than theirs.
+	SyncWord []byte
+
+	// FixedLength specifies whether every packet is PayloadLength
+	// bytes long. Otherwise packets begin with a length byte.
+	FixedLength bool
+
+	// PayloadLength is the length of every packet when FixedLength
+	// is set and the longest packet we accept otherwise.
+	PayloadLength byte
+
+	// Whitening specifies whether to scramble the payload so that
+	// it doesn't carry long runs of identical bits.
+	Whitening bool
+
+	// Crc specifies whether to append and check payload CRCs.
+	Crc bool
+
+	// FifoThreshold is how many bytes, from 1 to 62, the FIFO is kept
+	// above whilst receiving and below whilst transmitting packets
+	// longer than the FIFO, which are streamed through it.
+	FifoThreshold byte
+}
+
+// DefaultFskConfig holds the FSK/OOK modem parameters the drivers
+// configure unless told otherwise. Packets are framed just like
+// RadioHead's RH_RF69 does, with a 4 bytes preamble, 0x2D 0xD4 as
+// the sync word, variable lengths, whitening and CRCs.
+var DefaultFskConfig = FskConfig{
+	FrequencyHz:    915000000,
+	Ook:            false,
+	BitrateBps:     4800,
+	FdevHz:         5000,
+	RxBwHz:         10400,
+	Shaping:        0,
+	PreambleLength: 4,
+	SyncWord:       []byte{0x2D, 0xD4},
+	FixedLength:    false,
+	PayloadLength:  byte(MaxPacketLength),
+	Whitening:      true,
+	Crc:            true,
+	FifoThreshold:  32,
+}
+
+// Validate checks whether c describes a configuration the radio
+// supports. It returns an error describing the first problem found.
+func (c FskConfig) Validate() error {
+	if c.FrequencyHz < MinFrequencyHz || c.FrequencyHz > MaxFrequencyHz {
+		return errors.New("frequency must belong to the [137, 1020] MHz interval: " + strconv.FormatUint(uint64(c.FrequencyHz), 10) + " Hz")
+	}
+
+	max_bitrate := uint(300000)
+	if c.Ook {
+		max_bitrate = 32768
+	}
+	if c.BitrateBps < 1200 || c.BitrateBps > max_bitrate {
+		return errors.New("bit rate must belong to the [1200, " + strconv.FormatUint(uint64(max_bitrate), 10) + "] interval: " + strconv.FormatUint(uint64(c.BitrateBps), 10) + " bps")
+	}
+
+	if !c.Ook && (c.FdevHz < 600 || c.FdevHz > 200000) {
+		return errors.New("frequency deviation must belong to the [600, 200000] Hz interval: " + strconv.FormatUint(uint64(c.FdevHz), 10) + " Hz")
+	}
+
+	if _, ok := rxBwToReg(c.RxBwHz, c.Ook); !ok {
+		return errors.New("unsupported rx bandwidth: " + strconv.FormatUint(uint64(c.RxBwHz), 10) + " Hz")
+	}
+
+	if c.Shaping > 3 || (c.Ook && c.Shaping > 2) {
+		return errors.New("incorrect data shaping: " + strconv.Itoa(int(c.Shaping)))
+	}
+
+	if c.PreambleLength < 2 {
+		return errors.New("preamble must be at least 2 bytes long: " + strconv.Itoa(int(c.PreambleLength)))
+	}
+
+	if len(c.SyncWord) < 1 || len(c.SyncWord) > 8 {
+		return errors.New("sync word must be from 1 to 8 bytes long: " + strconv.Itoa(len(c.SyncWord)))
+	}
+	for _, b := range c.SyncWord {
+		if b == 0x00 {
+			return errors.New("sync word can't contain 0x00 bytes")
+		}
+	}
+
+	if c.PayloadLength == 0 {
+		return errors.New("payload length must be at least 1 byte")
+	}
+
+	if c.FifoThreshold < 1 || int(c.FifoThreshold) > FskFifoSize-2 {
+		return errors.New("FIFO threshold must belong to the [1, 62] interval: " + strconv.Itoa(int(c.FifoThreshold)))
+	}
+
+	return nil
+}
+
+// rxBwHz returns the receiver bandwidth configured through the given
+// mantissa and exponent. Check section 4.2.6 on the datasheet.
+func rxBwHz(mant, exp byte, ook bool) uint {
+	if ook {
+		exp++
+	}
+	div := int64(mant) << (exp + 2)
+	return uint((OscFreqHz + div/2) / div)
+}
+
+// rxBwMants holds the mantissas of RegRxBw indexed by their value.
+var rxBwMants = [3]byte{16, 20, 24}
+
+// rxBwToReg returns the value of RegRxBw selecting the narrowest
+// bandwidth at least as wide as bw, if there's any.
+func rxBwToReg(bw uint, ook bool) (byte, bool) {
+	var (
+		reg  byte
+		best uint
+	)
+	for exp := byte(1); exp <= 7; exp++ {
+		for id, mant := range rxBwMants {
+			c_bw := rxBwHz(mant, exp, ook)
+			if c_bw >= bw && (best == 0 || c_bw < best) {
+				reg, best = byte(id)<<3|exp, c_bw
+			}
+		}
+	}
+	return reg, best != 0
+}
+
+// Modem returns the modem selected through SetModem or SetLoRa.
+// A reset selects ModemFsk.
+func (r *Radio) Modem() Modem {
+	return r.modem
+}
+
+// SetModem selects modem m, which can only happen in Sleep: the radio
+// is left in Sleep, which wipes the FIFO. As both modems share the
+// carrier frequency, the radio is then retuned to the frequency it
+// was on the last time m was selected, if any, and restarts hopping
+// when switching over to ModemLoRa.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) SetModem(m Modem) error {
+	op, err := r.bus.Read(byte(RegOpMode))
+	if err != nil {
+		return err
+	}
+	op = op&^0x07 | byte(OpModeSleep)
+	if err := r.bus.Write(byte(RegOpMode), op); err != nil {
+		return err
+	}
+
+	carrier_f, err := r.CarrierFrequencyHz()
+	if err != nil {
+		return err
+	}
+	r.carriersHz[r.modem] = carrier_f
+
+	// Keep LowFrequencyModeOn whilst replacing LongRangeMode and
+	// the bits following it, which select the FSK modulation.
+	op &= 1<<3 | 0x07
+	if m == ModemLoRa {
+		op |= 1 << 7
+	} else if r.fsk.Ook {
+		op |= 1 << 5
+	}
+	if err := r.bus.Write(byte(RegOpMode), op); err != nil {
+		return err
+	}
+	r.modem = m
+
+	if carrier_f := r.carriersHz[m]; carrier_f != 0 {
+		if err := r.SetLowFreqMode(carrier_f <= lowFreqMaxHz); err != nil {
+			return err
+		}
+		if err := r.SetCarrierFrequencyHz(carrier_f); err != nil {
+			return err
+		}
+	}
+	if m == ModemLoRa {
+		return r.RestartHopping()
+	}
+	return nil
+}
+
+// ApplyFskConfig validates and then configures every FSK/OOK modem
+// parameter in c. If c isn't valid nothing is written at all. The
+// FSK/OOK modem must be selected, failing with ErrModem otherwise,
+// and the radio should be in Sleep or Standby.
+// It returns any errors raised by the validation or the underlying
+// SPI transactions.
+func (r *Radio) ApplyFskConfig(c FskConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if r.modem != ModemFsk {
+		return wrapError{ErrModem, "FSK/OOK configuration with the " + r.modem.String() + " modem"}
+	}
+
+	if err := r.WriteRegister(RegOpMode, 2, 5, boolToByte[c.Ook]); err != nil {
+		return err
+	}
+	if err := r.SetLowFreqMode(c.FrequencyHz <= lowFreqMaxHz); err != nil {
+		return err
+	}
+	if err := r.SetCarrierFrequencyHz(c.FrequencyHz); err != nil {
+		return err
+	}
+
+	// Refer to section 4.2.3 for the expressions involved. The bit rate
+	// is split into an integer part and a fractional one in sixteenths.
+	br := (OscFreqHz*16 + int64(c.BitrateBps)/2) / int64(c.BitrateBps)
+	if err := r.WriteRegister(RegBitrateMsb, 8, 0, byte(br>>12)); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegBitrateLsb, 8, 0, byte(br>>4)); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegBitrateFrac, 4, 0, byte(br)); err != nil {
+		return err
+	}
+
+	fdev := (int64(c.FdevHz)<<19 + OscFreqHz/2) / OscFreqHz
+	if err := r.WriteRegister(RegFdevMsb, 6, 0, byte(fdev>>8)); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegFdevLsb, 8, 0, byte(fdev)); err != nil {
+		return err
+	}
+
+	if err := r.WriteRegister(RegPaRamp, 2, 5, c.Shaping); err != nil {
+		return err
+	}
+
+	rx_bw, _ := rxBwToReg(c.RxBwHz, c.Ook)
+	if err := r.WriteRegister(RegRxBw, 5, 0, rx_bw); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegAfcBw, 5, 0, rx_bw); err != nil {
+		return err
+	}
+
+	// Let the AGC settle on the preamble, which is detected once two
+	// bytes have been received with up to 10 chip errors.
+	if err := r.WriteRegister(RegRxConfig, 8, 0, 0x0E); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegPreambleDetect, 8, 0, 0xAA); err != nil {
+		return err
+	}
+
+	if err := r.WriteRegister(RegFskPreambleMsb, 8, 0, byte(c.PreambleLength>>8)); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegFskPreambleLsb, 8, 0, byte(c.PreambleLength)); err != nil {
+		return err
+	}
+
+	// Restart the reception on its own after each packet and look
+	// for a sync word of the given size after a 0xAA preamble.
+	if err := r.WriteRegister(RegSyncConfig, 8, 0, 0x50|byte(len(c.SyncWord)-1)); err != nil {
+		return err
+	}
+	for i, b := range c.SyncWord {
+		if err := r.WriteRegister(RegSyncValue1+reg_addr(i), 8, 0, b); err != nil {
+			return err
+		}
+	}
+
+	// Keep packets failing their CRC in the FIFO so that they're
+	// reported rather than silently dropped.
+	pkt_conf := byte(1 << 3)
+	if !c.FixedLength {
+		pkt_conf |= 1 << 7
+	}
+	if c.Whitening {
+		pkt_conf |= 0b10 << 5
+	}
+	if c.Crc {
+		pkt_conf |= 1 << 4
+	}
+	if err := r.WriteRegister(RegPacketConfig1, 8, 0, pkt_conf); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegPacketConfig2, 8, 0, 1<<6); err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegFskPayloadLength, 8, 0, c.PayloadLength); err != nil {
+		return err
+	}
+
+	// Start transmitting as soon as the FIFO isn't empty.
+	if err := r.WriteRegister(RegFifoThresh, 8, 0, 1<<7|c.FifoThreshold); err != nil {
+		return err
+	}
+
+	r.fsk = c
+	r.fsk.SyncWord = append([]byte(nil), c.SyncWord...)
+	return nil
+}
+
+// ReadFskConfig reconstructs the live FSK/OOK configuration from the
+// radio's registers, which makes it possible to detect drift with
+// respect to the configuration that was applied. Frequencies and
+// bit rates are quantised by the radio, so they might differ slightly
+// from the applied ones, and RxBwHz is the bandwidth that was picked.
+// The FSK/OOK modem must be selected, failing with ErrModem otherwise.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) ReadFskConfig() (FskConfig, error) {
+	if r.modem != ModemFsk {
+		return FskConfig{}, wrapError{ErrModem, "FSK/OOK configuration with the " + r.modem.String() + " modem"}
+	}
+
+	var (
+		c    FskConfig
+		regs [8]byte
+		err  error
+	)
+
+	if c.FrequencyHz, err = r.CarrierFrequencyHz(); err != nil {
+		return FskConfig{}, err
+	}
+
+	for i, addr := range []reg_addr{RegOpMode, RegBitrateMsb, RegBitrateLsb, RegBitrateFrac, RegFdevMsb, RegFdevLsb, RegPaRamp, RegRxBw} {
+		if regs[i], err = r.bus.Read(byte(addr)); err != nil {
+			return FskConfig{}, err
+		}
+	}
+
+	c.Ook = (regs[0]>>5)&0b11 == 0x1
+	if br := int64(regs[1])<<12 | int64(regs[2])<<4 | int64(regs[3]&0x0F); br != 0 {
+		c.BitrateBps = uint((OscFreqHz*16 + br/2) / br)
+	}
+	fdev := int64(regs[4]&0x3F)<<8 | int64(regs[5])
+	c.FdevHz = uint((fdev*OscFreqHz + 1<<18) >> 19)
+	c.Shaping = (regs[6] >> 5) & 0b11
+	if mant := (regs[7] >> 3) & 0b11; int(mant) < len(rxBwMants) {
+		c.RxBwHz = rxBwHz(rxBwMants[mant], regs[7]&0x07, c.Ook)
+	}
+
+	msb, err := r.ReadRegister(RegFskPreambleMsb, 8, 0)
+	if err != nil {
+		return FskConfig{}, err
+	}
+	lsb, err := r.ReadRegister(RegFskPreambleLsb, 8, 0)
+	if err != nil {
+		return FskConfig{}, err
+	}
+	c.PreambleLength = uint16(msb)<<8 | uint16(lsb)
+
+	sync_size, err := r.ReadRegister(RegSyncConfig, 3, 0)
+	if err != nil {
+		return FskConfig{}, err
+	}
+	c.SyncWord = make([]byte, sync_size+1)
+	for i := range c.SyncWord {
+		if c.SyncWord[i], err = r.ReadRegister(RegSyncValue1+reg_addr(i), 8, 0); err != nil {
+			return FskConfig{}, err
+		}
+	}
+
+	pkt_conf, err := r.ReadRegister(RegPacketConfig1, 8, 0)
+	if err != nil {
+		return FskConfig{}, err
+	}
+	c.FixedLength = pkt_conf&(1<<7) == 0
+	c.Whitening = (pkt_conf>>5)&0b11 == 0b10
+	c.Crc = pkt_conf&(1<<4) != 0
+
+	if c.PayloadLength, err = r.ReadRegister(RegFskPayloadLength, 8, 0); err != nil {
+		return FskConfig{}, err
+	}
+	if c.FifoThreshold, err = r.ReadRegister(RegFifoThresh, 6, 0); err != nil {
+		return FskConfig{}, err
+	}
+
+	return c, nil
+}
+
+// FskIrqFlags returns the contents of RegIrqFlags2, which holds the
+// flags of the FSK/OOK modem. Check the IrqFsk* masks for the meaning
+// of each bit.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) FskIrqFlags() (byte, error) {
+	return r.bus.Read(byte(RegIrqFlags2))
+}
+
+// ClearFskFifo empties the FIFO of the FSK/OOK modem
+// along with the flags reflecting its state.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) ClearFskFifo() error {
+	return r.bus.Write(byte(RegIrqFlags2), IrqFskFifoOverrun)
+}
+
+// FskRssi returns the Received Signal Strength Indicator in dBm
+// as last measured by the FSK/OOK modem.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) FskRssi() (int, error) {
+	rssi, err := r.bus.Read(byte(RegFskRssiValue))
+	if err != nil {
+		return 0, err
+	}
+	return -int(rssi) / 2, nil
+}
+
+// WriteFskPacket empties the FIFO of the FSK/OOK modem and loads as
+// much of payload as it fits, preceded by its length unless packets
+// have a fixed length. The radio sends it as soon as it enters Tx and
+// whatever didn't fit is returned so that it can be streamed through
+// FeedFskPacket as the FIFO drains. The radio should be in Standby.
+// Payloads longer than the configured PayloadLength fail with
+// ErrPayloadTooLong and, with fixed length packets, those whose length
+// isn't PayloadLength fail with ErrPayloadLength.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) WriteFskPacket(payload []byte) ([]byte, error) {
+	if r.modem != ModemFsk {
+		return nil, wrapError{ErrModem, "FSK/OOK packet with the " + r.modem.String() + " modem"}
+	}
+	if r.fsk.FixedLength && len(payload) != int(r.fsk.PayloadLength) {
+		return nil, wrapError{ErrPayloadLength, strconv.Itoa(len(payload)) + " bytes (expected " + strconv.Itoa(int(r.fsk.PayloadLength)) + ")"}
+	}
+	if len(payload) > int(r.fsk.PayloadLength) {
+		return nil, wrapError{ErrPayloadTooLong, strconv.Itoa(len(payload)) + " bytes (max. " + strconv.Itoa(int(r.fsk.PayloadLength)) + ")"}
+	}
+
+	if err := r.ClearFskFifo(); err != nil {
+		return nil, err
+	}
+
+	frame := payload
+	if !r.fsk.FixedLength {
+		frame = append([]byte{byte(len(payload))}, payload...)
+	}
+	n := len(frame)
+	if n > FskFifoSize {
+		n = FskFifoSize
+	}
+	if err := r.WriteFifo(frame[:n]); err != nil {
+		return nil, err
+	}
+	return frame[n:], nil
+}
+
+// FeedFskPacket tops the FIFO up with the rest of the packet being
+// sent, as returned by WriteFskPacket or a previous call, once flags
+// (the contents of RegIrqFlags2) show the FIFO has drained below the
+// threshold. It returns whatever is still left to write, which must
+// be fed before the FIFO runs out for the packet to go out intact.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) FeedFskPacket(rest []byte, flags byte) ([]byte, error) {
+	if len(rest) == 0 || flags&IrqFskFifoLevel != 0 {
+		return rest, nil
+	}
+
+	n := len(rest)
+	if free := FskFifoSize - int(r.fsk.FifoThreshold); n > free {
+		n = free
+	}
+	if err := r.WriteFifo(rest[:n]); err != nil {
+		return rest, err
+	}
+	return rest[n:], nil
+}
+
+// FskReception keeps track of a packet being received by the FSK/OOK
+// modem, which must be read out of the FIFO as it arrives if it's
+// longer than the FIFO. Its zero value is ready to use.
+type FskReception struct {
+	// Payload holds the part of the packet read so far, without
+	// its length byte. Setting it to an empty slice backed by a
+	// buffer before the reception begins avoids allocations.
+	Payload []byte
+
+	// length is the length of the packet once it's known.
+	length int
+	known  bool
+}
+
+// ReadFskPacket reads out of the FIFO as much of the packet tracked
+// by rx as flags (the contents of RegIrqFlags2) show is safe to read.
+// It returns whether the whole packet has been read, which is only the
+// case once IrqFskPayloadReady is set. Check CheckFskCrc afterwards.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) ReadFskPacket(rx *FskReception, flags byte) (bool, error) {
+	ready := flags&IrqFskPayloadReady != 0
+	if !ready && flags&IrqFskFifoLevel == 0 {
+		return false, nil
+	}
+
+	// The FIFO holds more than the threshold at least.
+	avail := int(r.fsk.FifoThreshold) + 1
+	if !rx.known {
+		rx.length = int(r.fsk.PayloadLength)
+		if !r.fsk.FixedLength {
+			pkt_len, err := r.bus.Read(byte(RegFifo))
+			if err != nil {
+				return false, err
+			}
+			rx.length = int(pkt_len)
+			avail--
+		}
+		rx.known = true
+	}
+
+	n := rx.length - len(rx.Payload)
+	if !ready && n > avail {
+		n = avail
+	}
+	if n > 0 {
+		start := len(rx.Payload)
+		rx.Payload = append(rx.Payload, make([]byte, n)...)
+		if err := r.ReadFifo(rx.Payload[start:]); err != nil {
+			return false, err
+		}
+	}
+	return ready, nil
+}
+
+// CheckFskCrc inspects the flags of a packet received by the FSK/OOK
+// modem, provided on flags, to make sure its CRC was valid. It returns
+// ErrCRC if it wasn't. There's nothing to check if CRCs are disabled.
+func (r *Radio) CheckFskCrc(flags byte) error {
+	if r.fsk.Crc && flags&IrqFskCrcOk == 0 {
+		return ErrCRC
+	}
+	return nil
+}
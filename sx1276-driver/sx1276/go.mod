@@ -0,0 +1,3 @@
+module github.com/ulbios/lora/sx1276-driver/sx1276
+
+go 1.17
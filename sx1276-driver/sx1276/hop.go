@@ -0,0 +1,130 @@
+package sx1276
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Hopping configures the Frequency Hopping Spread Spectrum (FHSS)
+// of the radio, which retunes the carrier every few symbols whilst
+// a packet is being sent or received so that long packets don't
+// dwell on a single channel. Both ends must hop across the same
+// channels with the same period. Refer to section 4.1.1.8 in the
+// datasheet for more information.
+type Hopping struct {
+	// ChannelsHz lists the carrier frequencies to hop across in
+	// order, starting over once the end is reached. Every packet
+	// begins on the first one, which overrides the carrier
+	// frequency in the Config whilst hopping.
+	ChannelsHz []uint
+
+	// Period is how many symbols to stay on each channel.
+	// Leave it as 0 to disable hopping.
+	Period byte
+}
+
+// Validate checks whether h describes a hopping sequence the
+// radio supports. All channels must lie on the same band, as
+// they're served by the same port. It returns an error
+// describing the first problem found.
+func (h Hopping) Validate() error {
+	if h.Period == 0 {
+		return nil
+	}
+	if len(h.ChannelsHz) == 0 {
+		return errors.New("hopping requires at least one channel")
+	}
+
+	low := h.ChannelsHz[0] <= lowFreqMaxHz
+	for _, f := range h.ChannelsHz {
+		if f < MinFrequencyHz || f > MaxFrequencyHz {
+			return errors.New("frequency must belong to the [137, 1020] MHz interval: " + strconv.FormatUint(uint64(f), 10) + " Hz")
+		}
+		if (f <= lowFreqMaxHz) != low {
+			return errors.New("every hopping channel must lie on the same band: " + strconv.FormatUint(uint64(f), 10) + " Hz")
+		}
+	}
+	return nil
+}
+
+// HopPeriod returns how many symbols the radio stays on
+// each channel when hopping, which is 0 if it doesn't hop.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) HopPeriod() (byte, error) {
+	return r.ReadRegister(RegHopPeriod, 8, 0)
+}
+
+// HopChannel returns the number of hops since the packet being
+// sent or received began, wrapping around after 63. That is,
+// the FhssPresentChannel field in RegHopChannel.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) HopChannel() (byte, error) {
+	return r.ReadRegister(RegHopChannel, 6, 0)
+}
+
+// Hopping returns the hopping sequence configured through
+// SetHopping, whose Period is 0 if the radio doesn't hop.
+func (r *Radio) Hopping() Hopping {
+	return r.hopping
+}
+
+// SetHopping validates and then configures the hopping sequence
+// in h, tuning the radio to its first channel. Disabling hopping
+// leaves the radio on whatever channel it's tuned to. Once it's
+// enabled, IrqFhssChangeChannel must be serviced through ServiceHop
+// whilst packets are sent or received. The radio should be in
+// Sleep or Standby.
+// It returns any errors raised by the validation or the
+// underlying SPI transactions.
+func (r *Radio) SetHopping(h Hopping) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if h.Period != 0 {
+		if err := r.SetLowFreqMode(h.ChannelsHz[0] <= lowFreqMaxHz); err != nil {
+			return err
+		}
+	}
+	if err := r.WriteRegister(RegHopPeriod, 8, 0, h.Period); err != nil {
+		return err
+	}
+	r.hopping = Hopping{ChannelsHz: append([]uint(nil), h.ChannelsHz...), Period: h.Period}
+	return r.RestartHopping()
+}
+
+// RestartHopping tunes the radio to the first channel of the hopping
+// sequence, where every packet begins. It must be called before
+// sending or receiving each packet. It does nothing unless hopping,
+// which only the LoRa modem does.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) RestartHopping() error {
+	r.hops = 0
+	if r.hopping.Period == 0 || r.modem != ModemLoRa {
+		return nil
+	}
+	return r.SetCarrierFrequencyHz(r.hopping.ChannelsHz[0])
+}
+
+// ServiceHop handles the IrqFhssChangeChannel interrupt signalled
+// on flags, if any, by tuning the radio to the channel the chip has
+// just hopped to and then clearing the flag. It must be called
+// within a hop period of the interrupt for both ends to stay in
+// sync. It does nothing unless hopping, which only the LoRa modem does.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) ServiceHop(flags byte) error {
+	if r.hopping.Period == 0 || r.modem != ModemLoRa || flags&IrqFhssChangeChannel == 0 {
+		return nil
+	}
+
+	n, err := r.HopChannel()
+	if err != nil {
+		return err
+	}
+	// HopChannel wraps around after 63, so we keep count
+	// ourselves, catching up on any hops we missed.
+	r.hops += int((n - byte(r.hops)) & 0x3F)
+	if err := r.SetCarrierFrequencyHz(r.hopping.ChannelsHz[r.hops%len(r.hopping.ChannelsHz)]); err != nil {
+		return err
+	}
+	return r.bus.Write(byte(RegIrqFlags), IrqFhssChangeChannel)
+}
@@ -0,0 +1,132 @@
+package sx1276
+
+import "strconv"
+
+// Log_level ranks log messages by how verbose they are.
+type Log_level uint
+
+const (
+	LogLevelRegIO Log_level = iota
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelErr
+)
+
+// String returns the level's name as it's shown on log messages.
+func (l Log_level) String() string {
+	switch l {
+	case LogLevelRegIO:
+		return "REG I/O"
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARNING"
+	case LogLevelErr:
+		return "ERROR"
+	}
+	return "LEVEL " + strconv.Itoa(int(l))
+}
+
+// Logger receives the messages drivers log along with structured
+// fields describing them, given as alternating keys and values just
+// like with log/slog. Keys are strings such as "device", "addr" or
+// "mode". As devices log from their own goroutines, Loggers must be
+// safe for concurrent use.
+type Logger interface {
+	Log(level Log_level, msg string, keyvals ...interface{})
+}
+
+// NopLogger discards every message. Drivers log
+// through it unless they're given a Logger.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Log_level, string, ...interface{}) {}
+
+// With returns a Logger adding keyvals ahead of the fields of
+// every message logged through l, which comes in handy to tell
+// devices apart. NopLogger is returned as it is.
+func With(l Logger, keyvals ...interface{}) Logger {
+	if l == NopLogger || len(keyvals) == 0 {
+		return l
+	}
+	return withLogger{l, keyvals[:len(keyvals):len(keyvals)]}
+}
+
+type withLogger struct {
+	l       Logger
+	keyvals []interface{}
+}
+
+func (w withLogger) Log(level Log_level, msg string, keyvals ...interface{}) {
+	w.l.Log(level, msg, append(w.keyvals, keyvals...)...)
+}
+
+// PrintLogger writes the messages at or above Level through the
+// print builtins, which TinyGo routes to the board's serial console.
+// Field values other than strings, integers, booleans, byte slices,
+// errors and Stringers are shown as a question mark, which spares
+// the smaller boards from pulling fmt in.
+type PrintLogger struct {
+	Level Log_level
+}
+
+func (p PrintLogger) Log(level Log_level, msg string, keyvals ...interface{}) {
+	if level < p.Level {
+		return
+	}
+	print("* ", level.String(), " * ", msg)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key, _ := keyvals[i].(string)
+		print(" ", key, "=", logValue(keyvals[i+1]))
+	}
+	println()
+}
+
+// logValue formats v as PrintLogger shows it.
+func logValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int8:
+		return strconv.Itoa(int(v))
+	case int16:
+		return strconv.Itoa(int(v))
+	case int32:
+		return strconv.Itoa(int(v))
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case []byte:
+		s := "["
+		for i, b := range v {
+			if i > 0 {
+				s += " "
+			}
+			s += strconv.Itoa(int(b))
+		}
+		return s + "]"
+	case error:
+		return v.Error()
+	case interface{ String() string }:
+		return v.String()
+	}
+	return "?"
+}
@@ -0,0 +1,312 @@
+package sx1276
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// ErrEmptyPacket is returned when the radio signals a
+	// reception but the received packet carries no data.
+	ErrEmptyPacket = errors.New("received an empty packet")
+
+	// ErrCRC is returned when the received packet's payload
+	// doesn't match its Cyclic Redundancy Check.
+	ErrCRC = errors.New("payload CRC mismatch")
+
+	// ErrMissingCRC is returned when a packet without a CRC is
+	// received whilst CRCs are enabled. It matches ErrCRC too.
+	ErrMissingCRC error = wrapError{ErrCRC, "packet carries no CRC"}
+
+	// ErrPayloadTooLong is returned when the data to send
+	// doesn't fit in the radio's FIFO.
+	ErrPayloadTooLong = errors.New("payload is too long")
+
+	// ErrInvalidHeader is returned when a packet is received
+	// without the radio flagging a valid header.
+	ErrInvalidHeader = errors.New("received a packet without a valid header")
+
+	// ErrPayloadLength is returned when the data to send doesn't
+	// match the fixed payload length of implicit header mode.
+	ErrPayloadLength = errors.New("payload doesn't match the fixed payload length")
+)
+
+// LinkQuality holds the metadata the radio
+// reports for the last received packet.
+type LinkQuality struct {
+	// RssiDBm is the packet's Received Signal Strength
+	// Indicator in dBm, corrected for the RF port in use
+	// and for low SNR conditions.
+	RssiDBm int
+
+	// SnrDB is the packet's Signal to Noise Ratio in dB.
+	SnrDB float64
+
+	// FreqErrorHz is the estimated offset between the
+	// transmitter's carrier and ours in Hz.
+	FreqErrorHz int
+}
+
+// IrqFlags returns the contents of RegIrqFlags. Check the Irq*
+// masks for the meaning of each bit.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) IrqFlags() (byte, error) {
+	return r.bus.Read(byte(RegIrqFlags))
+}
+
+// ModemStatus returns the contents of RegModemStat. Check the
+// ModemStat* masks for the meaning of each bit.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) ModemStatus() (byte, error) {
+	return r.bus.Read(byte(RegModemStat))
+}
+
+// ClearIrqFlags clears every IRQ flag.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) ClearIrqFlags() error {
+	return r.bus.Write(byte(RegIrqFlags), 0xFF)
+}
+
+// MapDio0 configures the signal the chip raises on its DIO0 pin.
+// Check the Dio0* constants for the available choices.
+// It returns any errors raised by the underlying SPI transaction.
+func (r *Radio) MapDio0(signal byte) error {
+	return r.WriteRegister(RegDioMappingA, 2, 6, signal)
+}
+
+// TxDone returns a boolean indicating whether the Tx IRQ
+// flag is set or not. If the underlying SPI transcation
+// throws an error we'll default to assuming the Tx ins't
+// finished, thus returning false.
+func (r *Radio) TxDone() bool {
+	tx_flag, err := r.ReadRegister(RegIrqFlags, 1, 3)
+	if err != nil {
+		return false
+	}
+	return tx_flag == 0x1
+}
+
+// RxDone returns a boolean indicating whether the Rx IRQ
+// flag is set or not. If the underlying SPI transcation
+// throws an error we'll default to assuming the Rx ins't
+// finished, thus returning false.
+func (r *Radio) RxDone() bool {
+	rx_flag, err := r.ReadRegister(RegIrqFlags, 1, 6)
+	if err != nil {
+		return false
+	}
+	return rx_flag == 0x1
+}
+
+// StartCad maps DIO0 to CadDone, clears the IRQ flags and starts
+// a Channel Activity Detection. Once IrqCadDone is raised the radio
+// returns to Standby on its own, with IrqCadDetected telling whether
+// a LoRa preamble was found. The radio should be in Standby. The
+// LoRa modem must be selected, failing with ErrModem otherwise.
+// It returns any errors raised by the underlying SPI transactions.
+func (r *Radio) StartCad() error {
+	if r.modem != ModemLoRa {
+		return wrapError{ErrModem, "CAD with the " + r.modem.String() + " modem"}
+	}
+	if err := r.MapDio0(Dio0CadDone); err != nil {
+		return err
+	}
+	if err := r.ClearIrqFlags(); err != nil {
+		return err
+	}
+	return r.SetMode(OpModeCad)
+}
+
+// WritePacket loads payload into the FIFO at the transmission base
+// address and configures its length so that the radio sends it as
+// soon as it enters Tx. The radio should be in Sleep or Standby.
+// Payloads longer than MaxPacketLength fail with ErrPayloadTooLong
+// and, in implicit header mode, those whose length isn't the fixed
+// one fail with ErrPayloadLength.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) WritePacket(payload []byte) error {
+	if len(payload) > MaxPacketLength {
+		return wrapError{ErrPayloadTooLong, strconv.Itoa(len(payload)) + " bytes (max. " + strconv.Itoa(MaxPacketLength) + ")"}
+	}
+	if r.implicit && len(payload) != int(r.payloadLength) {
+		return wrapError{ErrPayloadLength, strconv.Itoa(len(payload)) + " bytes (expected " + strconv.Itoa(int(r.payloadLength)) + ")"}
+	}
+
+	tx_base, err := r.ReadRegister(RegFifoTxBaseAddr, 8, 0)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteRegister(RegFifoAddrPtr, 8, 0, tx_base); err != nil {
+		return err
+	}
+	if err := r.WriteFifo(payload); err != nil {
+		return err
+	}
+	return r.WriteRegister(RegPayloadLength, 8, 0, byte(len(payload)))
+}
+
+// ReadPacket retrieves the packet the radio has just received into
+// buf, returning the slice of it holding the packet. If buf is nil a
+// new slice is allocated instead. Packets carrying no data fail with
+// ErrEmptyPacket and those not fitting in buf with io.ErrShortBuffer.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) ReadPacket(buf []byte) ([]byte, error) {
+	pkt_len, err := r.ReadRegister(RegRxNbBytes, 8, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pkt_len == 0 {
+		return nil, ErrEmptyPacket
+	}
+
+	if buf == nil {
+		buf = make([]byte, pkt_len)
+	} else if len(buf) < int(pkt_len) {
+		return nil, io.ErrShortBuffer
+	}
+	pkt := buf[:pkt_len]
+
+	pkt_addr, err := r.ReadRegister(RegFifoRxCurrentAddr, 8, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.WriteRegister(RegFifoAddrPtr, 8, 0, pkt_addr); err != nil {
+		return nil, err
+	}
+
+	if err := r.ReadFifo(pkt); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
+
+// CheckPacket inspects the IRQ flags of a received packet, provided
+// on flags, to make sure it carried a valid header and a correct CRC.
+// It returns ErrInvalidHeader, ErrCRC or ErrMissingCRC describing the
+// problem, if any, or any errors raised by the underlying SPI transaction.
+func (r *Radio) CheckPacket(flags byte) error {
+	if err := r.CheckHeader(flags); err != nil {
+		return err
+	}
+	return r.CheckCrc(flags)
+}
+
+// CheckHeader inspects the IRQ flags of a received packet to make
+// sure it carried a valid header, returning ErrInvalidHeader if it
+// didn't. There's no header to check in implicit header mode.
+func (r *Radio) CheckHeader(flags byte) error {
+	if !r.implicit && flags&IrqValidHeader == 0 {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+// CheckCrc inspects the IRQ flags of a received packet along with
+// RegHopChannel to make sure its payload CRC was present and valid.
+// In implicit header mode there's no header telling whether the
+// packet carries a CRC, so it's assumed to if CRCs are enabled.
+// It returns ErrCRC or ErrMissingCRC describing the problem, if any,
+// or any errors raised by the underlying SPI transaction.
+func (r *Radio) CheckCrc(flags byte) error {
+	if flags&IrqPayloadCrcError != 0 {
+		return ErrCRC
+	}
+
+	if !r.crc || r.implicit {
+		return nil
+	}
+
+	hop_ch, err := r.bus.Read(byte(RegHopChannel))
+	if err != nil {
+		return err
+	}
+	if hop_ch&HopChannelCrcOnPayload == 0 {
+		return ErrMissingCRC
+	}
+
+	return nil
+}
+
+// LinkQuality returns the link metadata of the last received packet.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) LinkQuality() (LinkQuality, error) {
+	var q LinkQuality
+
+	raw_snr, err := r.bus.Read(byte(RegPktSnrValue))
+	if err != nil {
+		return LinkQuality{}, err
+	}
+	raw_rssi, err := r.bus.Read(byte(RegPktRssiValue))
+	if err != nil {
+		return LinkQuality{}, err
+	}
+
+	// The SNR is stored as a two's complement value in 0.25 dB steps.
+	snr := int(int8(raw_snr))
+	q.SnrDB = float64(snr) / 4
+
+	// Refer to section 5.5.5 on the datasheet for the following corrections.
+	if snr < 0 {
+		q.RssiDBm = r.rssiOffset() + int(raw_rssi) + snr/4
+	} else {
+		q.RssiDBm = r.rssiOffset() + int(raw_rssi)*16/15
+	}
+
+	if q.FreqErrorHz, err = r.FreqError(); err != nil {
+		return LinkQuality{}, err
+	}
+
+	return q, nil
+}
+
+// CurrentRssi returns the current RSSI in dBm as measured on
+// the channel. It's only meaningful whilst the radio is in Rx.
+// It also returns any errors raised by the underlying SPI transaction.
+func (r *Radio) CurrentRssi() (int, error) {
+	raw, err := r.bus.Read(byte(RegRssiValue))
+	if err != nil {
+		return 0, err
+	}
+	return r.rssiOffset() + int(raw), nil
+}
+
+// FreqError returns the frequency error estimated for the last received
+// packet in Hz. Refer to section 4.1.5 on the datasheet for details.
+// It also returns any errors raised by the underlying SPI transactions.
+func (r *Radio) FreqError() (int, error) {
+	msb, err := r.ReadRegister(RegFeiMsb, 4, 0)
+	if err != nil {
+		return 0, err
+	}
+	mid, err := r.bus.Read(byte(RegFeiMid))
+	if err != nil {
+		return 0, err
+	}
+	lsb, err := r.bus.Read(byte(RegFeiLsb))
+	if err != nil {
+		return 0, err
+	}
+
+	// The register holds a 20-bit two's complement value.
+	raw := int64(msb)<<16 | int64(mid)<<8 | int64(lsb)
+	if raw&0x80000 != 0 {
+		raw -= 0x100000
+	}
+
+	bw, err := r.BwHz()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(raw * (1 << 24) * int64(bw) / (OscFreqHz * 500000)), nil
+}
+
+// rssiOffset returns the offset to apply to raw RSSI
+// readings given the RF port currently in use.
+func (r *Radio) rssiOffset() int {
+	if r.LowFreqMode() {
+		return RssiOffsetLF
+	}
+	return RssiOffsetHF
+}
@@ -0,0 +1,172 @@
+package sx1276
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Channel is a carrier frequency along with the
+// bandwidth it's meant to be used with.
+type Channel struct {
+	FrequencyHz uint
+	BandwidthHz uint
+}
+
+// Plan describes the channels and the transmission rules of one
+// of the regional LoRa channel plans. They follow LoRa Alliance's
+// RP002 Regional Parameters, which is where the figures come from.
+type Plan struct {
+	// Name identifies the plan, as in EU868.
+	Name string
+
+	// Channels lists the channels in the plan. A channel is
+	// referred to by its index in the list.
+	Channels []Channel
+
+	// MaxEirpDbm is the maximum Effective Isotropic Radiated
+	// Power allowed. Bear in mind the antenna's gain adds to
+	// the transmission power.
+	MaxEirpDbm uint
+
+	// DutyCycle is the fraction of the time a device may
+	// spend transmitting, or 0 when it's not restricted.
+	DutyCycle float64
+}
+
+var (
+	// EU868 covers the 863 to 870 MHz band in Europe. Channels
+	// 0 to 2 are the ones every device listens on by default.
+	EU868 = Plan{
+		Name: "EU868",
+		Channels: concat(
+			channels(868100000, 200000, 3, 125000),
+			channels(867100000, 200000, 5, 125000),
+		),
+		MaxEirpDbm: 16,
+		DutyCycle:  0.01,
+	}
+
+	// EU433 covers the 433.05 to 434.79 MHz band in Europe.
+	EU433 = Plan{
+		Name:       "EU433",
+		Channels:   channels(433175000, 200000, 3, 125000),
+		MaxEirpDbm: 12,
+		DutyCycle:  0.1,
+	}
+
+	// US915 covers the 902 to 928 MHz band in North America.
+	// Channels 0 to 63 are 125 kHz uplinks, channels 64 to 71
+	// are 500 kHz uplinks and channels 72 to 79 are downlinks.
+	US915 = Plan{
+		Name: "US915",
+		Channels: concat(
+			channels(902300000, 200000, 64, 125000),
+			channels(903000000, 1600000, 8, 500000),
+			channels(923300000, 600000, 8, 500000),
+		),
+		MaxEirpDbm: 30,
+	}
+
+	// AU915 covers the 915 to 928 MHz band in Australia.
+	// Channels are laid out just like in US915.
+	AU915 = Plan{
+		Name: "AU915",
+		Channels: concat(
+			channels(915200000, 200000, 64, 125000),
+			channels(915900000, 1600000, 8, 500000),
+			channels(923300000, 600000, 8, 500000),
+		),
+		MaxEirpDbm: 30,
+	}
+
+	// Plans holds every known plan indexed by name.
+	Plans = map[string]Plan{
+		EU868.Name: EU868,
+		EU433.Name: EU433,
+		US915.Name: US915,
+		AU915.Name: AU915,
+	}
+)
+
+// ErrUnknownChannel is returned when looking up a
+// channel that doesn't belong to a plan.
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// channels returns n channels with bandwidth bw,
+// the first at first Hz and spaced step Hz apart.
+func channels(first, step uint, n int, bw uint) []Channel {
+	chs := make([]Channel, n)
+	for i := range chs {
+		chs[i] = Channel{FrequencyHz: first + uint(i)*step, BandwidthHz: bw}
+	}
+	return chs
+}
+
+// concat joins several channel lists.
+func concat(lists ...[]Channel) []Channel {
+	var chs []Channel
+	for _, l := range lists {
+		chs = append(chs, l...)
+	}
+	return chs
+}
+
+// Channel returns the channel numbered n in p, which
+// is an error matching ErrUnknownChannel if there's none.
+func (p Plan) Channel(n int) (Channel, error) {
+	if n < 0 || n >= len(p.Channels) {
+		return Channel{}, wrapError{ErrUnknownChannel, p.Name + " has no channel " + strconv.Itoa(n)}
+	}
+	return p.Channels[n], nil
+}
+
+// Check verifies whether c abides by the plan's rules. That is,
+// whether it transmits on one of the plan's channels with its
+// bandwidth and without exceeding the maximum EIRP, assuming an
+// antenna with no gain. It returns an error describing the first
+// problem found.
+func (p Plan) Check(c Config) error {
+	if c.TxPowerDbm > p.MaxEirpDbm {
+		return errors.New(p.Name + " allows no more than " + strconv.FormatUint(uint64(p.MaxEirpDbm), 10) +
+			" dBm: " + strconv.FormatUint(uint64(c.TxPowerDbm), 10) + " dBm")
+	}
+	for _, ch := range p.Channels {
+		if ch.FrequencyHz == c.FrequencyHz && ch.BandwidthHz == c.BandwidthHz {
+			return nil
+		}
+	}
+	return wrapError{ErrUnknownChannel, p.Name + " has no " + strconv.FormatUint(uint64(c.BandwidthHz), 10) +
+		" Hz channel at " + strconv.FormatUint(uint64(c.FrequencyHz), 10) + " Hz"}
+}
+
+// ParseFrequency parses either a carrier frequency in MHz, such as
+// 868.1, or a plan's name and a channel number separated by a colon,
+// such as EU868:0. Plan names are case insensitive. The returned
+// Channel carries no bandwidth and the Plan is the zero value unless
+// a plan's channel was given.
+func ParseFrequency(s string) (Channel, Plan, error) {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, n := s[:i], s[i+1:]
+		p, ok := Plans[strings.ToUpper(name)]
+		if !ok {
+			return Channel{}, Plan{}, errors.New("unknown channel plan: " + name)
+		}
+		ch_n, err := strconv.Atoi(n)
+		if err != nil {
+			return Channel{}, Plan{}, errors.New("invalid channel number: " + n)
+		}
+		ch, err := p.Channel(ch_n)
+		if err != nil {
+			return Channel{}, Plan{}, err
+		}
+		return ch, p, nil
+	}
+
+	mhz, err := strconv.ParseFloat(s, 64)
+	if err != nil || mhz <= 0 {
+		return Channel{}, Plan{}, errors.New("invalid frequency: " + s)
+	}
+	return Channel{FrequencyHz: uint(math.Round(mhz * 1e6))}, Plan{}, nil
+}
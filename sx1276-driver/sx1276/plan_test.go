@@ -0,0 +1,112 @@
+package sx1276
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFrequency(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want Channel
+		plan string
+		err  bool
+	}{
+		{s: "868.1", want: Channel{FrequencyHz: 868100000}},
+		{s: "433.175", want: Channel{FrequencyHz: 433175000}},
+		{s: "915", want: Channel{FrequencyHz: 915000000}},
+		{s: "EU868:0", want: Channel{FrequencyHz: 868100000, BandwidthHz: 125000}, plan: "EU868"},
+		{s: "eu868:3", want: Channel{FrequencyHz: 867100000, BandwidthHz: 125000}, plan: "EU868"},
+		{s: "US915:63", want: Channel{FrequencyHz: 914900000, BandwidthHz: 125000}, plan: "US915"},
+		{s: "US915:64", want: Channel{FrequencyHz: 903000000, BandwidthHz: 500000}, plan: "US915"},
+		{s: "AU915:72", want: Channel{FrequencyHz: 923300000, BandwidthHz: 500000}, plan: "AU915"},
+		{s: "EU868:8", err: true},
+		{s: "EU868:-1", err: true},
+		{s: "EU868:a", err: true},
+		{s: "XX123:0", err: true},
+		{s: "abc", err: true},
+		{s: "-868.1", err: true},
+		{s: "", err: true},
+	} {
+		ch, p, err := ParseFrequency(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseFrequency(%q) = %+v, want an error", tc.s, ch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFrequency(%q) = %v", tc.s, err)
+			continue
+		}
+		if ch != tc.want || p.Name != tc.plan {
+			t.Errorf("ParseFrequency(%q) = %+v, %q, want %+v, %q", tc.s, ch, p.Name, tc.want, tc.plan)
+		}
+	}
+
+	if _, _, err := ParseFrequency("EU868:8"); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("ParseFrequency() = %v for a channel out of the plan, want %v", err, ErrUnknownChannel)
+	}
+}
+
+func TestPlanCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		p       Plan
+		c       Config
+		ok      bool
+		unknown bool
+	}{
+		{
+			name: "default EU868 channel",
+			p:    EU868,
+			c:    Config{FrequencyHz: 868100000, BandwidthHz: 125000, TxPowerDbm: 14},
+			ok:   true,
+		},
+		{
+			name: "maximum EIRP",
+			p:    EU868,
+			c:    Config{FrequencyHz: 867900000, BandwidthHz: 125000, TxPowerDbm: 16},
+			ok:   true,
+		},
+		{
+			name: "too much power",
+			p:    EU868,
+			c:    Config{FrequencyHz: 868100000, BandwidthHz: 125000, TxPowerDbm: 17},
+		},
+		{
+			name:    "off the channel grid",
+			p:       EU868,
+			c:       Config{FrequencyHz: 868000000, BandwidthHz: 125000, TxPowerDbm: 14},
+			unknown: true,
+		},
+		{
+			name:    "wrong bandwidth",
+			p:       EU868,
+			c:       Config{FrequencyHz: 868100000, BandwidthHz: 250000, TxPowerDbm: 14},
+			unknown: true,
+		},
+		{
+			name: "US915 500 kHz uplink",
+			p:    US915,
+			c:    Config{FrequencyHz: 904600000, BandwidthHz: 500000, TxPowerDbm: 20},
+			ok:   true,
+		},
+		{
+			name:    "US915 125 kHz channel at a 500 kHz frequency",
+			p:       US915,
+			c:       Config{FrequencyHz: 903000000, BandwidthHz: 125000, TxPowerDbm: 20},
+			unknown: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.p.Check(tc.c)
+			if (err == nil) != tc.ok {
+				t.Fatalf("Check() = %v", err)
+			}
+			if errors.Is(err, ErrUnknownChannel) != tc.unknown {
+				t.Errorf("Check() = %v, which should match %v: %v", err, ErrUnknownChannel, tc.unknown)
+			}
+		})
+	}
+}
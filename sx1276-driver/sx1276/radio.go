@@ -0,0 +1,152 @@
+package sx1276
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrReset is returned when the radio doesn't come
+// out of a reset in Standby as it should.
+var ErrReset = errors.New("radio didn't come out of reset in Standby")
+
+// wrapError adds detail to an error whilst still matching it.
+// It spares us from pulling fmt in on the smaller boards.
+type wrapError struct {
+	err    error
+	detail string
+}
+
+func (e wrapError) Error() string { return e.err.Error() + ": " + e.detail }
+
+func (e wrapError) Unwrap() error { return e.err }
+
+// Radio drives an SX1276 through a RegisterBus. It's not safe for
+// concurrent use: platforms are expected to serialise access to it.
+type Radio struct {
+	// bus grants access to the chip's registers.
+	bus RegisterBus
+
+	// highPower specifies whether we're transmitting
+	// through the PA_BOOST pin.
+	highPower bool
+
+	// crc specifies whether Cyclic Redundancy Checks are enabled.
+	crc bool
+
+	// implicit specifies whether packets go without a LoRa header.
+	implicit bool
+
+	// payloadLength is the fixed length of every
+	// packet in implicit header mode.
+	payloadLength byte
+
+	// hopping is the hopping sequence set through SetHopping.
+	hopping Hopping
+
+	// hops counts the hops since the packet being sent or received
+	// began, which RegHopChannel only does up to 63.
+	hops int
+
+	// modem is the modem selected through SetModem or SetLoRa.
+	modem Modem
+
+	// fsk holds the parameters of the FSK/OOK modem.
+	fsk FskConfig
+
+	// carriersHz holds the carrier frequency each
+	// modem was last tuned to, as they share it.
+	carriersHz [2]uint
+}
+
+// New returns a Radio driving the chip behind bus. The chip
+// isn't touched until the Radio's methods are called.
+func New(bus RegisterBus) *Radio {
+	return &Radio{
+		bus:       bus,
+		highPower: DefaultConfig.HighPower,
+		crc:       DefaultConfig.Crc,
+		implicit:  DefaultConfig.ImplicitHeader,
+		fsk:       DefaultFskConfig,
+	}
+}
+
+// Bus returns the RegisterBus the radio is driven through.
+func (r *Radio) Bus() RegisterBus {
+	return r.bus
+}
+
+// Reset drives the radio's reset pin to return it to a known
+// state. It then checks whether the operation was successful
+// by reading back the operating mode, which should be Standby,
+// returning ErrReset otherwise. The radio comes out of a reset
+// with the FSK/OOK modem selected.
+// It also returns any errors raised by the underlying bus.
+func (r *Radio) Reset() error {
+	if err := r.bus.Reset(); err != nil {
+		return err
+	}
+	r.modem = ModemFsk
+
+	mode, err := r.ReadRegister(RegOpMode, 3, 0)
+	if err != nil {
+		return err
+	}
+	if op_mode(mode) != OpModeStandby {
+		return wrapError{ErrReset, "current Op Mode is " + strconv.Itoa(int(mode))}
+	}
+	return nil
+}
+
+// Version returns the chips version number
+// along with any errors raised by the
+// SPI transaction.
+func (r *Radio) Version() (byte, error) {
+	return r.bus.Read(byte(RegVersion))
+}
+
+// ReadRegister returns a register slice of the given size at the given
+// offset from the register identified by the provided addr.
+// It resturns the read data and any errors raised by the SPI transaction.
+func (r *Radio) ReadRegister(addr reg_addr, size, offset byte) (byte, error) {
+	c_reg, err := r.bus.Read(byte(addr))
+	if err != nil {
+		return 0xFF, err
+	}
+	return (c_reg & (((1 << size) - 1) << offset)) >> offset, nil
+}
+
+// WriteRegister overwrites a register slice of the given size at the
+// given offset with the given data. The register is identified by its addr.
+// It returns any errors raised by the SPI interface.
+func (r *Radio) WriteRegister(addr reg_addr, size, offset, data byte) error {
+	if size == 8 {
+		return r.bus.Write(byte(addr), data)
+	}
+
+	c_reg, err := r.bus.Read(byte(addr))
+	if err != nil {
+		return err
+	}
+
+	// Clear out the register part we are to modify
+	c_reg &^= ((1 << size) - 1) << offset
+
+	// Force that part to the provided data
+	c_reg |= (data & ((1 << size) - 1)) << offset
+
+	return r.bus.Write(byte(addr), c_reg)
+}
+
+// ReadFifo fills data with the FIFO's contents starting
+// at RegFifoAddrPtr in a single burst transaction.
+// It returns any errors raised by the SPI transaction.
+func (r *Radio) ReadFifo(data []byte) error {
+	return r.bus.ReadBurst(byte(RegFifo), data)
+}
+
+// WriteFifo writes data to the FIFO starting at
+// RegFifoAddrPtr in a single burst transaction.
+// It returns any errors raised by the SPI transaction.
+func (r *Radio) WriteFifo(data []byte) error {
+	return r.bus.WriteBurst(byte(RegFifo), data)
+}
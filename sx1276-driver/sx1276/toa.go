@@ -0,0 +1,82 @@
+package sx1276
+
+import (
+	"math"
+	"time"
+)
+
+// ldroSymbolTime is the symbol time above which the datasheet
+// mandates enabling the Low Data Rate Optimisation.
+const ldroSymbolTime = 16 * time.Millisecond
+
+// SymbolTime returns the duration of a single LoRa symbol
+// with the spreading factor and bandwidth in c.
+func SymbolTime(c Config) time.Duration {
+	return symbolTime(c.SpreadingFactor, c.BandwidthHz)
+}
+
+// symbolTime returns the duration of a single LoRa symbol
+// with spreading factor sf and bandwidth bw.
+func symbolTime(sf byte, bw uint) time.Duration {
+	if bw == 0 {
+		return 0
+	}
+	return time.Duration(math.Exp2(float64(sf)) / float64(bw) * float64(time.Second))
+}
+
+// NeedsLdro checks whether the modem parameters in c call for the
+// Low Data Rate Optimisation, which is the case whenever the symbol
+// time exceeds 16 ms (e.g. SF11 and SF12 at 125 kHz).
+func NeedsLdro(c Config) bool {
+	return SymbolTime(c) > ldroSymbolTime
+}
+
+// TimeOnAir returns how long it takes to transmit a packet carrying
+// payloadLen bytes with the modem parameters in c. The Low Data Rate
+// Optimisation is assumed to be on whenever the symbol time exceeds
+// 16 ms. Refer to section 4.1.1.7 in the datasheet for the expressions
+// involved.
+func TimeOnAir(c Config, payloadLen int) time.Duration {
+	if c.BandwidthHz == 0 || c.SpreadingFactor == 0 || c.CodingRate < 5 {
+		return 0
+	}
+
+	sf := float64(c.SpreadingFactor)
+	t_sym := math.Exp2(sf) / float64(c.BandwidthHz)
+	t_preamble := (float64(c.PreambleLength) + 4.25) * t_sym
+
+	var crc, ih, de float64
+	if c.Crc {
+		crc = 1
+	}
+	if c.ImplicitHeader {
+		ih = 1
+	}
+	if NeedsLdro(c) {
+		de = 1
+	}
+
+	n_payload := math.Ceil((8*float64(payloadLen)-4*sf+28+16*crc-20*ih)/(4*(sf-2*de))) * float64(c.CodingRate)
+	n_payload = 8 + math.Max(n_payload, 0)
+
+	return time.Duration((t_preamble + n_payload*t_sym) * float64(time.Second))
+}
+
+// FskTimeOnAir returns how long it takes to transmit a packet carrying
+// payloadLen bytes with the FSK/OOK modem parameters in c: that is, its
+// preamble, sync word, length byte (unless packets have a fixed length),
+// payload and CRC at the configured bit rate.
+func FskTimeOnAir(c FskConfig, payloadLen int) time.Duration {
+	if c.BitrateBps == 0 {
+		return 0
+	}
+
+	n := int(c.PreambleLength) + len(c.SyncWord) + payloadLen
+	if !c.FixedLength {
+		n++
+	}
+	if c.Crc {
+		n += 2
+	}
+	return time.Duration(n*8) * time.Second / time.Duration(c.BitrateBps)
+}
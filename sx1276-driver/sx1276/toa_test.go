@@ -0,0 +1,97 @@
+package sx1276
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeOnAir(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Config
+		n    int
+		want time.Duration
+	}{
+		{
+			name: "SF7 125 kHz CR 4/5",
+			c:    Config{SpreadingFactor: 7, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    10,
+			want: 41216 * time.Microsecond,
+		},
+		{
+			name: "SF7 125 kHz CR 4/5 implicit header without CRC",
+			c:    Config{SpreadingFactor: 7, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, ImplicitHeader: true},
+			n:    10,
+			want: 36096 * time.Microsecond,
+		},
+		{
+			name: "SF9 125 kHz CR 4/5",
+			c:    Config{SpreadingFactor: 9, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    20,
+			want: 185344 * time.Microsecond,
+		},
+		{
+			name: "SF7 250 kHz CR 4/8",
+			c:    Config{SpreadingFactor: 7, BandwidthHz: 250000, CodingRate: 8, PreambleLength: 8, Crc: true},
+			n:    10,
+			want: 26752 * time.Microsecond,
+		},
+		{
+			name: "SF12 125 kHz CR 4/5 with LDRO",
+			c:    Config{SpreadingFactor: 12, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    10,
+			want: 991232 * time.Microsecond,
+		},
+		{
+			name: "SF12 125 kHz CR 4/5 with LDRO and a long payload",
+			c:    Config{SpreadingFactor: 12, BandwidthHz: 125000, CodingRate: 5, PreambleLength: 8, Crc: true},
+			n:    51,
+			want: 2465792 * time.Microsecond,
+		},
+		{
+			name: "unconfigured",
+			c:    Config{},
+			n:    10,
+			want: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TimeOnAir(tc.c, tc.n)
+			if diff := got - tc.want; diff > time.Microsecond || diff < -time.Microsecond {
+				t.Errorf("TimeOnAir() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNeedsLdro(t *testing.T) {
+	for _, tc := range []struct {
+		sf   byte
+		bw   uint
+		want bool
+	}{
+		{7, 125000, false},
+		{10, 125000, false},
+		{11, 125000, true},
+		{12, 125000, true},
+		{12, 250000, true},
+		{12, 500000, false},
+	} {
+		if got := NeedsLdro(Config{SpreadingFactor: tc.sf, BandwidthHz: tc.bw}); got != tc.want {
+			t.Errorf("NeedsLdro() = %v for SF%d at %d Hz, want %v", got, tc.sf, tc.bw, tc.want)
+		}
+	}
+}
+
+func TestFskTimeOnAir(t *testing.T) {
+	// 5 bytes of preamble, 2 of sync word, the length byte,
+	// 10 of payload and 2 of CRC at 50 kbps.
+	c := FskConfig{BitrateBps: 50000, PreambleLength: 5, SyncWord: []byte{0x12, 0xAD}, Crc: true}
+	if got, want := FskTimeOnAir(c, 10), 3200*time.Microsecond; got != want {
+		t.Errorf("FskTimeOnAir() = %v, want %v", got, want)
+	}
+	c.FixedLength = true
+	if got, want := FskTimeOnAir(c, 10), 3040*time.Microsecond; got != want {
+		t.Errorf("FskTimeOnAir() = %v with fixed length packets, want %v", got, want)
+	}
+}